@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"os/user"
@@ -20,13 +21,30 @@ const (
 	NetrcDefaultFilename string = ".netrc"
 )
 
+// ErrNoCredentials is returned (wrapped) by Writer.DeleteUsernamePassword when
+// no credentials are stored for the host
+var ErrNoCredentials = errors.New("no credentials stored")
+
 // Interface is a generic authentication interface
 type Interface interface {
-	// GetAuth retrieves the authentication credentials for a given host, or
-	// throws an error
+	// GetUsernamePassword retrieves the authentication credentials for a given
+	// host, or throws an error
 	GetUsernamePassword(host string) (string, string, error)
 }
 
+// Writer is implemented by providers that can also store credentials
+type Writer interface {
+	Interface
+
+	// SetUsernamePassword stores the credentials for a given host, replacing
+	// any existing ones
+	SetUsernamePassword(host, username, password string) error
+
+	// DeleteUsernamePassword removes the credentials for a given host. If
+	// there are none, the error wraps ErrNoCredentials.
+	DeleteUsernamePassword(host string) error
+}
+
 // Config represents a configuration structure passed to the Netrc object
 // in order to initialize it
 type Config struct {
@@ -51,6 +69,25 @@ func NewConfig() (*Config, error) {
 	}, nil
 }
 
+// OpenNetrc returns a netrc auth manager for the current user's ~/.netrc. If
+// the file does not exist yet, the manager starts out empty and the file is
+// created once credentials are stored.
+func OpenNetrc() (*NetrcAuth, error) {
+	curUser, err := user.Current()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{User: curUser, Filename: NetrcDefaultFilename}
+	path := filepath.Join(curUser.HomeDir, NetrcDefaultFilename)
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return &NetrcAuth{Config: cfg, Netrc: netrc.New(path)}, nil
+	}
+
+	return NewNetrc(cfg)
+}
+
 // NetrcAuth reresents the implementation of the netrc authentication manager
 // interface
 type NetrcAuth struct {
@@ -98,3 +135,38 @@ func (a *NetrcAuth) GetAuth(host string) (string, string, error) {
 
 	return netrcHost.Get(NetrcUsernameField), netrcHost.Get(NetrcPasswordField), nil
 }
+
+// GetUsernamePassword satisfies Interface for NetrcAuth
+func (a *NetrcAuth) GetUsernamePassword(host string) (string, string, error) {
+	return a.GetAuth(host)
+}
+
+// SetUsernamePassword adds or replaces the machine entry for host and saves
+// the netrc file
+func (a *NetrcAuth) SetUsernamePassword(host, username, password string) error {
+	a.Netrc.AddMachine(host, username, password)
+
+	return a.Netrc.Save()
+}
+
+// DeleteUsernamePassword removes the machine entry for host and saves the
+// netrc file
+func (a *NetrcAuth) DeleteUsernamePassword(host string) error {
+	if a.Netrc.Machine(host) == nil {
+		return fmt.Errorf("%w for %s in %s", ErrNoCredentials, host, a.Netrc.Path)
+	}
+
+	a.Netrc.RemoveMachine(host)
+
+	return a.Netrc.Save()
+}
+
+func (a *NetrcAuth) String() string {
+	return fmt.Sprintf("netrc file %s", a.Netrc.Path)
+}
+
+// Compile-time interface satisfaction checks
+var (
+	_ Interface = (*NetrcAuth)(nil)
+	_ Writer    = (*NetrcAuth)(nil)
+)
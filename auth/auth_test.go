@@ -93,3 +93,32 @@ func TestAuthParseNetrcValidUser(t *testing.T) {
 
 	os.Remove(tempName)
 }
+
+func TestNetrcWriter(t *testing.T) {
+	tfd, err := ioutil.TempFile("/tmp", ".netrc")
+	assert.NoError(t, err)
+	assert.NoError(t, tfd.Close())
+
+	tempName := tfd.Name()
+	defer os.Remove(tempName)
+
+	MockAuth, err := NewNetrc(&Config{User: ValidUser, Filename: tempName})
+	assert.NoError(t, err)
+
+	assert.NoError(t, MockAuth.SetUsernamePassword("host.domain.tld", "user", "secret"))
+
+	// Re-read the file to make sure the credentials were persisted
+	MockAuth, err = NewNetrc(&Config{User: ValidUser, Filename: tempName})
+	assert.NoError(t, err)
+
+	user, pass, err := MockAuth.GetUsernamePassword("host.domain.tld")
+	assert.NoError(t, err)
+	assert.Equal(t, "user", user)
+	assert.Equal(t, "secret", pass)
+
+	assert.NoError(t, MockAuth.DeleteUsernamePassword("host.domain.tld"))
+	assert.ErrorIs(t, MockAuth.DeleteUsernamePassword("host.domain.tld"), ErrNoCredentials)
+
+	_, _, err = MockAuth.GetUsernamePassword("host.domain.tld")
+	assert.Error(t, err)
+}
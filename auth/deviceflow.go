@@ -0,0 +1,250 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultDeviceFlowBaseURL is the base URL of the public GitHub OAuth
+	// endpoints
+	DefaultDeviceFlowBaseURL string = "https://github.com"
+
+	// DeviceCodePath is the path of the device code request endpoint
+	DeviceCodePath string = "/login/device/code"
+
+	// AccessTokenPath is the path of the access token endpoint
+	AccessTokenPath string = "/login/oauth/access_token"
+
+	// DeviceCodeGrantType is the OAuth grant type for the device flow
+	DeviceCodeGrantType string = "urn:ietf:params:oauth:grant-type:device_code"
+
+	// DefaultPollInterval is how often the access token endpoint is polled
+	// when the server does not say (RFC 8628 section 3.2)
+	DefaultPollInterval time.Duration = 5 * time.Second
+
+	// slowDownIncrement is how much the polling interval grows when the server
+	// asks us to slow down without saying by how much (RFC 8628 section 3.5)
+	slowDownIncrement time.Duration = 5 * time.Second
+)
+
+var (
+	// ErrDeviceCodeExpired is returned when the user did not authorize the
+	// device before the code expired
+	ErrDeviceCodeExpired = errors.New("device code expired before authorization")
+
+	// ErrAccessDenied is returned when the user declined the authorization
+	ErrAccessDenied = errors.New("authorization was denied")
+)
+
+// DeviceCode is the response to a device code request
+type DeviceCode struct {
+	DeviceCode      string `json:"device_code"`
+	UserCode        string `json:"user_code"`
+	VerificationURI string `json:"verification_uri"`
+	ExpiresIn       int    `json:"expires_in"`
+	Interval        int    `json:"interval"`
+}
+
+// oauthError is an OAuth error response (RFC 6749 section 5.2), which
+// endpoints following the specification send with a 4xx status
+type oauthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+	Interval    int    `json:"interval"`
+}
+
+// Error satisfies error for oauthError
+func (e *oauthError) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+
+	return fmt.Sprintf("%s: %s", e.Code, e.Description)
+}
+
+// tokenResponse is the response of the access token endpoint, which reports
+// both successes and pending/failed authorizations
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	Scope            string `json:"scope"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+	Interval         int    `json:"interval"`
+}
+
+// DeviceFlow implements the OAuth 2.0 device authorization grant (RFC 8628)
+// as offered by GitHub
+type DeviceFlow struct {
+	// BaseURL is the scheme and host of the OAuth endpoints, e.g.
+	// https://github.com or https://github.example.com for GitHub Enterprise
+	// Server
+	BaseURL string
+
+	// ClientID is the client ID of the OAuth app to authorize
+	ClientID string
+
+	// Scopes are the OAuth scopes to request
+	Scopes []string
+
+	// HTTPClient is the client used to make requests. Defaults to
+	// http.DefaultClient.
+	HTTPClient *http.Client
+
+	// PollInterval is how often to poll for the access token when the server
+	// does not say. Defaults to DefaultPollInterval.
+	PollInterval time.Duration
+}
+
+// NewDeviceFlow creates a new device flow against the given base URL
+func NewDeviceFlow(baseURL, clientID string, scopes ...string) *DeviceFlow {
+	return &DeviceFlow{
+		BaseURL:  strings.TrimSuffix(baseURL, "/"),
+		ClientID: clientID,
+		Scopes:   scopes,
+	}
+}
+
+// post submits a form to the given endpoint path and decodes the JSON response
+// into v. OAuth error responses with a 4xx status are returned as an
+// *oauthError.
+func (f *DeviceFlow) post(
+	ctx context.Context, path string, form url.Values, v interface{},
+) error {
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodPost, f.BaseURL+path, strings.NewReader(form.Encode()),
+	)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	client := f.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+		oauthErr := &oauthError{}
+		if json.NewDecoder(resp.Body).Decode(oauthErr) == nil && oauthErr.Code != "" {
+			return oauthErr
+		}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", path, resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// RequestCode requests a device and user code. The user must then enter the
+// user code at the verification URI.
+func (f *DeviceFlow) RequestCode(ctx context.Context) (*DeviceCode, error) {
+	if f.ClientID == "" {
+		return nil, errors.New("no OAuth client ID configured")
+	}
+
+	code := &DeviceCode{}
+	if err := f.post(ctx, DeviceCodePath, url.Values{
+		"client_id": {f.ClientID},
+		"scope":     {strings.Join(f.Scopes, " ")},
+	}, code); err != nil {
+		return nil, fmt.Errorf("could not request device code: %w", err)
+	}
+
+	if code.DeviceCode == "" {
+		return nil, errors.New("no device code in response")
+	}
+
+	return code, nil
+}
+
+// PollToken polls the access token endpoint at the interval dictated by the
+// server (or PollInterval if it gives none) until the user has authorized the
+// device, the code expires, or ctx is done
+func (f *DeviceFlow) PollToken(ctx context.Context, code *DeviceCode) (string, error) {
+	interval := time.Duration(code.Interval) * time.Second
+	if interval <= 0 {
+		interval = f.PollInterval
+	}
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+
+	if code.ExpiresIn > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(
+			ctx, time.Duration(code.ExpiresIn)*time.Second,
+		)
+		defer cancel()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return "", ErrDeviceCodeExpired
+			}
+
+			return "", ctx.Err()
+		case <-time.After(interval):
+		}
+
+		// GitHub reports pending and failed authorizations with status 200,
+		// other servers with status 400 (RFC 8628 section 3.5)
+		resp := &tokenResponse{}
+		err := f.post(ctx, AccessTokenPath, url.Values{
+			"client_id":   {f.ClientID},
+			"device_code": {code.DeviceCode},
+			"grant_type":  {DeviceCodeGrantType},
+		}, resp)
+
+		oauthErr := &oauthError{}
+		if errors.As(err, &oauthErr) {
+			resp.Error = oauthErr.Code
+			resp.ErrorDescription = oauthErr.Description
+			resp.Interval = oauthErr.Interval
+		} else if err != nil {
+			return "", fmt.Errorf("could not poll for access token: %w", err)
+		}
+
+		switch resp.Error {
+		case "":
+			if resp.AccessToken == "" {
+				return "", errors.New("no access token in response")
+			}
+
+			return resp.AccessToken, nil
+		case "authorization_pending":
+			continue
+		case "slow_down":
+			if resp.Interval > 0 {
+				interval = time.Duration(resp.Interval) * time.Second
+			} else {
+				interval += slowDownIncrement
+			}
+		case "expired_token":
+			return "", ErrDeviceCodeExpired
+		case "access_denied":
+			return "", ErrAccessDenied
+		default:
+			return "", fmt.Errorf("%s: %s", resp.Error, resp.ErrorDescription)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newDeviceFlowServer starts a stand-in for the GitHub OAuth endpoints that
+// answers token polls with the given responses, in order. Error responses are
+// sent with errorStatus: 200 like GitHub, or 400 like RFC 8628.
+func newDeviceFlowServer(
+	t *testing.T, errorStatus int, polls ...map[string]interface{},
+) *httptest.Server {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc(DeviceCodePath, func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, "clientid", r.PostForm.Get("client_id"))
+		assert.Equal(t, "public_repo read:user", r.PostForm.Get("scope"))
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"device_code":      "devicecode",
+			"user_code":        "ABCD-1234",
+			"verification_uri": "https://github.com/login/device",
+			"expires_in":       900,
+		})
+	})
+
+	mux.HandleFunc(AccessTokenPath, func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, "devicecode", r.PostForm.Get("device_code"))
+		assert.Equal(t, DeviceCodeGrantType, r.PostForm.Get("grant_type"))
+
+		if len(polls) == 0 {
+			t.Fatal("unexpected poll")
+		}
+
+		if _, ok := polls[0]["error"]; ok {
+			w.WriteHeader(errorStatus)
+		}
+
+		json.NewEncoder(w).Encode(polls[0])
+		polls = polls[1:]
+	})
+
+	return httptest.NewServer(mux)
+}
+
+func TestDeviceFlow(t *testing.T) {
+	for _, errorStatus := range []int{http.StatusOK, http.StatusBadRequest} {
+		server := newDeviceFlowServer(t, errorStatus,
+			map[string]interface{}{"error": "authorization_pending"},
+			map[string]interface{}{"error": "slow_down", "interval": 1},
+			map[string]interface{}{"access_token": "newtoken", "token_type": "bearer"},
+		)
+
+		flow := NewDeviceFlow(server.URL+"/", "clientid", "public_repo", "read:user")
+		flow.PollInterval = time.Millisecond
+
+		code, err := flow.RequestCode(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, "ABCD-1234", code.UserCode)
+
+		token, err := flow.PollToken(context.Background(), code)
+		assert.NoError(t, err)
+		assert.Equal(t, "newtoken", token)
+
+		server.Close()
+	}
+}
+
+func TestDeviceFlowFailures(t *testing.T) {
+	testCases := []struct {
+		poll map[string]interface{}
+		err  error
+	}{
+		{
+			poll: map[string]interface{}{"error": "expired_token"},
+			err:  ErrDeviceCodeExpired,
+		},
+		{
+			poll: map[string]interface{}{"error": "access_denied"},
+			err:  ErrAccessDenied,
+		},
+	}
+
+	for _, tc := range testCases {
+		server := newDeviceFlowServer(t, http.StatusBadRequest, tc.poll)
+
+		flow := NewDeviceFlow(server.URL, "clientid", "public_repo", "read:user")
+		flow.PollInterval = time.Millisecond
+
+		code, err := flow.RequestCode(context.Background())
+		assert.NoError(t, err)
+
+		_, err = flow.PollToken(context.Background(), code)
+		assert.ErrorIs(t, err, tc.err)
+
+		server.Close()
+	}
+
+	_, err := NewDeviceFlow("http://localhost", "").RequestCode(context.Background())
+	assert.Error(t, err)
+}
+
+func TestDeviceFlowDefaultInterval(t *testing.T) {
+	// Any poll fails the test
+	server := newDeviceFlowServer(t, http.StatusOK)
+	defer server.Close()
+
+	flow := NewDeviceFlow(server.URL, "clientid", "public_repo", "read:user")
+
+	code, err := flow.RequestCode(context.Background())
+	assert.NoError(t, err)
+	assert.Zero(t, code.Interval)
+
+	// Without an interval from the server, polling waits DefaultPollInterval
+	// instead of hammering the endpoint
+	ctx, cancel := context.WithCancel(context.Background())
+	defer time.AfterFunc(100*time.Millisecond, cancel).Stop()
+
+	_, err = flow.PollToken(ctx, code)
+	assert.ErrorIs(t, err, context.Canceled)
+}
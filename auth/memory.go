@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"fmt"
+	"sync"
+)
+
+// MemoryAuth is an in-memory credential store, mainly useful for tests and
+// for embedding callers that already hold a token
+type MemoryAuth struct {
+	mu    sync.RWMutex
+	hosts map[string]Credentials
+}
+
+// NewMemory creates a new, empty in-memory auth provider
+func NewMemory() *MemoryAuth {
+	return &MemoryAuth{hosts: map[string]Credentials{}}
+}
+
+// Set stores credentials for the given host, replacing any existing ones
+func (a *MemoryAuth) Set(host, username, password string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.hosts[host] = Credentials{
+		Username: username,
+		Password: password,
+		Source:   a.String(),
+	}
+}
+
+// Delete removes any credentials stored for the given host
+func (a *MemoryAuth) Delete(host string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	delete(a.hosts, host)
+}
+
+// GetUsernamePassword retrieves the credentials stored for the given host
+func (a *MemoryAuth) GetUsernamePassword(host string) (string, string, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	creds, ok := a.hosts[host]
+	if !ok {
+		return "", "", fmt.Errorf("no auth for %s configured", host)
+	}
+
+	return creds.Username, creds.Password, nil
+}
+
+// SetUsernamePassword satisfies Writer for MemoryAuth
+func (a *MemoryAuth) SetUsernamePassword(host, username, password string) error {
+	a.Set(host, username, password)
+
+	return nil
+}
+
+// DeleteUsernamePassword satisfies Writer for MemoryAuth
+func (a *MemoryAuth) DeleteUsernamePassword(host string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok := a.hosts[host]; !ok {
+		return fmt.Errorf("%w for %s", ErrNoCredentials, host)
+	}
+	delete(a.hosts, host)
+
+	return nil
+}
+
+func (a *MemoryAuth) String() string {
+	return "in-memory credentials"
+}
+
+// Compile-time interface satisfaction checks
+var (
+	_ Interface = (*MemoryAuth)(nil)
+	_ Writer    = (*MemoryAuth)(nil)
+)
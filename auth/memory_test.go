@@ -0,0 +1,34 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryAuth(t *testing.T) {
+	mem := NewMemory()
+
+	_, _, err := mem.GetUsernamePassword("api.github.com")
+	assert.Error(t, err)
+
+	mem.Set("api.github.com", "user", "secret")
+
+	user, pass, err := mem.GetUsernamePassword("api.github.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "user", user)
+	assert.Equal(t, "secret", pass)
+
+	creds, err := NewChain(mem).Resolve("api.github.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "in-memory credentials", creds.Source)
+
+	mem.Delete("api.github.com")
+
+	_, _, err = mem.GetUsernamePassword("api.github.com")
+	assert.Error(t, err)
+
+	mem.Set("api.github.com", "user", "secret")
+	assert.NoError(t, mem.DeleteUsernamePassword("api.github.com"))
+	assert.ErrorIs(t, mem.DeleteUsernamePassword("api.github.com"), ErrNoCredentials)
+}
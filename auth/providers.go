@@ -0,0 +1,334 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// GitHubTokenEnvVar is the environment variable conventionally used to pass
+	// a GitHub token to tooling (e.g. in GitHub Actions)
+	GitHubTokenEnvVar string = "GITHUB_TOKEN"
+
+	// GHTokenEnvVar is the environment variable the gh CLI reads its token from
+	GHTokenEnvVar string = "GH_TOKEN"
+
+	// GHEnterpriseTokenEnvVar is the environment variable the gh CLI reads its
+	// token for GitHub Enterprise Server hosts from
+	GHEnterpriseTokenEnvVar string = "GH_ENTERPRISE_TOKEN"
+
+	// GitHubEnterpriseTokenEnvVar is an alternative to GHEnterpriseTokenEnvVar
+	GitHubEnterpriseTokenEnvVar string = "GITHUB_ENTERPRISE_TOKEN"
+
+	// GHConfigDirEnvVar overrides the gh CLI configuration directory
+	GHConfigDirEnvVar string = "GH_CONFIG_DIR"
+
+	// GHHostsFilename is the name of the gh CLI file that holds per-host
+	// credentials
+	GHHostsFilename string = "hosts.yml"
+)
+
+// HostScope restricts the hosts an environment variable token is sent to
+type HostScope int
+
+const (
+	// AnyHost - the token is used for every host
+	AnyHost HostScope = iota
+
+	// GitHubDotCom - the token is only used for github.com
+	GitHubDotCom
+
+	// EnterpriseHosts - the token is only used for hosts other than
+	// github.com, i.e. GitHub Enterprise Server instances
+	EnterpriseHosts
+)
+
+// isGitHubDotCom reports whether host is github.com or its API host
+func isGitHubDotCom(host string) bool {
+	host = strings.ToLower(host)
+
+	return host == "github.com" || host == "api.github.com"
+}
+
+// EnvAuth reads a token from an environment variable. Since tokens passed this
+// way carry no username, the username is always empty.
+type EnvAuth struct {
+	// Var is the name of the environment variable holding the token
+	Var string
+
+	// Hosts restricts the hosts the token is used for
+	Hosts HostScope
+}
+
+// NewEnv creates a new environment variable auth provider whose token is used
+// for every host
+func NewEnv(envVar string) *EnvAuth {
+	return &EnvAuth{Var: envVar}
+}
+
+// NewScopedEnv creates a new environment variable auth provider whose token is
+// only used for the hosts in scope
+func NewScopedEnv(envVar string, scope HostScope) *EnvAuth {
+	return &EnvAuth{Var: envVar, Hosts: scope}
+}
+
+// GetUsernamePassword returns the token held in the environment variable, if
+// the host is in its scope
+func (a *EnvAuth) GetUsernamePassword(host string) (string, string, error) {
+	switch {
+	case a.Hosts == GitHubDotCom && !isGitHubDotCom(host):
+		return "", "", fmt.Errorf("$%s is only used for github.com", a.Var)
+	case a.Hosts == EnterpriseHosts && isGitHubDotCom(host):
+		return "", "", fmt.Errorf("$%s is not used for github.com", a.Var)
+	}
+
+	token := strings.TrimSpace(os.Getenv(a.Var))
+	if token == "" {
+		return "", "", fmt.Errorf("$%s is not set", a.Var)
+	}
+
+	return "", token, nil
+}
+
+func (a *EnvAuth) String() string {
+	return fmt.Sprintf("$%s environment variable", a.Var)
+}
+
+// TokenFileAuth reads a token from a file containing nothing but the token
+// (surrounding whitespace is ignored)
+type TokenFileAuth struct {
+	// Path is the location of the token file
+	Path string
+}
+
+// NewTokenFile creates a new token file auth provider
+func NewTokenFile(path string) *TokenFileAuth {
+	return &TokenFileAuth{Path: path}
+}
+
+// GetUsernamePassword returns the token held in the token file, regardless of
+// the host
+func (a *TokenFileAuth) GetUsernamePassword(host string) (string, string, error) {
+	contents, err := ioutil.ReadFile(a.Path)
+	if err != nil {
+		return "", "", err
+	}
+
+	token := strings.TrimSpace(string(contents))
+	if token == "" {
+		return "", "", fmt.Errorf("%s is empty", a.Path)
+	}
+
+	return "", token, nil
+}
+
+// SetUsernamePassword writes the token to the token file. The username is not
+// stored.
+func (a *TokenFileAuth) SetUsernamePassword(host, username, password string) error {
+	if err := os.MkdirAll(filepath.Dir(a.Path), 0700); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(a.Path, []byte(password+"\n"), 0600)
+}
+
+// DeleteUsernamePassword removes the token file
+func (a *TokenFileAuth) DeleteUsernamePassword(host string) error {
+	err := os.Remove(a.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w in %s", ErrNoCredentials, a.Path)
+	}
+
+	return err
+}
+
+func (a *TokenFileAuth) String() string {
+	return fmt.Sprintf("token file %s", a.Path)
+}
+
+// ghHost is a single host entry in the gh CLI hosts.yml file
+type ghHost struct {
+	User       string `yaml:"user"`
+	OAuthToken string `yaml:"oauth_token"`
+}
+
+// GHCLIAuth reads credentials stored by the gh CLI (https://cli.github.com)
+// in its hosts.yml file
+type GHCLIAuth struct {
+	// Path is the location of the gh CLI hosts.yml file
+	Path string
+}
+
+// NewGHCLI creates a new gh CLI auth provider, locating hosts.yml the same
+// way gh does: $GH_CONFIG_DIR, then $XDG_CONFIG_HOME/gh, then ~/.config/gh
+func NewGHCLI() (*GHCLIAuth, error) {
+	if dir := os.Getenv(GHConfigDirEnvVar); dir != "" {
+		return &GHCLIAuth{Path: filepath.Join(dir, GHHostsFilename)}, nil
+	}
+
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return &GHCLIAuth{Path: filepath.Join(dir, "gh", GHHostsFilename)}, nil
+	}
+
+	curUser, err := user.Current()
+	if err != nil {
+		return nil, err
+	}
+
+	return &GHCLIAuth{
+		Path: filepath.Join(curUser.HomeDir, ".config", "gh", GHHostsFilename),
+	}, nil
+}
+
+// GetUsernamePassword retrieves credentials for the given host from the gh
+// CLI configuration. gh keys hosts by their web hostname, so API hosts such
+// as api.github.com are looked up as github.com.
+func (a *GHCLIAuth) GetUsernamePassword(host string) (string, string, error) {
+	contents, err := ioutil.ReadFile(a.Path)
+	if err != nil {
+		return "", "", err
+	}
+
+	hosts := map[string]ghHost{}
+	if err := yaml.Unmarshal(contents, &hosts); err != nil {
+		return "", "", fmt.Errorf("could not parse %s: %w", a.Path, err)
+	}
+
+	webHost := strings.TrimPrefix(host, "api.")
+	entry, ok := hosts[webHost]
+	if !ok {
+		return "", "", fmt.Errorf("no auth for %s configured", webHost)
+	}
+
+	if entry.OAuthToken == "" {
+		return "", "", fmt.Errorf(
+			"no token for %s in %s (it may be stored in the system keyring)",
+			webHost, a.Path,
+		)
+	}
+
+	return entry.User, entry.OAuthToken, nil
+}
+
+func (a *GHCLIAuth) String() string {
+	return fmt.Sprintf("gh CLI config %s", a.Path)
+}
+
+// Credentials are the username and password (token) resolved for a host,
+// along with a description of where they came from
+type Credentials struct {
+	Username string
+	Password string
+	Source   string
+}
+
+// Chain tries each of its providers in order and uses the first one that
+// yields credentials for the requested host
+type Chain struct {
+	Providers []Interface
+}
+
+// NewChain creates a new provider chain
+func NewChain(providers ...Interface) *Chain {
+	return &Chain{Providers: providers}
+}
+
+// NewDefaultChain creates the default provider chain: $GITHUB_TOKEN and
+// $GH_TOKEN for github.com, $GH_ENTERPRISE_TOKEN and $GITHUB_ENTERPRISE_TOKEN
+// for other hosts, the given token file (if any), the gh CLI configuration and
+// finally ~/.netrc. Providers whose location cannot be determined are left out.
+func NewDefaultChain(tokenFile string) *Chain {
+	providers := []Interface{
+		NewScopedEnv(GitHubTokenEnvVar, GitHubDotCom),
+		NewScopedEnv(GHTokenEnvVar, GitHubDotCom),
+		NewScopedEnv(GHEnterpriseTokenEnvVar, EnterpriseHosts),
+		NewScopedEnv(GitHubEnterpriseTokenEnvVar, EnterpriseHosts),
+	}
+
+	if tokenFile != "" {
+		providers = append(providers, NewTokenFile(tokenFile))
+	}
+
+	if gh, err := NewGHCLI(); err == nil {
+		providers = append(providers, gh)
+	}
+
+	if netrcAuth, err := OpenNetrc(); err == nil {
+		providers = append(providers, netrcAuth)
+	}
+
+	return NewChain(providers...)
+}
+
+// Writer returns the first provider in the chain that can store credentials
+func (c *Chain) Writer() (Writer, error) {
+	for _, p := range c.Providers {
+		if w, ok := p.(Writer); ok {
+			return w, nil
+		}
+	}
+
+	return nil, errors.New("no credential provider in the chain can store credentials")
+}
+
+// Resolve returns the credentials supplied by the first provider that has
+// them for the given host. If none do, the returned error explains why each
+// provider was passed over.
+func (c *Chain) Resolve(host string) (*Credentials, error) {
+	if len(c.Providers) == 0 {
+		return nil, errors.New("no credential providers configured")
+	}
+
+	reasons := []string{}
+	for _, p := range c.Providers {
+		username, password, err := p.GetUsernamePassword(host)
+		if err == nil {
+			return &Credentials{
+				Username: username,
+				Password: password,
+				Source:   Describe(p),
+			}, nil
+		}
+
+		reasons = append(reasons, fmt.Sprintf("%s: %v", Describe(p), err))
+	}
+
+	return nil, fmt.Errorf(
+		"no credentials found for %s (tried %s)", host, strings.Join(reasons, "; "),
+	)
+}
+
+// GetUsernamePassword satisfies Interface for Chain
+func (c *Chain) GetUsernamePassword(host string) (string, string, error) {
+	creds, err := c.Resolve(host)
+	if err != nil {
+		return "", "", err
+	}
+
+	return creds.Username, creds.Password, nil
+}
+
+// Describe returns a human-readable name for a provider
+func Describe(p Interface) string {
+	if s, ok := p.(fmt.Stringer); ok {
+		return s.String()
+	}
+
+	return fmt.Sprintf("%T", p)
+}
+
+// Compile-time interface satisfaction checks
+var (
+	_ Interface = (*EnvAuth)(nil)
+	_ Interface = (*TokenFileAuth)(nil)
+	_ Writer    = (*TokenFileAuth)(nil)
+	_ Interface = (*GHCLIAuth)(nil)
+	_ Interface = (*Chain)(nil)
+)
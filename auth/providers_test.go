@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// GHHosts is a valid gh CLI hosts.yml file
+var GHHosts = `
+github.com:
+    user: ghuser
+    oauth_token: ghsecret
+    git_protocol: ssh
+`
+
+func TestEnvAuth(t *testing.T) {
+	os.Setenv("STARS_TEST_TOKEN", " envsecret\n")
+	defer os.Unsetenv("STARS_TEST_TOKEN")
+
+	user, pass, err := NewEnv("STARS_TEST_TOKEN").GetUsernamePassword("api.github.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "", user)
+	assert.Equal(t, "envsecret", pass)
+
+	_, _, err = NewEnv("STARS_TEST_UNSET_TOKEN").GetUsernamePassword("api.github.com")
+	assert.Error(t, err)
+
+	// Scoped tokens are only sent to the hosts they are meant for
+	dotCom := NewScopedEnv("STARS_TEST_TOKEN", GitHubDotCom)
+	_, pass, err = dotCom.GetUsernamePassword("github.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "envsecret", pass)
+
+	_, _, err = dotCom.GetUsernamePassword("api.github.example.com")
+	assert.EqualError(t, err, "$STARS_TEST_TOKEN is only used for github.com")
+
+	enterprise := NewScopedEnv("STARS_TEST_TOKEN", EnterpriseHosts)
+	_, pass, err = enterprise.GetUsernamePassword("github.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "envsecret", pass)
+
+	_, _, err = enterprise.GetUsernamePassword("api.github.com")
+	assert.EqualError(t, err, "$STARS_TEST_TOKEN is not used for github.com")
+}
+
+func TestDefaultChainEnterpriseHost(t *testing.T) {
+	for _, envVar := range []string{
+		GitHubTokenEnvVar, GHTokenEnvVar, GHEnterpriseTokenEnvVar, GitHubEnterpriseTokenEnvVar,
+	} {
+		defer os.Setenv(envVar, os.Getenv(envVar))
+		os.Unsetenv(envVar)
+	}
+
+	os.Setenv(GitHubTokenEnvVar, "dotcomsecret")
+	os.Setenv(GHTokenEnvVar, "dotcomsecret")
+
+	creds, err := NewDefaultChain("").Resolve("api.github.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "dotcomsecret", creds.Password)
+
+	// No provider hands the github.com token to a GHES host
+	for _, p := range NewDefaultChain("").Providers {
+		_, pass, _ := p.GetUsernamePassword("github.example.com")
+		assert.NotEqual(t, "dotcomsecret", pass, Describe(p))
+	}
+
+	os.Setenv(GHEnterpriseTokenEnvVar, "enterprisesecret")
+
+	creds, err = NewDefaultChain("").Resolve("github.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "enterprisesecret", creds.Password)
+	assert.Equal(t, "$GH_ENTERPRISE_TOKEN environment variable", creds.Source)
+}
+
+func TestTokenFileAuth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stars-auth")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	tokenFile := filepath.Join(dir, "token")
+	assert.NoError(t, ioutil.WriteFile(tokenFile, []byte("filesecret\n"), 0600))
+
+	_, pass, err := NewTokenFile(tokenFile).GetUsernamePassword("api.github.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "filesecret", pass)
+
+	_, _, err = NewTokenFile(filepath.Join(dir, "missing")).GetUsernamePassword("api.github.com")
+	assert.Error(t, err)
+
+	written := NewTokenFile(filepath.Join(dir, "sub", "token"))
+	assert.NoError(t, written.SetUsernamePassword("api.github.com", "user", "newsecret"))
+
+	_, pass, err = written.GetUsernamePassword("api.github.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "newsecret", pass)
+
+	assert.NoError(t, written.DeleteUsernamePassword("api.github.com"))
+	assert.ErrorIs(t, written.DeleteUsernamePassword("api.github.com"), ErrNoCredentials)
+
+	_, _, err = written.GetUsernamePassword("api.github.com")
+	assert.Error(t, err)
+}
+
+func TestGHCLIAuth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stars-auth")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	os.Setenv(GHConfigDirEnvVar, dir)
+	defer os.Unsetenv(GHConfigDirEnvVar)
+
+	assert.NoError(t, ioutil.WriteFile(
+		filepath.Join(dir, GHHostsFilename), []byte(GHHosts), 0600,
+	))
+
+	gh, err := NewGHCLI()
+	assert.NoError(t, err)
+
+	user, pass, err := gh.GetUsernamePassword("api.github.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "ghuser", user)
+	assert.Equal(t, "ghsecret", pass)
+
+	_, _, err = gh.GetUsernamePassword("ghe.example.com")
+	assert.Error(t, err)
+}
+
+func TestChainResolve(t *testing.T) {
+	os.Setenv("STARS_TEST_TOKEN", "envsecret")
+	defer os.Unsetenv("STARS_TEST_TOKEN")
+
+	chain := NewChain(
+		NewEnv("STARS_TEST_UNSET_TOKEN"),
+		NewEnv("STARS_TEST_TOKEN"),
+		NewTokenFile("/nonexistent/token"),
+	)
+
+	creds, err := chain.Resolve("api.github.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "envsecret", creds.Password)
+	assert.Equal(t, "$STARS_TEST_TOKEN environment variable", creds.Source)
+
+	_, err = NewChain(NewEnv("STARS_TEST_UNSET_TOKEN")).Resolve("api.github.com")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "$STARS_TEST_UNSET_TOKEN")
+
+	writer, err := chain.Writer()
+	assert.NoError(t, err)
+	assert.Equal(t, chain.Providers[2], writer)
+
+	_, err = NewChain(NewEnv("STARS_TEST_TOKEN")).Writer()
+	assert.Error(t, err)
+}
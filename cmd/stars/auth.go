@@ -0,0 +1,224 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gkze/gh-stars/auth"
+	"github.com/gkze/gh-stars/starmanager"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// clientIDEnvVar is the environment variable holding the default OAuth app
+	// client ID used by `stars auth login`
+	clientIDEnvVar = "STARS_CLIENT_ID"
+
+	// loginScopes are the OAuth scopes requested by `stars auth login`
+	loginScopes = "public_repo,read:user"
+)
+
+func mkAuthStatusCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Show authentication status",
+		Long:  "Validates the token in use and displays who it belongs to, its scopes and its expiry",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			info, err := sm.TokenInfo(cmdContext)
+			if err != nil {
+				return err
+			}
+
+			scopes := "(not reported)"
+			if info.ScopesKnown {
+				scopes = strings.Join(info.Scopes, ", ")
+			}
+
+			expiration := "never"
+			if !info.Expiration.IsZero() {
+				expiration = info.Expiration.Format(time.RFC3339)
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 2, 2, ' ', 0)
+			fmt.Fprintf(w, "Host:\t%s\n", sm.Host())
+			fmt.Fprintf(w, "Source:\t%s\n", info.Source)
+			fmt.Fprintf(w, "Login:\t%s\n", info.Login)
+			if info.ConfiguredLogin != "" {
+				fmt.Fprintf(w, "Configured login:\t%s\n", info.ConfiguredLogin)
+			}
+			fmt.Fprintf(w, "Scopes:\t%s\n", scopes)
+			fmt.Fprintf(w, "Expires:\t%s\n", expiration)
+			fmt.Fprintf(w, "Can star/unstar:\t%t\n", info.CanStar())
+			if err := w.Flush(); err != nil {
+				return err
+			}
+
+			if !info.LoginMatches() {
+				return fmt.Errorf(
+					"token belongs to %s, but %s is configured",
+					info.Login, info.ConfiguredLogin,
+				)
+			}
+
+			return nil
+		},
+	}
+}
+
+func mkAuthLoginCmd() *cobra.Command {
+	var (
+		clientID string
+		authURL  string
+		scopes   string
+	)
+
+	authLoginCmd := &cobra.Command{
+		Use:         "login",
+		Short:       "Log in to GitHub",
+		Long:        "Obtains a token through the OAuth device flow and stores it in the active credential provider",
+		Annotations: map[string]string{skipInitAnnotation: ""},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if clientID == "" {
+				return fmt.Errorf(
+					"an OAuth app client ID is required (--client-id or $%s)",
+					clientIDEnvVar,
+				)
+			}
+
+			cfg, _, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			settings, err := resolveProfile(cfg, profile, host)
+			if err != nil {
+				return err
+			}
+
+			writer, err := settings.chain.Writer()
+			if err != nil {
+				return err
+			}
+
+			if authURL == "" {
+				authURL = "https://" + settings.host
+			}
+
+			flow := auth.NewDeviceFlow(authURL, clientID, strings.Split(scopes, ",")...)
+
+			code, err := flow.RequestCode(cmdContext)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Open %s and enter the code %s\n", code.VerificationURI, code.UserCode)
+
+			token, err := flow.PollToken(cmdContext, code)
+			if err != nil {
+				return err
+			}
+
+			// Look up who the token belongs to, so that the stored login matches.
+			// Nothing is cached, so the profile's cache is left alone.
+			mem := auth.NewMemory()
+			mem.Set(starmanager.APIHost(settings.host), "", token)
+
+			tokenSM, err := starmanager.NewWithOptions(
+				starmanager.WithAuth(mem),
+				starmanager.WithStore(starmanager.NewMemoryStore()),
+				starmanager.WithHost(settings.host),
+			)
+			if err != nil {
+				return err
+			}
+			defer tokenSM.Close()
+
+			info, err := tokenSM.Validate(cmdContext)
+			if err != nil {
+				return err
+			}
+
+			if err := writer.SetUsernamePassword(
+				starmanager.APIHost(settings.host), info.Login, token,
+			); err != nil {
+				return err
+			}
+
+			fmt.Printf("Logged in to %s as %s, token stored in %s\n",
+				settings.host, info.Login, auth.Describe(writer),
+			)
+			return nil
+		},
+	}
+
+	authLoginCmd.PersistentFlags().StringVar(
+		&clientID, "client-id", os.Getenv(clientIDEnvVar), "OAuth app client ID",
+	)
+	authLoginCmd.PersistentFlags().StringVar(
+		&authURL, "auth-url", "", "Base URL of the OAuth endpoints (default https://<host>)",
+	)
+	authLoginCmd.PersistentFlags().StringVar(
+		&scopes, "scopes", loginScopes, "Comma-separated OAuth scopes to request",
+	)
+
+	return authLoginCmd
+}
+
+func mkAuthLogoutCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:         "logout",
+		Short:       "Log out of GitHub",
+		Long:        "Removes the stored token from the active credential provider",
+		Annotations: map[string]string{skipInitAnnotation: ""},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, _, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			settings, err := resolveProfile(cfg, profile, host)
+			if err != nil {
+				return err
+			}
+
+			writer, err := settings.chain.Writer()
+			if err != nil {
+				return err
+			}
+
+			apiHost := starmanager.APIHost(settings.host)
+			if err := writer.DeleteUsernamePassword(apiHost); err != nil {
+				if errors.Is(err, auth.ErrNoCredentials) {
+					return fmt.Errorf("not logged in to %s", settings.host)
+				}
+
+				return err
+			}
+
+			log.Infof("Removed credentials for %s from %s\n",
+				apiHost, auth.Describe(writer),
+			)
+			return nil
+		},
+	}
+}
+
+func mkAuthCmd() *cobra.Command {
+	authCmd := &cobra.Command{
+		Use:   "auth",
+		Short: "Manage authentication",
+		Long:  "Log in and out of GitHub, and inspect the credentials in use",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cmd.Help()
+		},
+	}
+
+	authCmd.AddCommand(mkAuthStatusCmd(), mkAuthLoginCmd(), mkAuthLogoutCmd())
+
+	return authCmd
+}
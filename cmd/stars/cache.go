@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gkze/gh-stars/starmanager"
+	"github.com/spf13/cobra"
+)
+
+func mkCacheInfoCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "info",
+		Short: "Show cache information",
+		Long: `Displays the location, size, record count, schema version and last sync time of
+the local cache. The location comes from --cache-path, $STARS_CACHE,
+$XDG_CACHE_HOME or ~/.cache, whichever is set first; "Path from" says which.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			info, err := sm.CacheInfo()
+			if err != nil {
+				return err
+			}
+
+			lastSync := "never"
+			if !info.LastSync.IsZero() {
+				lastSync = info.LastSync.Local().Format(time.RFC3339)
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 2, 2, ' ', 0)
+			fmt.Fprintf(w, "Path:\t%s\n", info.Path)
+			fmt.Fprintf(w, "Path from:\t%s\n", cacheSource)
+			fmt.Fprintf(w, "Size:\t%d bytes\n", info.Size)
+			fmt.Fprintf(w, "Stars:\t%d\n", info.Count)
+			fmt.Fprintf(w, "Schema version:\t%d\n", info.SchemaVersion)
+			fmt.Fprintf(w, "Last sync:\t%s\n", lastSync)
+
+			return w.Flush()
+		},
+	}
+}
+
+func mkCacheMigrateCmd() *cobra.Command {
+	var dryRun bool
+
+	cacheMigrateCmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Upgrade the cache schema",
+		Long: `Applies pending schema migrations to the local cache. Caches are upgraded
+automatically when opened; use --dry-run to see what would change first.`,
+		Annotations: map[string]string{skipMigrationsAnnotation: ""},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			report, err := starmanager.Migrate(sm.Store(), dryRun)
+			if err != nil {
+				return err
+			}
+
+			if len(report.Steps) == 0 {
+				fmt.Printf("Cache is up to date (schema version %d)\n", report.From)
+				return nil
+			}
+
+			verb := "Migrated"
+			if dryRun {
+				verb = "Would migrate"
+			}
+
+			fmt.Printf(
+				"%s cache from schema version %d to %d\n", verb, report.From, report.To,
+			)
+
+			for _, step := range report.Steps {
+				fmt.Printf(
+					"  %d: %s (%d stars)\n",
+					step.Version, step.Description, len(step.Changed),
+				)
+
+				for _, url := range step.Changed {
+					fmt.Printf("    %s\n", url)
+				}
+			}
+
+			return nil
+		},
+	}
+
+	cacheMigrateCmd.PersistentFlags().BoolVarP(
+		&dryRun, "dry-run", "n", false, "Report what would change without writing anything",
+	)
+
+	return cacheMigrateCmd
+}
+
+func mkCacheCmd() *cobra.Command {
+	cacheCmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Manage the local cache",
+		Long:  "Inspect and maintain the local database holding fetched stars",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cmd.Help()
+		},
+	}
+
+	cacheCmd.AddCommand(mkCacheInfoCmd(), mkCacheMigrateCmd())
+
+	return cacheCmd
+}
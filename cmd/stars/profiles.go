@@ -0,0 +1,244 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/gkze/gh-stars/config"
+	"github.com/gkze/gh-stars/starmanager"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func mkProfilesListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List profiles",
+		Long:  "Displays all configured account profiles",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, _, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 2, 2, ' ', 0)
+			fmt.Fprintf(w, "NAME\tHOST\tTOKEN FILE\tBACKEND\tDEFAULT\n")
+
+			for _, name := range cfg.ProfileNames() {
+				prof := cfg.Profiles[name]
+				isDefault := ""
+				if name == cfg.DefaultProfile {
+					isDefault = "*"
+				}
+
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+					name, prof.Host, prof.TokenFile, prof.Backend, isDefault,
+				)
+			}
+
+			return w.Flush()
+		},
+	}
+}
+
+func mkProfilesAddCmd() *cobra.Command {
+	var makeDefault bool
+
+	profilesAddCmd := &cobra.Command{
+		Use:   "add NAME",
+		Short: "Add a profile",
+		Long: `Adds an account profile using the given --host, --token-file and --backend.
+Every profile needs a token file of its own, which stars auth login --profile
+NAME can fill in.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, cfgPath, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			// Without a token file of its own, a profile would use the same
+			// credentials as every other one
+			if tokenFile == "" {
+				return errors.New("profiles need their own credentials, pass --token-file")
+			}
+
+			profTokenFile, err := filepath.Abs(tokenFile)
+			if err != nil {
+				return err
+			}
+
+			for _, name := range cfg.ProfileNames() {
+				if cfg.Profiles[name].TokenFile == profTokenFile {
+					return fmt.Errorf("profile %s already uses the token file %s", name, profTokenFile)
+				}
+			}
+
+			if err := cfg.AddProfile(args[0], &config.Profile{
+				Host:      host,
+				TokenFile: profTokenFile,
+				Backend:   backend,
+			}); err != nil {
+				return err
+			}
+
+			if makeDefault {
+				cfg.DefaultProfile = args[0]
+			}
+
+			log.Infof("Adding profile %s to %s\n", args[0], cfgPath)
+			return cfg.Save(cfgPath)
+		},
+	}
+
+	profilesAddCmd.PersistentFlags().BoolVarP(
+		&makeDefault, "default", "d", false, "Make this the default profile",
+	)
+
+	return profilesAddCmd
+}
+
+func mkProfilesRemoveCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "remove NAME",
+		Short: "Remove a profile",
+		Long:  "Removes an account profile from the configuration. Its cache is left in place.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, cfgPath, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			if err := cfg.RemoveProfile(args[0]); err != nil {
+				return err
+			}
+
+			log.Infof("Removing profile %s from %s\n", args[0], cfgPath)
+			return cfg.Save(cfgPath)
+		},
+	}
+}
+
+func mkProfilesDefaultCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "default NAME",
+		Short: "Set the default profile",
+		Long:  "Makes the given profile the one used when --profile is not passed",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, cfgPath, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			if _, err := cfg.Profile(args[0]); err != nil {
+				return err
+			}
+
+			cfg.DefaultProfile = args[0]
+
+			return cfg.Save(cfgPath)
+		},
+	}
+}
+
+func mkProfilesCopyCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "copy FROM TO",
+		Short: "Copy stars between profiles",
+		Long:  "Stars every repository starred by the FROM profile using the TO profile",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if args[0] == args[1] {
+				return errors.New("cannot copy stars from a profile to itself")
+			}
+
+			cfg, _, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			// Opening the same cache twice would block on its file lock, and
+			// copying between profiles with the same credentials does nothing
+			cacheFiles, tokens := []string{}, []string{}
+			for _, name := range args {
+				settings, err := resolveProfile(cfg, name, "")
+				if err != nil {
+					return err
+				}
+
+				cacheFiles = append(cacheFiles, settings.cacheFile)
+
+				creds, err := settings.chain.Resolve(starmanager.APIHost(settings.host))
+				if err != nil {
+					return err
+				}
+				tokens = append(tokens, creds.Password)
+			}
+
+			if cacheFiles[0] == cacheFiles[1] {
+				return fmt.Errorf(
+					"profiles %s and %s share the cache %s", args[0], args[1], cacheFiles[0],
+				)
+			}
+
+			if tokens[0] == tokens[1] {
+				return fmt.Errorf("profiles %s and %s use the same credentials", args[0], args[1])
+			}
+
+			src, err := newStarManager(cfg, args[0], "")
+			if err != nil {
+				return err
+			}
+			defer src.Close()
+
+			dst, err := newStarManager(cfg, args[1], "")
+			if err != nil {
+				return err
+			}
+			defer dst.Close()
+
+			if err := dst.RequireStarScope(cmdContext); err != nil {
+				return err
+			}
+
+			if err := src.SaveIfEmpty(cmdContext, concurrency); err != nil {
+				return err
+			}
+
+			count, err := dst.CopyStarsFrom(cmdContext, src, concurrency)
+			if err != nil {
+				return err
+			}
+
+			log.Infof("Copied %d stars from %s to %s\n", count, args[0], args[1])
+			return nil
+		},
+	}
+}
+
+func mkProfilesCmd() *cobra.Command {
+	profilesCmd := &cobra.Command{
+		Use:         "profiles",
+		Short:       "Manage account profiles",
+		Long:        "List, add and remove named account profiles, each with its own credentials and cache",
+		Annotations: map[string]string{skipInitAnnotation: ""},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cmd.Help()
+		},
+	}
+
+	profilesCmd.AddCommand(
+		mkProfilesListCmd(),
+		mkProfilesAddCmd(),
+		mkProfilesRemoveCmd(),
+		mkProfilesDefaultCmd(),
+		mkProfilesCopyCmd(),
+	)
+
+	return profilesCmd
+}
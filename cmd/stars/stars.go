@@ -1,22 +1,34 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"text/tabwriter"
+	"text/template"
 	"time"
 
-	"github.com/gkze/stars/starmanager"
-	"github.com/gkze/stars/utils"
+	"github.com/dustin/go-humanize"
+	"github.com/gkze/gh-stars/auth"
+	"github.com/gkze/gh-stars/config"
+	"github.com/gkze/gh-stars/output"
+	"github.com/gkze/gh-stars/search"
+	"github.com/gkze/gh-stars/starmanager"
+	"github.com/gkze/gh-stars/utils"
 	"github.com/pkg/browser"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"go.uber.org/multierr"
 	"golang.org/x/crypto/ssh/terminal"
 )
 
@@ -31,6 +43,38 @@ var (
 	// global log level
 	logLevel string
 
+	// tokenFile is an optional file holding a GitHub token
+	tokenFile string
+
+	// host is the GitHub web host to talk to (overrides the config file)
+	host string
+
+	// profile is the name of the account profile to use
+	profile string
+
+	// backend is the storage backend to use (overrides the config file)
+	backend string
+
+	// cachePath is the path to the cache (overrides the default location)
+	cachePath string
+
+	// cacheSource is where the path to the cache of sm came from
+	cacheSource string
+
+	// skipMigrations leaves the cache schema untouched when opening it
+	skipMigrations bool
+
+	// timeout limits how long a command may run
+	timeout time.Duration
+
+	// cmdContext is cancelled when stars is interrupted (e.g. with Ctrl-C) or
+	// terminated, or when the timeout elapses, which stops any GitHub API
+	// requests in flight
+	cmdContext = context.Background()
+
+	// cancelTimeout releases the timer of the timeout
+	cancelTimeout context.CancelFunc = func() {}
+
 	// StarManager object
 	sm *starmanager.StarManager
 
@@ -38,11 +82,271 @@ var (
 	starsCmd *cobra.Command
 )
 
+const (
+	// skipInitAnnotation marks commands that do not need a StarManager (and
+	// therefore credentials) to run
+	skipInitAnnotation = "skip-init"
+
+	// skipMigrationsAnnotation marks commands that must see the cache at its
+	// current schema version, rather than having it upgraded on open
+	skipMigrationsAnnotation = "skip-migrations"
+
+	// validateAnnotation marks commands that validate the token on startup.
+	// Its value is one of validateIdentity or validateStarScope.
+	validateAnnotation = "validate"
+
+	// validateIdentity checks that the token is valid and belongs to the
+	// configured user
+	validateIdentity = "identity"
+
+	// validateStarScope additionally checks that the token may star and unstar
+	// repositories
+	validateStarScope = "star-scope"
+)
+
+func initStarManager(cmd *cobra.Command, args []string) error {
+	lvl, err := log.ParseLevel(logLevel)
+	if err != nil {
+		return fmt.Errorf("error parsing log level: %w", err)
+	}
+
+	log.Tracef("Setting log level to %+v\n", lvl)
+	log.SetLevel(lvl)
+
+	if timeout > 0 {
+		cmdContext, cancelTimeout = context.WithTimeout(cmdContext, timeout)
+	}
+
+	if cmd == cmd.Root() {
+		return nil
+	}
+
+	for c := cmd; c != nil; c = c.Parent() {
+		if _, ok := c.Annotations[skipInitAnnotation]; ok {
+			return nil
+		}
+	}
+
+	cfg, _, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	_, skipMigrations = cmd.Annotations[skipMigrationsAnnotation]
+
+	settings, err := resolveProfile(cfg, profile, host)
+	if err != nil {
+		return fmt.Errorf("error creating StarManager: %w", err)
+	}
+
+	cacheSource = settings.cacheSource
+
+	sm, err = openStarManager(settings)
+	if err != nil {
+		return fmt.Errorf("error creating StarManager: %w", err)
+	}
+
+	switch cmd.Annotations[validateAnnotation] {
+	case validateIdentity:
+		_, err = sm.Validate(cmdContext)
+	case validateStarScope:
+		err = sm.RequireStarScope(cmdContext)
+	}
+
+	return err
+}
+
+// loadConfig reads the stars configuration file, returning it along with its
+// path
+func loadConfig() (*config.Config, string, error) {
+	cfgPath, err := config.DefaultPath()
+	if err != nil {
+		return nil, "", err
+	}
+
+	cfg, err := config.Load(cfgPath)
+	if err != nil {
+		return nil, "", fmt.Errorf("error loading config from %s: %w", cfgPath, err)
+	}
+
+	return cfg, cfgPath, nil
+}
+
+// profileSettings are the settings in effect for a profile
+type profileSettings struct {
+	// name is the name of the profile, empty if no profile is in use
+	name string
+
+	// host is the GitHub web host
+	host string
+
+	// backend is the storage backend of the cache
+	backend string
+
+	// cacheFile is the path to the cache
+	cacheFile string
+
+	// cacheSource is where the path to the cache came from, e.g. --cache-path
+	// or $STARS_CACHE
+	cacheSource string
+
+	// chain is the credential provider chain for the profile
+	chain *auth.Chain
+}
+
+// resolveProfile works out the settings for the named profile (or the default
+// profile if the name is empty). hostOverride takes precedence over the host
+// configured for the profile and at the top level of the config file, and
+// --cache-path takes precedence over the default cache location.
+func resolveProfile(
+	cfg *config.Config, profileName, hostOverride string,
+) (*profileSettings, error) {
+	prof, err := cfg.Profile(profileName)
+	if err != nil {
+		return nil, err
+	}
+
+	if profileName == "" && prof != nil {
+		profileName = cfg.DefaultProfile
+	}
+
+	smHost := hostOverride
+	if smHost == "" && prof != nil {
+		smHost = prof.Host
+	}
+	if smHost == "" {
+		smHost = cfg.Host
+	}
+	if smHost == "" {
+		smHost = starmanager.GitHubHost
+	}
+
+	smBackend := backend
+	if smBackend == "" && prof != nil {
+		smBackend = prof.Backend
+	}
+	if smBackend == "" {
+		smBackend = cfg.Backend
+	}
+
+	smCacheFile, smCacheSource := cachePath, "--cache-path"
+	if smCacheFile == "" {
+		smCacheFile, smCacheSource, err = starmanager.ResolveCachePath(
+			smHost, profileName, smBackend,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	chain := auth.NewDefaultChain(tokenFile)
+	switch {
+	case prof != nil && prof.TokenFile != "":
+		// The default credentials are shared by every profile, so a profile
+		// only uses its own token file (or --token-file)
+		chain = auth.NewChain(auth.NewTokenFile(prof.TokenFile))
+		if tokenFile != "" {
+			chain.Providers = append(
+				[]auth.Interface{auth.NewTokenFile(tokenFile)}, chain.Providers...,
+			)
+		}
+	case prof != nil:
+		log.Warnf(
+			"Profile %s has no token_file, so it uses the same credentials as running "+
+				"stars without a profile\n", profileName,
+		)
+	}
+
+	return &profileSettings{
+		name:        profileName,
+		host:        smHost,
+		backend:     smBackend,
+		cacheFile:   smCacheFile,
+		cacheSource: smCacheSource,
+		chain:       chain,
+	}, nil
+}
+
+// newStarManager creates a StarManager for the named profile (or the default
+// profile if the name is empty), see resolveProfile
+func newStarManager(
+	cfg *config.Config, profileName, hostOverride string,
+) (*starmanager.StarManager, error) {
+	settings, err := resolveProfile(cfg, profileName, hostOverride)
+	if err != nil {
+		return nil, err
+	}
+
+	return openStarManager(settings)
+}
+
+// openStarManager creates a StarManager with the settings of a profile
+func openStarManager(settings *profileSettings) (*starmanager.StarManager, error) {
+	if settings.name != "" {
+		log.Debugf("Using profile %s\n", settings.name)
+	}
+
+	return starmanager.NewWithConfig(&starmanager.Config{
+		Host:           settings.host,
+		Auth:           settings.chain,
+		Profile:        settings.name,
+		Backend:        settings.backend,
+		CacheFile:      settings.cacheFile,
+		SkipMigrations: skipMigrations,
+	})
+}
+
+func closeStarManager(cmd *cobra.Command, args []string) error {
+	if sm == nil {
+		return nil
+	}
+
+	// Commands that fail skip post-run hooks, so main closes the cache as
+	// well. It must only be closed once.
+	err := sm.Close()
+	sm = nil
+
+	return err
+}
+
+// logSaveErrors lists what went wrong when stars could not all be saved, ahead
+// of the summary
+func logSaveErrors(err error) {
+	saveErr := &starmanager.SaveError{}
+	if !errors.As(err, &saveErr) {
+		return
+	}
+
+	for _, e := range multierr.Errors(saveErr.Err) {
+		log.Error(e)
+	}
+
+	if len(saveErr.FailedPages) > 0 {
+		pages := make([]string, 0, len(saveErr.FailedPages))
+		for _, pageno := range saveErr.FailedPages {
+			pages = append(pages, strconv.Itoa(pageno))
+		}
+
+		log.Errorf("Pages not saved: %s", strings.Join(pages, ", "))
+	}
+}
+
+// logRequestStats reports how many GitHub API requests were answered from the
+// local cache
+func logRequestStats() {
+	hits, misses := sm.RequestStats()
+	log.Infof(
+		"GitHub API requests: %d unchanged (served from cache), %d fetched\n",
+		hits, misses,
+	)
+}
+
 func mkVersionCmd() *cobra.Command {
 	return &cobra.Command{
-		Use:   "version",
-		Short: "Show version of stars",
-		Long:  "Displays the version of the currently running stars CLI binary",
+		Use:         "version",
+		Short:       "Show version of stars",
+		Long:        "Displays the version of the currently running stars CLI binary",
+		Annotations: map[string]string{skipInitAnnotation: ""},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			fmt.Printf("stars version %s\n", Version)
 			return nil
@@ -51,14 +355,168 @@ func mkVersionCmd() *cobra.Command {
 }
 
 func mkSaveAllStarsCmd() *cobra.Command {
-	return &cobra.Command{
+	var (
+		resume  bool
+		readmes bool
+	)
+
+	saveCmd := &cobra.Command{
 		Use:   "save",
 		Short: "Save starred repositories",
-		Long:  "Fetches all of the current user's starred projects to the local filesystem",
+		Long: `Fetches all of the current user's starred projects to the local filesystem.
+The pages that were saved are recorded, so that if the save is interrupted or
+some pages fail, --resume only fetches the pages that were not saved (unless
+stars were starred or unstarred since, or the save is more than a day old).
+With --readmes, their READMEs are fetched too, so that search matches them.`,
+		Annotations: map[string]string{validateAnnotation: validateIdentity},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			defer logRequestStats()
+
+			save := sm.SaveAllStars
+			if resume {
+				save = sm.ResumeSaveAllStars
+			}
+
+			if err := save(cmdContext, concurrency); err != nil {
+				if checkpoint, _ := sm.SaveCheckpoint(); checkpoint != nil {
+					return fmt.Errorf(
+						"saved %d of %d pages, run stars save --resume to fetch the rest: %w",
+						len(checkpoint.Saved), checkpoint.Pages, err,
+					)
+				}
+
+				return err
+			}
+
+			if readmes {
+				return sm.SaveReadmes(cmdContext, concurrency)
+			}
+
+			return nil
+		},
+	}
+
+	saveCmd.PersistentFlags().BoolVarP(
+		&resume, "resume", "r", false, "Only fetch the pages an unfinished save did not save",
+	)
+	addReadmesFlag(saveCmd, &readmes)
+
+	return saveCmd
+}
+
+// addReadmesFlag adds the --readmes flag, fetching the READMEs of stars for
+// search, to cmd
+func addReadmesFlag(cmd *cobra.Command, readmes *bool) {
+	cmd.PersistentFlags().BoolVar(
+		readmes, "readmes", false,
+		"Also fetch the READMEs of stars (only new or updated ones) so that search matches them",
+	)
+}
+
+func mkSyncCmd() *cobra.Command {
+	var (
+		staleAfter time.Duration
+		maxRefresh int
+		full       bool
+		graphQL    bool
+		resume     bool
+		readmes    bool
+	)
+
+	syncCmd := &cobra.Command{
+		Use:   "sync",
+		Short: "Sync starred repositories",
+		Long: `Fetches repositories starred since the last sync, and refreshes the metadata
+of cached stars that have not been updated for a while, at most --max-refresh
+of them (least recently updated first) per sync. With --full, every star
+is fetched instead, and stars that were removed on GitHub are removed from the
+cache. With --graphql, stars are listed through the GraphQL API, which also
+returns their license, fork parent, latest release and open issue count.
+
+Syncs that fetch every star (with --full, or to fill an empty cache) record
+their progress after each page. If one is interrupted, e.g. by a network
+failure or Ctrl-C, --resume continues it where it stopped.
+
+With --readmes, the READMEs of new stars and of repositories pushed to since
+their README was fetched are fetched too, so that search matches them.`,
+		Annotations: map[string]string{validateAnnotation: validateIdentity},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return sm.SaveAllStars(concurrency)
+			defer logRequestStats()
+
+			opts := starmanager.SyncOptions{
+				StaleAfter:     staleAfter,
+				MaxRefresh:     maxRefresh,
+				MaxConcurrency: concurrency,
+				Full:           full,
+				Resume:         resume,
+			}
+			if graphQL {
+				opts.Fetcher = sm.GraphQLFetcher()
+			}
+
+			result, err := sm.Sync(cmdContext, opts)
+			if err != nil {
+				if checkpoint, _ := sm.SyncCheckpoint(); checkpoint != nil {
+					return fmt.Errorf(
+						"sync stopped after %d pages, run stars sync --resume to continue it: %w",
+						checkpoint.Pages, err,
+					)
+				}
+
+				return err
+			}
+
+			for _, change := range []struct {
+				marker string
+				urls   []string
+			}{
+				{"+", result.Added},
+				{"~", result.Updated},
+				{"-", result.Removed},
+			} {
+				for _, starURL := range change.urls {
+					fmt.Printf("%s %s\n", change.marker, starURL)
+				}
+			}
+
+			fmt.Printf(
+				"Added %d, updated %d, removed %d stars\n",
+				len(result.Added), len(result.Updated), len(result.Removed),
+			)
+
+			if readmes {
+				return sm.SaveReadmes(cmdContext, concurrency)
+			}
+
+			return nil
 		},
 	}
+
+	syncCmd.PersistentFlags().DurationVarP(
+		&staleAfter,
+		"stale-after",
+		"s",
+		starmanager.DefaultStaleAfter,
+		"Refresh stars whose metadata is older than this (0 disables refreshing)",
+	)
+	syncCmd.PersistentFlags().IntVar(
+		&maxRefresh,
+		"max-refresh",
+		starmanager.DefaultMaxRefresh,
+		"Refresh at most this many stale stars per sync (negative for no limit)",
+	)
+	syncCmd.PersistentFlags().BoolVarP(
+		&full, "full", "f", false, "Fetch every star and remove stars unstarred on GitHub",
+	)
+	syncCmd.PersistentFlags().BoolVarP(
+		&resume, "resume", "r", false, "Continue an interrupted sync where it stopped",
+	)
+	syncCmd.PersistentFlags().BoolVarP(
+		&graphQL, "graphql", "g", false, "List stars through the GraphQL API",
+	)
+	addReadmesFlag(syncCmd, &readmes)
+
+	return syncCmd
 }
 
 func mkAddStarsCmd() *cobra.Command {
@@ -71,9 +529,10 @@ func mkAddStarsCmd() *cobra.Command {
 	)
 
 	addStarsCmd := &cobra.Command{
-		Use:   "add",
-		Short: "Add (star) repositories",
-		Long:  "Star repositories, specified in various ways",
+		Use:         "add",
+		Short:       "Add (star) repositories",
+		Long:        "Star repositories, specified in various ways",
+		Annotations: map[string]string{validateAnnotation: validateStarScope},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			// Exactly one of the options must be passed
 			fromSpecifiedCount := 0
@@ -101,7 +560,7 @@ func mkAddStarsCmd() *cobra.Command {
 				}
 				log.Infof("Discovered %d URLs at %s\n", len(urls), fromURL)
 
-				ghUrls := utils.FilterGitHubURLs(urls, starmanager.GitHubHost)
+				ghUrls := utils.FilterGitHubURLs(urls, sm.Host())
 				log.Printf("Found %d GitHub URLs", len(ghUrls))
 
 				if len(ghUrls) == 0 {
@@ -110,17 +569,19 @@ func mkAddStarsCmd() *cobra.Command {
 				}
 
 				log.Infof("Starring %d GitHub repositories\n", len(ghUrls))
-				sm.StarRepositoriesFromURLs(ghUrls, addMonths, concurrency)
+				if _, err := sm.StarRepositoriesFromURLs(cmdContext, ghUrls, addMonths, concurrency); err != nil {
+					return err
+				}
 			}
 
 			if fromOrg != "" {
 				log.Infof("Attempting to repositories from %s\n", fromOrg)
-				return sm.StarRepositoriesFromOrg(fromOrg, addMonths, concurrency)
+				return sm.StarRepositoriesFromOrg(cmdContext, fromOrg, addMonths, concurrency)
 			}
 
 			if fromUser != "" {
 				log.Infof("Attempting to star repositories from %s\n", fromUser)
-				return sm.StarRepositoriesFromUser(fromUser, addMonths, concurrency)
+				return sm.StarRepositoriesFromUser(cmdContext, fromUser, addMonths, concurrency)
 			}
 
 			if fromList != "" {
@@ -138,7 +599,7 @@ func mkAddStarsCmd() *cobra.Command {
 					reader = file
 				}
 
-				_, err := sm.StarRepositoriesFromReader(reader, concurrency, addMonths)
+				_, err := sm.StarRepositoriesFromReader(cmdContext, reader, concurrency, addMonths)
 				return err
 			}
 
@@ -164,15 +625,26 @@ func mkAddStarsCmd() *cobra.Command {
 }
 
 func mkTopicsCmd() *cobra.Command {
-	return &cobra.Command{
+	var outputFormat string
+
+	topicsCmd := &cobra.Command{
 		Use:   "topics",
 		Short: "List all topics of all stars",
 		Long:  "Displays a list of topics, sorted by occurrece count, for all of a user's starred projects",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if err := sm.SaveIfEmpty(concurrency); err != nil {
+			format, err := output.ParseFormat(outputFormat)
+			if err != nil {
 				return err
 			}
 
+			if err := sm.SaveIfEmpty(cmdContext, concurrency); err != nil {
+				return err
+			}
+
+			if format != output.FormatTable {
+				return output.WriteTopics(os.Stdout, format, sm.GetTopics())
+			}
+
 			w := tabwriter.NewWriter(os.Stdout, 0, 2, 2, ' ', 0)
 			for i, pair := range sm.GetTopics() {
 				if i == 0 {
@@ -185,6 +657,10 @@ func mkTopicsCmd() *cobra.Command {
 			return w.Flush()
 		},
 	}
+
+	addOutputFlag(topicsCmd, &outputFormat)
+
+	return topicsCmd
 }
 
 func mkShowStarsCmd() *cobra.Command {
@@ -195,27 +671,95 @@ func mkShowStarsCmd() *cobra.Command {
 		random   bool
 		browse   bool
 		width    int
+
+		query        string
+		sortKeys     string
+		reverse      bool
+		outputFormat string
+		templateText string
+		templateFile string
 	)
 
 	showStarsCmd := &cobra.Command{
 		Use:   "show",
 		Short: "Show stars",
-		Long:  "Displays a tabulated list of stars given project filters",
+		Long: `Displays a tabulated list of stars given project filters. With --output, the
+stars are written in full in a format for other programs to read instead.
+
+With --query, only stars matching a query expression are shown, e.g.
+
+  stars show --query 'language:go,rust topic:cli stars:>500 pushed:>2024-01 -archived desc:~"parser"'
+
+Terms are field:value (any of several values with field:a,b), field:~text
+(contains), field:>value (also >=, < and <=), field:low..high, a bare flag
+field, or text found in the name, description or topics. Stars must match all
+terms; combine them with OR, negate them with - or NOT, and group them with
+parentheses. Dates are YYYY, YYYY-MM, YYYY-MM-DD or RFC 3339 timestamps. The
+fields are archived, desc, fork, issues, language, license, name, parent,
+pushed, release, size, starred, stars, synced, topic and url.
+
+Stars are sorted by stargazers, most first, unless --sort gives other keys:
+stars, starred and pushed sort the largest or newest first, and name and
+language alphabetically. Follow a key with :asc or :desc to change its
+direction, e.g. --sort language,stars:asc. Later keys order stars that are
+equal by the earlier ones. --reverse flips every key.
+
+With --template or --template-file, each star is written with a Go template
+(see https://pkg.go.dev/text/template) whose data is the star, e.g.
+
+  stars show --template '{{.URL}} {{.Stargazers}}'
+  stars show --template '* {{repo .URL}}: {{.Description | truncate 60}}'
+
+Besides the builtin functions, templates can use:
+
+  ago TIME          how long ago TIME was, e.g. "3 days ago"
+  date LAYOUT TIME  TIME formatted with a Go time layout, e.g. "2006-01-02"
+  truncate N S      S cut to N characters
+  join SEP LIST     the elements of LIST (e.g. .Topics) separated by SEP
+  repo URL          the owner/name of the repository at URL
+  comma N           N with thousands separated by commas`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if err := sm.SaveIfEmpty(concurrency); err != nil {
+			format, err := output.ParseFormat(outputFormat)
+			if err != nil {
 				return err
 			}
 
-			maxWidth, _, err := terminal.GetSize(0)
+			tmpl, err := loadTemplate(templateText, templateFile)
 			if err != nil {
 				return err
 			}
 
-			if width > 0 {
-				maxWidth = width
+			parsedQuery, err := starmanager.ParseQuery(query)
+			if err != nil {
+				return err
+			}
+
+			order, err := starmanager.ParseSortSpec(sortKeys)
+			if err != nil {
+				return err
+			}
+
+			if random {
+				if len(order) > 0 || reverse {
+					return errors.New("--random cannot be used with --sort or --reverse")
+				}
+
+				order = starmanager.RandomSort
+			} else if reverse {
+				order = order.Reverse()
 			}
 
-			stars, err := sm.GetStars(count, language, topic, random)
+			if tmpl != nil && format != output.FormatTable {
+				return errors.New("--output cannot be used with a template")
+			}
+
+			if err := sm.SaveIfEmpty(cmdContext, concurrency); err != nil {
+				return err
+			}
+
+			stars, err := sm.FindStars(count, starmanager.Filter{
+				Language: language, Topic: topic, Query: parsedQuery,
+			}, order)
 			if err != nil {
 				return err
 			}
@@ -235,6 +779,23 @@ func mkShowStarsCmd() *cobra.Command {
 				return nil
 			}
 
+			if tmpl != nil {
+				return output.WriteTemplate(os.Stdout, tmpl, stars)
+			}
+
+			if format != output.FormatTable {
+				return output.WriteStars(os.Stdout, format, stars)
+			}
+
+			maxWidth, _, err := terminal.GetSize(0)
+			if err != nil {
+				return err
+			}
+
+			if width > 0 {
+				maxWidth = width
+			}
+
 			linebuf := utils.NewBoundedLineBuf([]byte{}, maxWidth-1)
 			tw := tabwriter.NewWriter(linebuf, 0, 2, 2, ' ', 0)
 
@@ -309,21 +870,258 @@ func mkShowStarsCmd() *cobra.Command {
 	showStarsCmd.PersistentFlags().BoolVarP(
 		&random, "random", "r", false, "Randomize results",
 	)
+	showStarsCmd.PersistentFlags().StringVarP(
+		&query, "query", "q", "", "Limit to projects matching this query expression",
+	)
+	showStarsCmd.PersistentFlags().StringVarP(
+		&sortKeys, "sort", "s", "",
+		"Sort by these comma-separated keys (stars, starred, pushed, name, language), "+
+			"each optionally followed by :asc or :desc (default stars)",
+	)
+	showStarsCmd.PersistentFlags().BoolVar(
+		&reverse, "reverse", false, "Reverse the sort order",
+	)
 	showStarsCmd.PersistentFlags().BoolVarP(
 		&browse, "browse", "b", false, "Open stars in browser instead of writing them to stdout",
 	)
 	showStarsCmd.PersistentFlags().IntVarP(
 		&width, "width", "d", 0, "Maximum width (as descriptions can sometimes get lengthy)",
 	)
+	addOutputFlag(showStarsCmd, &outputFormat)
+	showStarsCmd.PersistentFlags().StringVar(
+		&templateText, "template", "", "Go template to write each star with",
+	)
+	showStarsCmd.PersistentFlags().StringVar(
+		&templateFile, "template-file", "", "File containing a Go template to write each star with",
+	)
 
 	return showStarsCmd
 }
 
+func mkSearchCmd() *cobra.Command {
+	var (
+		count        int
+		color        string
+		outputFormat string
+	)
+
+	searchCmd := &cobra.Command{
+		Use:   "search TERMS...",
+		Short: "Search stars",
+		Long: `Searches the names, descriptions, topics and READMEs of stars for any of the
+terms, showing the best matches first with the terms highlighted. Matches in
+names weigh the most, then topics, descriptions and READMEs. Case and plurals
+do not matter, e.g.
+
+  stars search yaml parser
+
+READMEs are only searched once fetched with stars sync --readmes (or stars
+save --readmes). The index searched is rebuilt whenever stars are saved or
+synced. With --output, the matching stars are written in full in a format for
+other programs to read instead, best first.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			format, err := output.ParseFormat(outputFormat)
+			if err != nil {
+				return err
+			}
+
+			highlight := false
+			switch color {
+			case "always":
+				highlight = true
+			case "auto":
+				highlight = terminal.IsTerminal(int(os.Stdout.Fd()))
+			case "never":
+			default:
+				return fmt.Errorf("unknown --color %q (must be auto, always or never)", color)
+			}
+
+			if err := sm.SaveIfEmpty(cmdContext, concurrency); err != nil {
+				return err
+			}
+
+			results, err := sm.Search(strings.Join(args, " "), count)
+			if err != nil {
+				return err
+			}
+
+			if len(results) == 0 {
+				return errors.New("No stars matching the search found")
+			}
+
+			if format != output.FormatTable {
+				stars := []*starmanager.Star{}
+				for _, result := range results {
+					stars = append(stars, result.Star)
+				}
+
+				return output.WriteStars(os.Stdout, format, stars)
+			}
+
+			return writeSearchResults(os.Stdout, results, highlight)
+		},
+	}
+
+	searchCmd.PersistentFlags().IntVarP(
+		&count, "count", "c", 10, "Number of stars to show",
+	)
+	searchCmd.PersistentFlags().StringVar(
+		&color, "color", "auto", "Highlight matches: auto (when writing to a terminal), always or never",
+	)
+	addOutputFlag(searchCmd, &outputFormat)
+
+	return searchCmd
+}
+
+// writeSearchResults writes search results for people to read: the name,
+// stargazers and language of each star, followed by its description, topics
+// and the part of its README that matched. Matches are highlighted in bold
+// yellow if highlight is set.
+func writeSearchResults(w io.Writer, results []*starmanager.SearchResult, highlight bool) error {
+	for i, result := range results {
+		mark := func(text string) string {
+			if !highlight {
+				return text
+			}
+
+			return search.Highlight(text, result.Terms, "\x1b[1;33m", "\x1b[0m")
+		}
+
+		star := result.Star
+		lines := []string{}
+
+		heading := mark(strings.TrimPrefix(star.URL, "https://github.com/")) +
+			"  ★ " + humanize.Comma(int64(star.Stargazers))
+		if star.Language != "" {
+			heading += "  " + star.Language
+		}
+		lines = append(lines, heading)
+
+		if star.Description != "" {
+			lines = append(lines, "    "+mark(star.Description))
+		}
+
+		if len(star.Topics) > 0 {
+			lines = append(lines, "    topics: "+mark(strings.Join(star.Topics, ", ")))
+		}
+
+		if utils.StringInSlice("readme", result.Fields) {
+			if snippet := search.Snippet(result.Readme, result.Terms, 80); snippet != "" {
+				lines = append(lines, "    readme: "+mark(snippet))
+			}
+		}
+
+		if i < len(results)-1 {
+			lines = append(lines, "")
+		}
+
+		if _, err := fmt.Fprintln(w, strings.Join(lines, "\n")); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// loadTemplate parses the template given with --template or --template-file,
+// or returns nil if there is none
+func loadTemplate(text, file string) (*template.Template, error) {
+	switch {
+	case text != "" && file != "":
+		return nil, errors.New("only one of --template and --template-file may be given")
+	case file != "":
+		contents, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("could not read template: %w", err)
+		}
+
+		return output.ParseTemplate(filepath.Base(file), string(contents))
+	case text != "":
+		return output.ParseTemplate("template", text)
+	default:
+		return nil, nil
+	}
+}
+
+// addOutputFlag adds the --output flag, choosing the format cmd writes its
+// results in, to cmd
+func addOutputFlag(cmd *cobra.Command, outputFormat *string) {
+	formats := []string{}
+	for _, format := range output.Formats {
+		formats = append(formats, string(format))
+	}
+
+	cmd.PersistentFlags().StringVar(
+		outputFormat, "output", string(output.FormatTable),
+		"Output format: "+strings.Join(formats, ", ")+" (see stars schema)",
+	)
+}
+
+func mkSchemaCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "schema [star|topic]",
+		Short: "Print the JSON Schema of structured output",
+		Long: `Prints the JSON Schema of the records written by show (star, the default) or
+topics (topic) when --output is not table`,
+		Args:        cobra.MaximumNArgs(1),
+		ValidArgs:   []string{"star", "topic"},
+		Annotations: map[string]string{skipInitAnnotation: ""},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := "star"
+			if len(args) > 0 {
+				name = args[0]
+			}
+
+			schema, ok := output.Schemas[name]
+			if !ok {
+				return fmt.Errorf("unknown record type %q (must be star or topic)", name)
+			}
+
+			_, err := fmt.Fprint(os.Stdout, schema)
+			return err
+		},
+	}
+}
+
+func mkSQLCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "sql QUERY",
+		Short: "Query stars with SQL",
+		Long: `Runs a single, read-only SQL statement against the local cache and displays
+the results. Requires the sqlite backend. The cache has two tables:
+
+  stars  (url, archived, description, language, pushed_at, stargazers, starred_at, synced_at,
+          license, parent, disk_usage, latest_release, open_issues)
+  topics (url, topic)`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := sm.SaveIfEmpty(cmdContext, concurrency); err != nil {
+				return err
+			}
+
+			columns, rows, err := sm.SQL(args[0])
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 2, 2, ' ', 0)
+			fmt.Fprintln(w, strings.ToUpper(strings.Join(columns, "\t")))
+
+			for _, row := range rows {
+				fmt.Fprintln(w, strings.Join(row, "\t"))
+			}
+
+			return w.Flush()
+		},
+	}
+}
+
 func mkClearCmd() *cobra.Command {
 	return &cobra.Command{
 		Use:   "clear",
 		Short: "Clear local stars cache",
-		Long:  "Wipe the file on the local filesystem containing the fetched results of all stars",
+		Long:  "Wipe the fetched results of all stars, and everything recorded about them, from the local cache",
 		RunE:  func(cmd *cobra.Command, args []string) error { return sm.ClearCache() },
 	}
 }
@@ -336,15 +1134,16 @@ func mkCleanupCmd() *cobra.Command {
 	)
 
 	cleanupCmd := &cobra.Command{
-		Use:   "cleanup",
-		Short: "Clean up old stars",
-		Long:  "Un-stars projects older than n months, optionally also unstarring archived projects",
+		Use:         "cleanup",
+		Short:       "Clean up old stars",
+		Long:        "Un-stars projects older than n months, optionally also unstarring archived projects",
+		Annotations: map[string]string{validateAnnotation: validateStarScope},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if err := sm.SaveIfEmpty(cleanupConcurrency); err != nil {
+			if err := sm.SaveIfEmpty(cmdContext, cleanupConcurrency); err != nil {
 				return err
 			}
 
-			return sm.Cleanup(cleanupMonths, includeArchived)
+			return sm.Cleanup(cmdContext, cleanupMonths, includeArchived, cleanupConcurrency)
 		},
 	}
 
@@ -363,9 +1162,10 @@ func mkCleanupCmd() *cobra.Command {
 
 func mkCompletionCmd() *cobra.Command {
 	completionCmd := &cobra.Command{
-		Use:   "completion",
-		Short: "Generate shell completion script",
-		Long:  "Outputs an autocompletion script to be sourced by a target shell",
+		Use:         "completion",
+		Short:       "Generate shell completion script",
+		Long:        "Outputs an autocompletion script to be sourced by a target shell",
+		Annotations: map[string]string{skipInitAnnotation: ""},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			fmt.Println(`Outputs autocompletion scripts for the CLI. Please refer
 to your shell's documentation on how to configure autocompletion.
@@ -403,12 +1203,17 @@ func main() {
 		Short: "Stars is a command-line GitHub Stars manager",
 		Long: `A CLI written in Golang to facilitate efficient management of a user's
 GitHub starred projects / repositories, a.k.a. "Stars"`,
-		RunE: func(cmd *cobra.Command, args []string) error { return cmd.Help() },
+		PersistentPreRunE:  initStarManager,
+		PersistentPostRunE: closeStarManager,
+		RunE:               func(cmd *cobra.Command, args []string) error { return cmd.Help() },
 	}
 
 	starsCmd.PersistentFlags().StringVarP(
 		&logLevel, "log-level", "o", "info", "Log level",
 	)
+	starsCmd.PersistentFlags().DurationVar(
+		&timeout, "timeout", 0, "Give up on commands that take longer than this (default no limit)",
+	)
 	starsCmd.PersistentFlags().IntVarP(
 		&concurrency,
 		"concurrency",
@@ -416,33 +1221,58 @@ GitHub starred projects / repositories, a.k.a. "Stars"`,
 		starmanager.DefaultConcurrency,
 		"Limit goroutines for network I/O operations",
 	)
-
-	lvl, err := log.ParseLevel(logLevel)
-	if err != nil {
-		log.Errorf("Error parsing log level: %+v", err)
-		os.Exit(1)
-	}
-
-	log.Tracef("Setting log level to %+v\n", lvl)
-	log.SetLevel(lvl)
-
-	sm, err = starmanager.New(lvl)
-	if err != nil {
-		log.Printf("Error creating StarManager! %v", err.Error())
-	}
+	starsCmd.PersistentFlags().StringVar(
+		&tokenFile, "token-file", "", "File containing a GitHub token",
+	)
+	starsCmd.PersistentFlags().StringVar(
+		&host, "host", "", "GitHub host, for GitHub Enterprise Server (default github.com)",
+	)
+	starsCmd.PersistentFlags().StringVarP(
+		&profile, "profile", "p", "", "Account profile to use (default from config)",
+	)
+	starsCmd.PersistentFlags().StringVar(
+		&cachePath, "cache-path", "", "Path to the cache (default in $STARS_CACHE or $XDG_CACHE_HOME)",
+	)
+	starsCmd.PersistentFlags().StringVar(
+		&backend, "backend", "", "Cache storage backend: storm or sqlite (default storm)",
+	)
 
 	starsCmd.AddCommand(
 		mkVersionCmd(),
 		mkSaveAllStarsCmd(),
+		mkSyncCmd(),
 		mkAddStarsCmd(),
 		mkTopicsCmd(),
 		mkShowStarsCmd(),
+		mkSearchCmd(),
 		mkClearCmd(),
 		mkCleanupCmd(),
 		mkCompletionCmd(),
+		mkProfilesCmd(),
+		mkAuthCmd(),
+		mkSQLCmd(),
+		mkSchemaCmd(),
+		mkCacheCmd(),
 	)
 
-	if err := starsCmd.Execute(); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	cmdContext = ctx
+
+	// A second interrupt kills stars right away
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	err := starsCmd.Execute()
+	cancelTimeout()
+	if closeErr := closeStarManager(starsCmd, nil); closeErr != nil {
+		log.Errorf("Could not close the cache: %v", closeErr)
+	}
+
+	if err != nil {
+		logSaveErrors(err)
 		log.Error(err)
 		os.Exit(1)
 	}
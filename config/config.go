@@ -0,0 +1,177 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// EnvVar is the environment variable that overrides the config file path
+	EnvVar string = "STARS_CONFIG"
+
+	// DirName is the name of the stars directory under the user config dir
+	DirName string = "stars"
+
+	// Filename is the default name of the configuration file
+	Filename string = "config.yml"
+)
+
+// Profile is a named GitHub account, with its own credentials and cache
+type Profile struct {
+	// Host is the GitHub web host of the account. Empty means the top-level
+	// host setting applies.
+	Host string `yaml:"host,omitempty"`
+
+	// TokenFile is a file holding the token for the account. It replaces all
+	// other credential sources, which are shared by every account.
+	TokenFile string `yaml:"token_file,omitempty"`
+
+	// Backend is the storage backend of the account's cache. Empty means the
+	// top-level backend setting applies.
+	Backend string `yaml:"backend,omitempty"`
+}
+
+// Config is the persistent stars CLI configuration
+type Config struct {
+	// Host is the GitHub web host to talk to. It is either github.com (the
+	// default) or the hostname of a GitHub Enterprise Server instance.
+	Host string `yaml:"host,omitempty"`
+
+	// Backend is the storage backend of the cache: storm (the default) or
+	// sqlite
+	Backend string `yaml:"backend,omitempty"`
+
+	// DefaultProfile is the profile used when none is selected explicitly
+	DefaultProfile string `yaml:"default_profile,omitempty"`
+
+	// Profiles are the configured account profiles, keyed by name
+	Profiles map[string]*Profile `yaml:"profiles,omitempty"`
+}
+
+// DefaultPath returns the location of the configuration file: $STARS_CONFIG,
+// then $XDG_CONFIG_HOME/stars/config.yml, then ~/.config/stars/config.yml
+func DefaultPath() (string, error) {
+	if path := os.Getenv(EnvVar); path != "" {
+		return path, nil
+	}
+
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, DirName, Filename), nil
+	}
+
+	curUser, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(curUser.HomeDir, ".config", DirName, Filename), nil
+}
+
+// Load reads the configuration file at path. A missing file is not an error
+// and yields an empty configuration.
+func Load(path string) (*Config, error) {
+	cfg := &Config{}
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cfg, nil
+		}
+
+		return nil, err
+	}
+
+	if err := yaml.Unmarshal(contents, cfg); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// Save writes the configuration to path, creating parent directories as
+// needed
+func (c *Config) Save(path string) error {
+	contents, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, contents, 0600)
+}
+
+// Profile returns the profile with the given name. An empty name selects the
+// default profile, if there is one; otherwise nil is returned, meaning no
+// profile is in use.
+func (c *Config) Profile(name string) (*Profile, error) {
+	if name == "" {
+		name = c.DefaultProfile
+	}
+
+	if name == "" {
+		return nil, nil
+	}
+
+	profile, ok := c.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("profile %s does not exist", name)
+	}
+
+	return profile, nil
+}
+
+// ProfileNames returns the names of all configured profiles, sorted
+func (c *Config) ProfileNames() []string {
+	names := []string{}
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// AddProfile adds a new profile
+func (c *Config) AddProfile(name string, profile *Profile) error {
+	if name == "" {
+		return errors.New("profile name cannot be empty")
+	}
+
+	if _, ok := c.Profiles[name]; ok {
+		return fmt.Errorf("profile %s already exists", name)
+	}
+
+	if c.Profiles == nil {
+		c.Profiles = map[string]*Profile{}
+	}
+
+	c.Profiles[name] = profile
+
+	return nil
+}
+
+// RemoveProfile removes a profile, unsetting it as the default if needed
+func (c *Config) RemoveProfile(name string) error {
+	if _, ok := c.Profiles[name]; !ok {
+		return fmt.Errorf("profile %s does not exist", name)
+	}
+
+	delete(c.Profiles, name)
+
+	if c.DefaultProfile == name {
+		c.DefaultProfile = ""
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadMissing(t *testing.T) {
+	cfg, err := Load("/nonexistent/stars/config.yml")
+	assert.NoError(t, err)
+	assert.Equal(t, &Config{}, cfg)
+}
+
+func TestSaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stars-config")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, DirName, Filename)
+
+	assert.NoError(t, (&Config{Host: "ghe.example.com"}).Save(path))
+
+	cfg, err := Load(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "ghe.example.com", cfg.Host)
+}
+
+func TestDefaultPath(t *testing.T) {
+	os.Setenv(EnvVar, "/custom/config.yml")
+	defer os.Unsetenv(EnvVar)
+
+	path, err := DefaultPath()
+	assert.NoError(t, err)
+	assert.Equal(t, "/custom/config.yml", path)
+}
+
+func TestProfiles(t *testing.T) {
+	cfg := &Config{}
+
+	profile, err := cfg.Profile("")
+	assert.NoError(t, err)
+	assert.Nil(t, profile)
+
+	assert.NoError(t, cfg.AddProfile("work", &Profile{Host: "ghe.example.com"}))
+	assert.NoError(t, cfg.AddProfile("personal", &Profile{TokenFile: "/token"}))
+	assert.Error(t, cfg.AddProfile("work", &Profile{}))
+	assert.Error(t, cfg.AddProfile("", &Profile{}))
+	assert.Equal(t, []string{"personal", "work"}, cfg.ProfileNames())
+
+	cfg.DefaultProfile = "work"
+
+	profile, err = cfg.Profile("")
+	assert.NoError(t, err)
+	assert.Equal(t, "ghe.example.com", profile.Host)
+
+	_, err = cfg.Profile("missing")
+	assert.Error(t, err)
+
+	assert.NoError(t, cfg.RemoveProfile("work"))
+	assert.Equal(t, "", cfg.DefaultProfile)
+	assert.Error(t, cfg.RemoveProfile("work"))
+}
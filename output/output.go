@@ -0,0 +1,280 @@
+package output
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gkze/gh-stars/starmanager"
+	"gopkg.in/yaml.v3"
+)
+
+// Format is a way of writing records for other programs to read
+type Format string
+
+const (
+	// FormatTable - an aligned, human-readable table (the default). It is
+	// written by the commands themselves, as its columns depend on the
+	// terminal.
+	FormatTable Format = "table"
+
+	// FormatJSON - a JSON array of records
+	FormatJSON Format = "json"
+
+	// FormatJSONL - one JSON record per line
+	FormatJSONL Format = "jsonl"
+
+	// FormatCSV - comma-separated values with a header row
+	FormatCSV Format = "csv"
+
+	// FormatTSV - tab-separated values with a header row
+	FormatTSV Format = "tsv"
+
+	// FormatYAML - a YAML sequence of records
+	FormatYAML Format = "yaml"
+
+	// FormatMarkdown - a GitHub-flavored Markdown table
+	FormatMarkdown Format = "markdown"
+)
+
+// Formats lists every supported format
+var Formats = []Format{
+	FormatTable, FormatJSON, FormatJSONL, FormatCSV, FormatTSV, FormatYAML, FormatMarkdown,
+}
+
+// ParseFormat returns the format with the given name
+func ParseFormat(name string) (Format, error) {
+	names := []string{}
+	for _, format := range Formats {
+		if string(format) == name {
+			return format, nil
+		}
+
+		names = append(names, string(format))
+	}
+
+	return "", fmt.Errorf(
+		"unknown output format %q (must be one of %s)", name, strings.Join(names, ", "),
+	)
+}
+
+// StarRecord is the stable representation of a star in structured output,
+// described by StarSchema. Unlike Star, its field names do not change with the
+// cache schema.
+type StarRecord struct {
+	URL           string     `json:"url" yaml:"url"`
+	Description   string     `json:"description" yaml:"description"`
+	Language      string     `json:"language" yaml:"language"`
+	Topics        []string   `json:"topics" yaml:"topics"`
+	Stargazers    int        `json:"stargazers" yaml:"stargazers"`
+	Archived      bool       `json:"archived" yaml:"archived"`
+	PushedAt      *time.Time `json:"pushed_at" yaml:"pushed_at"`
+	StarredAt     *time.Time `json:"starred_at" yaml:"starred_at"`
+	SyncedAt      *time.Time `json:"synced_at" yaml:"synced_at"`
+	License       string     `json:"license" yaml:"license"`
+	Parent        string     `json:"parent" yaml:"parent"`
+	DiskUsage     int        `json:"disk_usage" yaml:"disk_usage"`
+	LatestRelease string     `json:"latest_release" yaml:"latest_release"`
+	OpenIssues    int        `json:"open_issues" yaml:"open_issues"`
+}
+
+// NewStarRecord builds the record of a star. Unknown times are left nil.
+func NewStarRecord(star *starmanager.Star) *StarRecord {
+	topics := star.Topics
+	if topics == nil {
+		topics = []string{}
+	}
+
+	return &StarRecord{
+		URL:           star.URL,
+		Description:   star.Description,
+		Language:      star.Language,
+		Topics:        topics,
+		Stargazers:    star.Stargazers,
+		Archived:      star.Archived,
+		PushedAt:      timeOrNil(star.PushedAt),
+		StarredAt:     timeOrNil(star.StarredAt),
+		SyncedAt:      timeOrNil(star.SyncedAt),
+		License:       star.License,
+		Parent:        star.Parent,
+		DiskUsage:     star.DiskUsage,
+		LatestRelease: star.LatestRelease,
+		OpenIssues:    star.OpenIssues,
+	}
+}
+
+// starColumns are the column names of stars in tabular formats, in the order
+// of StarRecord.row
+var starColumns = []string{
+	"url", "description", "language", "topics", "stargazers", "archived", "pushed_at",
+	"starred_at", "synced_at", "license", "parent", "disk_usage", "latest_release",
+	"open_issues",
+}
+
+// row returns the fields of the record as text, in the order of starColumns.
+// Topics are separated by commas.
+func (r *StarRecord) row() []string {
+	return []string{
+		r.URL, r.Description, r.Language, strings.Join(r.Topics, ","),
+		strconv.Itoa(r.Stargazers), strconv.FormatBool(r.Archived), formatTime(r.PushedAt),
+		formatTime(r.StarredAt), formatTime(r.SyncedAt), r.License, r.Parent,
+		strconv.Itoa(r.DiskUsage), r.LatestRelease, strconv.Itoa(r.OpenIssues),
+	}
+}
+
+// TopicRecord is the stable representation of a topic in structured output,
+// described by TopicSchema
+type TopicRecord struct {
+	Topic       string `json:"topic" yaml:"topic"`
+	Occurrences int    `json:"occurrences" yaml:"occurrences"`
+}
+
+// topicColumns are the column names of topics in tabular formats
+var topicColumns = []string{"topic", "occurrences"}
+
+// row returns the fields of the record as text, in the order of topicColumns
+func (r *TopicRecord) row() []string {
+	return []string{r.Topic, strconv.Itoa(r.Occurrences)}
+}
+
+// WriteStars writes stars to w in the given format, without truncating any of
+// their fields
+func WriteStars(w io.Writer, format Format, stars []*starmanager.Star) error {
+	records := []interface{}{}
+	rows := [][]string{}
+
+	for _, star := range stars {
+		record := NewStarRecord(star)
+		records = append(records, record)
+		rows = append(rows, record.row())
+	}
+
+	return write(w, format, records, starColumns, rows)
+}
+
+// WriteTopics writes topics, as returned by StarManager.GetTopics, to w in the
+// given format
+func WriteTopics(w io.Writer, format Format, topics []starmanager.KV) error {
+	records := []interface{}{}
+	rows := [][]string{}
+
+	for _, pair := range topics {
+		record := &TopicRecord{Topic: pair.Key, Occurrences: pair.Value}
+		records = append(records, record)
+		rows = append(rows, record.row())
+	}
+
+	return write(w, format, records, topicColumns, rows)
+}
+
+// write writes records in the given format. Tabular formats use the columns
+// and rows instead, which must hold the same data.
+func write(
+	w io.Writer, format Format, records []interface{}, columns []string, rows [][]string,
+) error {
+	switch format {
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+
+		return encoder.Encode(records)
+
+	case FormatJSONL:
+		encoder := json.NewEncoder(w)
+		for _, record := range records {
+			if err := encoder.Encode(record); err != nil {
+				return err
+			}
+		}
+
+		return nil
+
+	case FormatYAML:
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(records); err != nil {
+			return err
+		}
+
+		return encoder.Close()
+
+	case FormatCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.WriteAll(append([][]string{columns}, rows...)); err != nil {
+			return err
+		}
+
+		return writer.Error()
+
+	case FormatTSV:
+		for _, row := range append([][]string{columns}, rows...) {
+			fields := []string{}
+			for _, field := range row {
+				fields = append(fields, tsvEscaper.Replace(field))
+			}
+
+			if _, err := fmt.Fprintln(w, strings.Join(fields, "\t")); err != nil {
+				return err
+			}
+		}
+
+		return nil
+
+	case FormatMarkdown:
+		separators := []string{}
+		for range columns {
+			separators = append(separators, "---")
+		}
+
+		for _, row := range append([][]string{columns, separators}, rows...) {
+			fields := []string{}
+			for _, field := range row {
+				fields = append(fields, markdownEscaper.Replace(field))
+			}
+
+			if _, err := fmt.Fprintf(w, "| %s |\n", strings.Join(fields, " | ")); err != nil {
+				return err
+			}
+		}
+
+		return nil
+
+	default:
+		return fmt.Errorf("unsupported output format %q", format)
+	}
+}
+
+var (
+	// tsvEscaper escapes the characters that would break TSV rows, the way
+	// PostgreSQL's text format does
+	tsvEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+	// markdownEscaper escapes the characters that would break Markdown table
+	// rows
+	markdownEscaper = strings.NewReplacer("|", `\|`, "\r\n", " ", "\n", " ", "\r", " ")
+)
+
+// timeOrNil returns nil for the zero time, which means it is not known
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	t = t.UTC()
+
+	return &t
+}
+
+// formatTime formats a time as RFC 3339, or returns an empty string if it is
+// not known
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+
+	return t.Format(time.RFC3339)
+}
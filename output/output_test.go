@@ -0,0 +1,220 @@
+package output
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gkze/gh-stars/starmanager"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+// testStars returns a star with every field set, one with none of the
+// optional fields set, and one whose description needs escaping
+func testStars() []*starmanager.Star {
+	return []*starmanager.Star{
+		{
+			URL:           "https://github.com/a/one",
+			Description:   "The first one",
+			Language:      "go",
+			Topics:        []string{"cli", "github"},
+			Stargazers:    42,
+			PushedAt:      time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC),
+			StarredAt:     time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+			SyncedAt:      time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC),
+			License:       "MIT",
+			Parent:        "https://github.com/b/two",
+			DiskUsage:     2048,
+			LatestRelease: "v1.0.0",
+			OpenIssues:    3,
+		},
+		{URL: "https://github.com/b/two", Archived: true},
+		{
+			URL:         "https://github.com/c/three",
+			Description: "Tabs\tand | pipes,\nacross \"lines\"",
+		},
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for _, format := range Formats {
+		parsed, err := ParseFormat(string(format))
+		assert.NoError(t, err)
+		assert.Equal(t, format, parsed)
+	}
+
+	_, err := ParseFormat("xml")
+	assert.EqualError(
+		t, err,
+		`unknown output format "xml" (must be one of table, json, jsonl, csv, tsv, yaml, markdown)`,
+	)
+}
+
+func TestWriteStarsJSON(t *testing.T) {
+	buf := &bytes.Buffer{}
+	assert.NoError(t, WriteStars(buf, FormatJSON, testStars()))
+
+	records := []map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &records))
+	assert.Len(t, records, 3)
+
+	assert.Equal(t, map[string]interface{}{
+		"url":            "https://github.com/a/one",
+		"description":    "The first one",
+		"language":       "go",
+		"topics":         []interface{}{"cli", "github"},
+		"stargazers":     float64(42),
+		"archived":       false,
+		"pushed_at":      "2021-01-02T03:04:05Z",
+		"starred_at":     "2020-01-01T00:00:00Z",
+		"synced_at":      "2021-06-01T00:00:00Z",
+		"license":        "MIT",
+		"parent":         "https://github.com/b/two",
+		"disk_usage":     float64(2048),
+		"latest_release": "v1.0.0",
+		"open_issues":    float64(3),
+	}, records[0])
+
+	// Unknown times are null, and topics are never null
+	assert.Nil(t, records[1]["pushed_at"])
+	assert.Equal(t, []interface{}{}, records[1]["topics"])
+	assert.Equal(t, true, records[1]["archived"])
+
+	// Nothing is truncated
+	assert.Equal(t, testStars()[2].Description, records[2]["description"])
+
+	buf.Reset()
+	assert.NoError(t, WriteStars(buf, FormatJSON, nil))
+	assert.Equal(t, "[]\n", buf.String())
+}
+
+func TestWriteStarsJSONL(t *testing.T) {
+	buf := &bytes.Buffer{}
+	assert.NoError(t, WriteStars(buf, FormatJSONL, testStars()))
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	assert.Len(t, lines, 3)
+
+	for i, line := range lines {
+		record := &StarRecord{}
+		assert.NoError(t, json.Unmarshal([]byte(line), record))
+		assert.Equal(t, testStars()[i].URL, record.URL)
+	}
+}
+
+func TestWriteStarsYAML(t *testing.T) {
+	buf := &bytes.Buffer{}
+	assert.NoError(t, WriteStars(buf, FormatYAML, testStars()))
+
+	records := []*StarRecord{}
+	assert.NoError(t, yaml.Unmarshal(buf.Bytes(), &records))
+	assert.Equal(t, []*StarRecord{
+		NewStarRecord(testStars()[0]),
+		NewStarRecord(testStars()[1]),
+		NewStarRecord(testStars()[2]),
+	}, records)
+	assert.Contains(t, buf.String(), "- url: https://github.com/a/one\n  description: The first one\n")
+}
+
+func TestWriteStarsCSV(t *testing.T) {
+	buf := &bytes.Buffer{}
+	assert.NoError(t, WriteStars(buf, FormatCSV, testStars()))
+
+	rows, err := csv.NewReader(buf).ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, rows, 4)
+	assert.Equal(t, starColumns, rows[0])
+	assert.Equal(t, []string{
+		"https://github.com/a/one", "The first one", "go", "cli,github", "42", "false",
+		"2021-01-02T03:04:05Z", "2020-01-01T00:00:00Z", "2021-06-01T00:00:00Z", "MIT",
+		"https://github.com/b/two", "2048", "v1.0.0", "3",
+	}, rows[1])
+	assert.Equal(t, "", rows[2][6])
+	assert.Equal(t, testStars()[2].Description, rows[3][1])
+}
+
+func TestWriteStarsTSV(t *testing.T) {
+	buf := &bytes.Buffer{}
+	assert.NoError(t, WriteStars(buf, FormatTSV, testStars()))
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	assert.Len(t, lines, 4)
+	assert.Equal(t, strings.Join(starColumns, "\t"), lines[0])
+
+	// Tabs and newlines in fields are escaped, so every row has every column
+	for _, line := range lines {
+		assert.Len(t, strings.Split(line, "\t"), len(starColumns))
+	}
+	assert.Equal(t, `Tabs\tand | pipes,\nacross "lines"`, strings.Split(lines[3], "\t")[1])
+}
+
+func TestWriteStarsMarkdown(t *testing.T) {
+	buf := &bytes.Buffer{}
+	assert.NoError(t, WriteStars(buf, FormatMarkdown, testStars()))
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	assert.Len(t, lines, 5)
+	assert.Equal(t, "| "+strings.Join(starColumns, " | ")+" |", lines[0])
+	assert.True(t, strings.HasPrefix(lines[1], "| --- | --- |"))
+	assert.Contains(t, lines[4], "| Tabs\tand \\| pipes, across \"lines\" |")
+}
+
+func TestWriteStarsTable(t *testing.T) {
+	assert.EqualError(
+		t, WriteStars(&bytes.Buffer{}, FormatTable, testStars()),
+		`unsupported output format "table"`,
+	)
+}
+
+func TestWriteTopics(t *testing.T) {
+	topics := []starmanager.KV{{Key: "cli", Value: 2}, {Key: "github", Value: 1}}
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, WriteTopics(buf, FormatJSONL, topics))
+	assert.Equal(t, `{"topic":"cli","occurrences":2}`+"\n"+
+		`{"topic":"github","occurrences":1}`+"\n", buf.String())
+
+	buf.Reset()
+	assert.NoError(t, WriteTopics(buf, FormatCSV, topics))
+	assert.Equal(t, "topic,occurrences\ncli,2\ngithub,1\n", buf.String())
+
+	buf.Reset()
+	assert.NoError(t, WriteTopics(buf, FormatMarkdown, topics))
+	assert.Equal(t, "| topic | occurrences |\n| --- | --- |\n| cli | 2 |\n| github | 1 |\n", buf.String())
+}
+
+// TestSchemas checks that the schemas describe exactly the fields of the
+// records, in the order of the tabular columns
+func TestSchemas(t *testing.T) {
+	for name, test := range map[string]struct {
+		record  interface{}
+		columns []string
+	}{
+		"star":  {StarRecord{}, starColumns},
+		"topic": {TopicRecord{}, topicColumns},
+	} {
+		schema := struct {
+			Properties map[string]interface{} `json:"properties"`
+			Required   []string               `json:"required"`
+		}{}
+		assert.NoError(t, json.Unmarshal([]byte(Schemas[name]), &schema), name)
+
+		tags := []string{}
+		recordType := reflect.TypeOf(test.record)
+		for i := 0; i < recordType.NumField(); i++ {
+			tags = append(tags, recordType.Field(i).Tag.Get("json"))
+		}
+
+		assert.Equal(t, tags, test.columns, name)
+		assert.Equal(t, tags, schema.Required, name)
+		assert.Len(t, schema.Properties, len(tags), name)
+		for _, tag := range tags {
+			assert.Contains(t, schema.Properties, tag, name)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package output
+
+// StarSchema is the JSON Schema of a StarRecord, which is what each star is
+// written as in the json, jsonl and yaml formats. The csv, tsv and markdown
+// formats have a column per property, in the same order, with topics joined
+// by commas and unknown times left empty.
+//
+// Properties are only ever added to the schema, never renamed or removed, so
+// that programs reading the output keep working with later versions of stars.
+const StarSchema = `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "title": "Star",
+  "description": "A repository starred by the user, as output by stars show",
+  "type": "object",
+  "properties": {
+    "url": {
+      "description": "Web URL of the repository, which identifies it",
+      "type": "string",
+      "format": "uri"
+    },
+    "description": {
+      "description": "Description of the repository, empty if it has none",
+      "type": "string"
+    },
+    "language": {
+      "description": "Dominant programming language of the repository, lowercased",
+      "type": "string"
+    },
+    "topics": {
+      "description": "Topics (labels) of the repository",
+      "type": "array",
+      "items": {"type": "string"}
+    },
+    "stargazers": {
+      "description": "Number of users who starred the repository",
+      "type": "integer",
+      "minimum": 0
+    },
+    "archived": {
+      "description": "Whether the repository is archived",
+      "type": "boolean"
+    },
+    "pushed_at": {
+      "description": "When the repository was last pushed to, null if unknown",
+      "type": ["string", "null"],
+      "format": "date-time"
+    },
+    "starred_at": {
+      "description": "When the user starred the repository, null if unknown",
+      "type": ["string", "null"],
+      "format": "date-time"
+    },
+    "synced_at": {
+      "description": "When the metadata of the repository was last fetched from GitHub, null if never",
+      "type": ["string", "null"],
+      "format": "date-time"
+    },
+    "license": {
+      "description": "SPDX identifier of the license of the repository, empty if unknown",
+      "type": "string"
+    },
+    "parent": {
+      "description": "Web URL of the repository this one was forked from, empty if it is not a fork or unknown",
+      "type": "string"
+    },
+    "disk_usage": {
+      "description": "Size of the repository in kilobytes",
+      "type": "integer",
+      "minimum": 0
+    },
+    "latest_release": {
+      "description": "Tag name of the latest release, empty if none or unknown",
+      "type": "string"
+    },
+    "open_issues": {
+      "description": "Number of open issues, excluding pull requests",
+      "type": "integer",
+      "minimum": 0
+    }
+  },
+  "required": [
+    "url", "description", "language", "topics", "stargazers", "archived", "pushed_at",
+    "starred_at", "synced_at", "license", "parent", "disk_usage", "latest_release",
+    "open_issues"
+  ]
+}
+`
+
+// TopicSchema is the JSON Schema of a TopicRecord, which is what each topic is
+// written as by stars topics
+const TopicSchema = `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "title": "Topic",
+  "description": "A topic of the user's stars, as output by stars topics",
+  "type": "object",
+  "properties": {
+    "topic": {
+      "description": "Name of the topic",
+      "type": "string"
+    },
+    "occurrences": {
+      "description": "Number of stars with the topic",
+      "type": "integer",
+      "minimum": 1
+    }
+  },
+  "required": ["topic", "occurrences"]
+}
+`
+
+// Schemas maps the names of the record types to their JSON Schemas
+var Schemas = map[string]string{
+	"star":  StarSchema,
+	"topic": TopicSchema,
+}
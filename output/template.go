@@ -0,0 +1,108 @@
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/gkze/gh-stars/starmanager"
+)
+
+// TemplateFuncs are the functions available to templates, in addition to the
+// text/template builtins:
+//
+//	ago TIME          how long ago TIME was, e.g. "3 days ago"
+//	date LAYOUT TIME  TIME formatted with a Go time layout, e.g. "2006-01-02"
+//	truncate N S      S cut to N characters, ending in "..." if it was longer
+//	join SEP LIST     the elements of LIST separated by SEP
+//	repo URL          the owner/name of the repository at URL
+//	comma N           N with thousands separated by commas, e.g. "12,345"
+//
+// Unknown (zero) times are written as empty strings.
+var TemplateFuncs = template.FuncMap{
+	"ago": func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+
+		return humanize.Time(t)
+	},
+	"date": func(layout string, t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+
+		return t.Format(layout)
+	},
+	"truncate": truncate,
+	"join": func(sep string, elems []string) string {
+		return strings.Join(elems, sep)
+	},
+	"repo": func(repoURL string) string {
+		u, err := url.Parse(repoURL)
+		if err != nil {
+			return repoURL
+		}
+
+		return strings.Trim(u.Path, "/")
+	},
+	"comma": func(n int) string {
+		return humanize.Comma(int64(n))
+	},
+}
+
+// ParseTemplate parses text as a template for stars, with TemplateFuncs
+// available to it
+func ParseTemplate(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs(TemplateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+
+	return tmpl, nil
+}
+
+// WriteTemplate executes tmpl once for each star, which is its data, and
+// writes the results to w. Results that do not end with a newline are
+// followed by one, so that every star is on its own line(s). Empty results are
+// left out, so templates can skip stars with if.
+func WriteTemplate(w io.Writer, tmpl *template.Template, stars []*starmanager.Star) error {
+	buf := &bytes.Buffer{}
+
+	for _, star := range stars {
+		buf.Reset()
+		if err := tmpl.Execute(buf, star); err != nil {
+			return fmt.Errorf("could not write %s with the template: %w", star.URL, err)
+		}
+
+		if buf.Len() > 0 && buf.Bytes()[buf.Len()-1] != '\n' {
+			buf.WriteByte('\n')
+		}
+
+		if _, err := buf.WriteTo(w); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// truncate cuts s to n characters, replacing the end with "..." if it is
+// longer
+func truncate(n int, s string) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+
+	if n <= 3 {
+		return string(runes[:n])
+	}
+
+	return string(runes[:n-3]) + "..."
+}
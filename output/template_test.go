@@ -0,0 +1,87 @@
+package output
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/gkze/gh-stars/starmanager"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteTemplate(t *testing.T) {
+	tmpl, err := ParseTemplate("test", "{{.URL}} {{.Stargazers}}")
+	assert.NoError(t, err)
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, WriteTemplate(buf, tmpl, testStars()[:2]))
+	assert.Equal(t, "https://github.com/a/one 42\nhttps://github.com/b/two 0\n", buf.String())
+
+	// Templates ending with a newline, as files do, get no extra one
+	tmpl, err = ParseTemplate("test", "* {{repo .URL}}\n")
+	assert.NoError(t, err)
+
+	buf.Reset()
+	assert.NoError(t, WriteTemplate(buf, tmpl, testStars()))
+	assert.Equal(t, "* a/one\n* b/two\n* c/three\n", buf.String())
+
+	// Stars the template writes nothing for are left out
+	tmpl, err = ParseTemplate("test", "{{if .Archived}}{{.URL}}{{end}}")
+	assert.NoError(t, err)
+
+	buf.Reset()
+	assert.NoError(t, WriteTemplate(buf, tmpl, testStars()))
+	assert.Equal(t, "https://github.com/b/two\n", buf.String())
+}
+
+func TestTemplateFuncs(t *testing.T) {
+	star := &starmanager.Star{
+		URL:         "https://github.com/a/one",
+		Description: "A tool for managing GitHub stars",
+		Topics:      []string{"cli", "github"},
+		Stargazers:  12345,
+		PushedAt:    time.Now().Add(-3 * 24 * time.Hour),
+		StarredAt:   time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC),
+	}
+
+	for text, expected := range map[string]string{
+		`{{.PushedAt | ago}}`:                "3 days ago\n",
+		`{{.SyncedAt | ago}}`:                "",
+		`{{.StarredAt | date "2006-01-02"}}`: "2020-01-02\n",
+		`{{.Description | truncate 10}}`:     "A tool ...\n",
+		`{{.Description | truncate 100}}`:    "A tool for managing GitHub stars\n",
+		`{{.Topics | join ", "}}`:            "cli, github\n",
+		`{{repo .URL}}`:                      "a/one\n",
+		`{{comma .Stargazers}}`:              "12,345\n",
+	} {
+		tmpl, err := ParseTemplate("test", text)
+		assert.NoError(t, err, text)
+
+		buf := &bytes.Buffer{}
+		assert.NoError(t, WriteTemplate(buf, tmpl, []*starmanager.Star{star}), text)
+		assert.Equal(t, expected, buf.String(), text)
+	}
+}
+
+func TestTemplateErrors(t *testing.T) {
+	_, err := ParseTemplate("test", "{{.URL")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid template: ")
+
+	_, err = ParseTemplate("test", "{{.URL | nope}}")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `function "nope" not defined`)
+
+	tmpl, err := ParseTemplate("test", "{{.Nope}}")
+	assert.NoError(t, err)
+
+	err = WriteTemplate(&bytes.Buffer{}, tmpl, testStars())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "could not write https://github.com/a/one with the template: ")
+}
+
+func TestTruncate(t *testing.T) {
+	assert.Equal(t, "abc", truncate(3, "abc"))
+	assert.Equal(t, "ab", truncate(2, "abc"))
+	assert.Equal(t, "héllo...", truncate(8, "héllo wörld"))
+}
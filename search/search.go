@@ -0,0 +1,379 @@
+package search
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Version is the format of indexes. Indexes of other versions were built with
+// a different tokenizer, and must be rebuilt.
+const Version = 1
+
+const (
+	// k1 controls how quickly the score of a term saturates as it occurs more
+	// often in a document
+	k1 = 1.2
+
+	// b controls how much the score of a term is normalized by the length of
+	// the field it occurs in
+	b = 0.75
+)
+
+// stopWords are left out of indexes and queries, as they occur everywhere
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true,
+	"by": true, "for": true, "from": true, "in": true, "is": true, "it": true, "of": true,
+	"on": true, "or": true, "that": true, "the": true, "this": true, "to": true,
+	"with": true,
+}
+
+// Document is a text to index, made of named fields (e.g. "name" and
+// "description")
+type Document struct {
+	ID     string
+	Fields map[string]string
+}
+
+// Index is an inverted index of documents, ranking them against queries with
+// BM25F. It is serializable to JSON.
+type Index struct {
+	// Version is the format of the index
+	Version int `json:"version"`
+
+	// Stamp is set by the owner of the index to record what it was built
+	// from, so that it can tell when the index is out of date
+	Stamp string `json:"stamp,omitempty"`
+
+	// Docs holds the documents, in the order they were added
+	Docs []*Doc `json:"docs"`
+
+	// Postings lists the documents each term occurs in
+	Postings map[string][]*Posting `json:"postings"`
+
+	// TotalLengths is the number of terms in each field, over all documents
+	TotalLengths map[string]int `json:"total_lengths"`
+}
+
+// Doc is an indexed document
+type Doc struct {
+	// ID identifies the document
+	ID string `json:"id"`
+
+	// Lengths is the number of terms in each field of the document
+	Lengths map[string]int `json:"lengths"`
+}
+
+// Posting records how often a term occurs in each field of a document
+type Posting struct {
+	// Doc is the index of the document in Index.Docs
+	Doc int `json:"doc"`
+
+	// Freqs is the number of occurrences of the term in each field
+	Freqs map[string]int `json:"freqs"`
+}
+
+// Result is a document matching a query
+type Result struct {
+	// ID identifies the document
+	ID string
+
+	// Score is how well the document matches, higher is better
+	Score float64
+
+	// Fields are the fields of the document that matched, sorted
+	Fields []string
+}
+
+// NewIndex returns an empty index
+func NewIndex() *Index {
+	return &Index{
+		Version:      Version,
+		Docs:         []*Doc{},
+		Postings:     map[string][]*Posting{},
+		TotalLengths: map[string]int{},
+	}
+}
+
+// Len returns the number of documents in the index
+func (ix *Index) Len() int {
+	return len(ix.Docs)
+}
+
+// Add indexes a document
+func (ix *Index) Add(doc Document) {
+	docIndex := len(ix.Docs)
+	indexed := &Doc{ID: doc.ID, Lengths: map[string]int{}}
+	ix.Docs = append(ix.Docs, indexed)
+
+	postings := map[string]*Posting{}
+
+	for field, text := range doc.Fields {
+		terms := Terms(text)
+		indexed.Lengths[field] = len(terms)
+		ix.TotalLengths[field] += len(terms)
+
+		for _, term := range terms {
+			posting, ok := postings[term]
+			if !ok {
+				posting = &Posting{Doc: docIndex, Freqs: map[string]int{}}
+				postings[term] = posting
+				ix.Postings[term] = append(ix.Postings[term], posting)
+			}
+
+			posting.Freqs[field]++
+		}
+	}
+}
+
+// Search returns the documents matching any term of the query, best first.
+// Fields are weighted by weights (fields without a weight count once), and at
+// most limit results are returned (all of them if not positive).
+func (ix *Index) Search(query string, weights map[string]float64, limit int) []*Result {
+	n := float64(len(ix.Docs))
+	if n == 0 {
+		return []*Result{}
+	}
+
+	averages := map[string]float64{}
+	for field, total := range ix.TotalLengths {
+		averages[field] = float64(total) / n
+	}
+
+	results := map[int]*Result{}
+	matched := map[int]map[string]bool{}
+
+	for _, term := range UniqueTerms(query) {
+		postings := ix.Postings[term]
+		if len(postings) == 0 {
+			continue
+		}
+
+		df := float64(len(postings))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+
+		for _, posting := range postings {
+			doc := ix.Docs[posting.Doc]
+
+			// BM25F: the weighted, length-normalized frequencies of the term in
+			// every field are summed before saturating
+			tf := 0.0
+			for field, freq := range posting.Freqs {
+				weight, ok := weights[field]
+				if !ok {
+					weight = 1
+				}
+
+				norm := 1.0
+				if averages[field] > 0 {
+					norm = 1 - b + b*float64(doc.Lengths[field])/averages[field]
+				}
+
+				tf += weight * float64(freq) / norm
+			}
+
+			result, ok := results[posting.Doc]
+			if !ok {
+				result = &Result{ID: doc.ID}
+				results[posting.Doc] = result
+				matched[posting.Doc] = map[string]bool{}
+			}
+			result.Score += idf * tf / (k1 + tf)
+
+			for field := range posting.Freqs {
+				matched[posting.Doc][field] = true
+			}
+		}
+	}
+
+	sorted := []*Result{}
+	for docIndex, result := range results {
+		for field := range matched[docIndex] {
+			result.Fields = append(result.Fields, field)
+		}
+		sort.Strings(result.Fields)
+
+		sorted = append(sorted, result)
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Score != sorted[j].Score {
+			return sorted[i].Score > sorted[j].Score
+		}
+
+		return sorted[i].ID < sorted[j].ID
+	})
+
+	if limit > 0 && len(sorted) > limit {
+		sorted = sorted[:limit]
+	}
+
+	return sorted
+}
+
+// token is a word of a text, at a byte offset
+type token struct {
+	text       string
+	start, end int
+}
+
+// tokenize splits text into words of letters and digits
+func tokenize(text string) []token {
+	tokens := []token{}
+	start := -1
+
+	for i, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if start < 0 {
+				start = i
+			}
+		} else if start >= 0 {
+			tokens = append(tokens, token{text[start:i], start, i})
+			start = -1
+		}
+	}
+
+	if start >= 0 {
+		tokens = append(tokens, token{text[start:], start, len(text)})
+	}
+
+	return tokens
+}
+
+// normalize returns the term a word is indexed as, or an empty string if it
+// is not indexed. Words are lowercased, and plurals folded into singulars.
+func normalize(word string) string {
+	term := strings.ToLower(word)
+	if stopWords[term] {
+		return ""
+	}
+
+	switch {
+	case len(term) > 4 && strings.HasSuffix(term, "ies"):
+		return term[:len(term)-3] + "y"
+	case len(term) > 4 && strings.HasSuffix(term, "sses"):
+		return term[:len(term)-2]
+	case len(term) > 3 && strings.HasSuffix(term, "s") && !strings.HasSuffix(term, "ss") &&
+		!strings.HasSuffix(term, "us") && !strings.HasSuffix(term, "is"):
+		return term[:len(term)-1]
+	default:
+		return term
+	}
+}
+
+// Terms returns the terms a text is indexed as, in order
+func Terms(text string) []string {
+	terms := []string{}
+	for _, tok := range tokenize(text) {
+		if term := normalize(tok.text); term != "" {
+			terms = append(terms, term)
+		}
+	}
+
+	return terms
+}
+
+// UniqueTerms returns the distinct terms of a text, in the order they first
+// occur
+func UniqueTerms(text string) []string {
+	seen := map[string]bool{}
+	terms := []string{}
+
+	for _, term := range Terms(text) {
+		if !seen[term] {
+			seen[term] = true
+			terms = append(terms, term)
+		}
+	}
+
+	return terms
+}
+
+// Highlight surrounds the words of text that are indexed as one of terms with
+// open and close
+func Highlight(text string, terms []string, open, close string) string {
+	wanted := map[string]bool{}
+	for _, term := range terms {
+		wanted[term] = true
+	}
+
+	out := strings.Builder{}
+	last := 0
+
+	for _, tok := range tokenize(text) {
+		if !wanted[normalize(tok.text)] {
+			continue
+		}
+
+		out.WriteString(text[last:tok.start])
+		out.WriteString(open)
+		out.WriteString(tok.text)
+		out.WriteString(close)
+		last = tok.end
+	}
+	out.WriteString(text[last:])
+
+	return out.String()
+}
+
+// Snippet returns about width characters of text around the first word that
+// is indexed as one of terms, with whitespace collapsed and "..." marking cut
+// ends, or an empty string if no word is
+func Snippet(text string, terms []string, width int) string {
+	text = strings.Join(strings.Fields(text), " ")
+
+	wanted := map[string]bool{}
+	for _, term := range terms {
+		wanted[term] = true
+	}
+
+	match := -1
+	for _, tok := range tokenize(text) {
+		if wanted[normalize(tok.text)] {
+			match = tok.start
+			break
+		}
+	}
+
+	if match < 0 {
+		return ""
+	}
+
+	// Show some context before the match, starting at a word
+	start := match
+	for back := 0; start > 0 && back < width/3; back++ {
+		_, size := utf8.DecodeLastRuneInString(text[:start])
+		start -= size
+	}
+	if start > 0 {
+		if space := strings.IndexByte(text[start:match], ' '); space >= 0 {
+			start += space + 1
+		} else {
+			start = match
+		}
+	}
+
+	// Fill the rest of the width, ending at a word
+	end := start
+	for count := 0; end < len(text) && count < width; count++ {
+		_, size := utf8.DecodeRuneInString(text[end:])
+		end += size
+	}
+	if end < len(text) {
+		if space := strings.LastIndexByte(text[match:end], ' '); space > 0 {
+			end = match + space
+		}
+	}
+
+	snippet := text[start:end]
+	if start > 0 {
+		snippet = "..." + snippet
+	}
+	if end < len(text) {
+		snippet += "..."
+	}
+
+	return snippet
+}
@@ -0,0 +1,126 @@
+package search
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testIndex indexes a few repositories
+func testIndex() *Index {
+	ix := NewIndex()
+
+	for _, doc := range []Document{
+		{ID: "a/yaml-diff", Fields: map[string]string{
+			"name":        "a/yaml-diff",
+			"description": "A structural diff tool for YAML files",
+			"topics":      "yaml diff cli",
+		}},
+		{ID: "b/yq", Fields: map[string]string{
+			"name":        "b/yq",
+			"description": "Command-line YAML processor",
+			"topics":      "yaml",
+		}},
+		{ID: "c/difftastic", Fields: map[string]string{
+			"name":        "c/difftastic",
+			"description": "A syntax-aware diff",
+			"readme":      "Difftastic compares files using their syntax trees, including YAML and JSON.",
+		}},
+		{ID: "d/http", Fields: map[string]string{
+			"name":        "d/http",
+			"description": "An HTTP client",
+		}},
+	} {
+		ix.Add(doc)
+	}
+
+	return ix
+}
+
+// ids returns the IDs of results
+func ids(results []*Result) []string {
+	result := []string{}
+	for _, r := range results {
+		result = append(result, r.ID)
+	}
+
+	return result
+}
+
+func TestTerms(t *testing.T) {
+	assert.Equal(
+		t, []string{"yaml", "diff", "tool", "file", "library", "css", "redis", "status", "boss"},
+		Terms("The YAML-diff tools, for files: libraries CSS redis status bosses"),
+	)
+	assert.Equal(t, []string{"yaml", "parser"}, UniqueTerms("YAML parser, yaml PARSERS"))
+	assert.Empty(t, Terms("the and of"))
+	assert.Equal(t, []string{"日本語", "naïve"}, Terms("日本語 naïve"))
+}
+
+func TestSearch(t *testing.T) {
+	ix := testIndex()
+	assert.Equal(t, 4, ix.Len())
+
+	// Documents matching more terms, in weightier fields, rank higher
+	results := ix.Search("yaml diff tool", map[string]float64{"name": 3, "readme": 0.5}, 0)
+	assert.Equal(t, []string{"a/yaml-diff", "c/difftastic", "b/yq"}, ids(results))
+	assert.Equal(t, []string{"description", "name", "topics"}, results[0].Fields)
+	assert.Equal(t, []string{"description", "readme"}, results[1].Fields)
+	assert.Equal(t, []string{"description", "topics"}, results[2].Fields)
+
+	for i := 1; i < len(results); i++ {
+		assert.Greater(t, results[i-1].Score, results[i].Score)
+	}
+
+	// Plurals and case do not matter
+	assert.Equal(t, []string{"c/difftastic"}, ids(ix.Search("TREES", nil, 0)))
+
+	assert.Equal(t, []string{"a/yaml-diff"}, ids(ix.Search("yaml diff tool", nil, 1)))
+	assert.Empty(t, ix.Search("kubernetes", nil, 0))
+	assert.Empty(t, ix.Search("the", nil, 0))
+	assert.Empty(t, NewIndex().Search("yaml", nil, 0))
+}
+
+func TestIndexJSON(t *testing.T) {
+	ix := testIndex()
+
+	encoded, err := json.Marshal(ix)
+	assert.NoError(t, err)
+
+	decoded := &Index{}
+	assert.NoError(t, json.Unmarshal(encoded, decoded))
+	assert.Equal(t, Version, decoded.Version)
+
+	weights := map[string]float64{"name": 3}
+	assert.Equal(t, ix.Search("yaml diff", weights, 0), decoded.Search("yaml diff", weights, 0))
+}
+
+func TestHighlight(t *testing.T) {
+	terms := UniqueTerms("yaml tools")
+
+	assert.Equal(
+		t, "A structural diff [tool] for [YAML] files, and [yaml]-ish [tools]",
+		Highlight("A structural diff tool for YAML files, and yaml-ish tools", terms, "[", "]"),
+	)
+	assert.Equal(t, "nothing here", Highlight("nothing here", terms, "[", "]"))
+}
+
+func TestSnippet(t *testing.T) {
+	terms := UniqueTerms("yaml")
+
+	readme := "# Difftastic\n\nDifftastic is a structural diff tool that compares files\n" +
+		"based on their syntax. It supports many languages, including YAML, JSON and TOML,\n" +
+		"and understands nesting."
+
+	snippet := Snippet(readme, terms, 40)
+	assert.Equal(t, "...including YAML, JSON and TOML, and...", snippet)
+	assert.Contains(t, Highlight(snippet, terms, "[", "]"), "[YAML]")
+
+	// Short texts are not cut
+	assert.Equal(t, "YAML files", Snippet("YAML\nfiles", terms, 40))
+
+	assert.Empty(t, Snippet(readme, UniqueTerms("kubernetes"), 40))
+	assert.True(t, strings.HasPrefix(Snippet(readme, UniqueTerms("difftastic"), 20), "# Difftastic"))
+}
@@ -0,0 +1,157 @@
+package starmanager
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gkze/gh-stars/transport"
+)
+
+const (
+	// LastSyncKey is the metadata key the time of the last successful sync is
+	// stored under
+	LastSyncKey string = "last_sync"
+
+	// ETagKeyPrefix prefixes the metadata keys API responses are cached under
+	// for conditional requests
+	ETagKeyPrefix string = "etag:"
+)
+
+// metaCache stores transport.Cache values as store metadata under a key prefix
+type metaCache struct {
+	store  Store
+	prefix string
+}
+
+// Get satisfies transport.Cache for metaCache
+func (c metaCache) Get(key string) ([]byte, bool, error) {
+	value, err := c.store.GetMeta(c.prefix + key)
+	if errors.Is(err, ErrMetaNotFound) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return value, true, nil
+}
+
+// Set satisfies transport.Cache for metaCache
+func (c metaCache) Set(key string, value []byte) error {
+	return c.store.SetMeta(c.prefix+key, value)
+}
+
+// DefaultCachePath returns the location of the cache for a GitHub web host,
+// profile and storage backend, see ResolveCachePath
+func DefaultCachePath(host, profile, backend string) (string, error) {
+	path, _, err := ResolveCachePath(host, profile, backend)
+
+	return path, err
+}
+
+// ResolveCachePath returns the location of the cache for a GitHub web host,
+// profile and storage backend, along with where it came from: a file named by
+// CacheFileFor in $STARS_CACHE if set, otherwise in the stars directory of
+// $XDG_CACHE_HOME, falling back to ~/.cache, where caches have always been
+func ResolveCachePath(host, profile, backend string) (path, source string, err error) {
+	file := CacheFileFor(host, profile, backend)
+
+	if dir := os.Getenv(CacheEnvVar); dir != "" {
+		return filepath.Join(dir, file), "$" + CacheEnvVar, nil
+	}
+
+	if dir := os.Getenv(XDGCacheHomeEnvVar); dir != "" {
+		return filepath.Join(dir, XDGCacheDir, file), "$" + XDGCacheHomeEnvVar, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", "", fmt.Errorf("could not determine the cache directory: %w", err)
+	}
+
+	return filepath.Join(home, CachePath, file), "~/" + CachePath, nil
+}
+
+// CacheInfo describes the local cache
+type CacheInfo struct {
+	// Path is the location of the cache, empty if it is not backed by a file
+	Path string
+
+	// Size is the size of the cache file in bytes
+	Size int64
+
+	// Count is the number of cached stars
+	Count int
+
+	// SchemaVersion is the schema version of the cache
+	SchemaVersion int
+
+	// LastSync is the time of the last successful sync, the zero time if the
+	// cache has never been synced
+	LastSync time.Time
+}
+
+// CacheInfo returns information about the local cache
+func (s *StarManager) CacheInfo() (*CacheInfo, error) {
+	info := &CacheInfo{Path: s.store.Path()}
+
+	if info.Path != "" {
+		stat, err := s.fs.Stat(info.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		info.Size = stat.Size()
+	}
+
+	var err error
+	if info.Count, err = s.store.Count(); err != nil {
+		return nil, err
+	}
+
+	if info.SchemaVersion, err = SchemaVersion(s.store); err != nil {
+		return nil, err
+	}
+
+	if info.LastSync, err = s.LastSync(); err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// LastSync returns the time of the last successful sync, or the zero time if
+// the cache has never been synced
+func (s *StarManager) LastSync() (time.Time, error) {
+	value, err := s.store.GetMeta(LastSyncKey)
+	if errors.Is(err, ErrMetaNotFound) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Parse(time.RFC3339, string(value))
+}
+
+// RequestStats returns how many GitHub API requests were answered from the
+// local cache because nothing had changed (hits), and how many were fetched in
+// full (misses)
+func (s *StarManager) RequestStats() (hits, misses int64) {
+	if s.etag == nil {
+		return 0, 0
+	}
+
+	return s.etag.Stats()
+}
+
+// setLastSync records the time of a successful sync
+func (s *StarManager) setLastSync(t time.Time) error {
+	return s.store.SetMeta(LastSyncKey, []byte(t.UTC().Format(time.RFC3339)))
+}
+
+// Compile-time interface satisfaction check
+var _ transport.Cache = metaCache{}
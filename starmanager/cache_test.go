@@ -0,0 +1,137 @@
+package starmanager
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gkze/gh-stars/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultCachePath(t *testing.T) {
+	os.Setenv(XDGCacheHomeEnvVar, "/xdg/cache")
+	defer os.Unsetenv(XDGCacheHomeEnvVar)
+
+	// Caches get their own directory in $XDG_CACHE_HOME
+	path, source, err := ResolveCachePath(GitHubHost, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "/xdg/cache/stars/stars.db", path)
+	assert.Equal(t, "$XDG_CACHE_HOME", source)
+
+	path, err = DefaultCachePath("ghe.example.com", "work", BackendSQLite)
+	assert.NoError(t, err)
+	assert.Equal(t, "/xdg/cache/stars/stars-work.sqlite", path)
+
+	// Profiles and backends keep their own files in $STARS_CACHE
+	os.Setenv(CacheEnvVar, "/custom")
+	defer os.Unsetenv(CacheEnvVar)
+
+	path, source, err = ResolveCachePath(GitHubHost, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "/custom/stars.db", path)
+	assert.Equal(t, "$STARS_CACHE", source)
+
+	path, err = DefaultCachePath(GitHubHost, "work", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "/custom/stars-work.db", path)
+
+	path, err = DefaultCachePath(GitHubHost, "work", BackendSQLite)
+	assert.NoError(t, err)
+	assert.Equal(t, "/custom/stars-work.sqlite", path)
+
+	// Without either, caches stay directly in ~/.cache
+	os.Unsetenv(CacheEnvVar)
+	os.Unsetenv(XDGCacheHomeEnvVar)
+
+	home, err := os.UserHomeDir()
+	assert.NoError(t, err)
+
+	path, source, err = ResolveCachePath(GitHubHost, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(home, ".cache", "stars.db"), path)
+	assert.Equal(t, "~/.cache", source)
+}
+
+func TestCacheInfo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stars-starmanager")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	mem := auth.NewMemory()
+	mem.Set(GitHubAPIHost, "user", "secret")
+
+	// The cache directory is created if missing
+	cacheFile := filepath.Join(dir, "nested", CacheFile)
+	sm, err := NewWithConfig(&Config{Auth: mem, CacheFile: cacheFile})
+	assert.NoError(t, err)
+	defer sm.Close()
+
+	saveFixtures(t, sm)
+
+	info, err := sm.CacheInfo()
+	assert.NoError(t, err)
+	assert.Equal(t, cacheFile, info.Path)
+	assert.True(t, info.Size > 0)
+	assert.Equal(t, 3, info.Count)
+	assert.Equal(t, CurrentSchemaVersion, info.SchemaVersion)
+	assert.True(t, info.LastSync.IsZero())
+
+	synced := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	assert.NoError(t, sm.setLastSync(synced))
+
+	lastSync, err := sm.LastSync()
+	assert.NoError(t, err)
+	assert.True(t, synced.Equal(lastSync))
+}
+
+func TestConditionalRequests(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("If-None-Match") == `"stars"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+
+			w.Header().Set("ETag", `"stars"`)
+			fmt.Fprint(w, `[
+				{"starred_at": "2020-01-01T00:00:00Z", "repo": {"html_url": "https://github.com/a/one"}}
+			]`)
+		},
+	))
+	defer server.Close()
+
+	baseURL, err := url.Parse(server.URL + "/")
+	assert.NoError(t, err)
+
+	mem := auth.NewMemory()
+	mem.Set(GitHubAPIHost, "user", "secret")
+
+	store := NewMemoryStore()
+	assert.NoError(t, store.Save(&Star{URL: "https://github.com/b/two"}))
+
+	// Cached responses outlive the StarManager that fetched them
+	for _, expectedHits := range []int64{0, 1} {
+		sm, err := NewWithConfig(&Config{Auth: mem, Store: store})
+		assert.NoError(t, err)
+		sm.client.BaseURL = baseURL
+
+		_, err = sm.Sync(context.Background(), SyncOptions{Full: true})
+		assert.NoError(t, err)
+
+		hits, misses := sm.RequestStats()
+		assert.Equal(t, expectedHits, hits)
+		assert.Equal(t, 1-expectedHits, misses)
+	}
+
+	count, err := store.Count()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
@@ -0,0 +1,160 @@
+package starmanager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// SyncCheckpointKey is the metadata key holding the progress of a sync that
+// lists every star, while it runs
+const SyncCheckpointKey = "sync_checkpoint"
+
+// SyncCheckpoint records the progress of a sync listing every star, so that an
+// interrupted sync can be resumed instead of starting over from the first page
+type SyncCheckpoint struct {
+	// Fetcher is the name of the Fetcher listing the stars, whose cursors
+	// cannot be used with other fetchers
+	Fetcher string `json:"fetcher"`
+
+	// Cursor is where the next page of stars starts. It is empty until the
+	// first page has been saved.
+	Cursor string `json:"cursor"`
+
+	// Pages is how many pages have been saved
+	Pages int `json:"pages"`
+
+	// Full records whether the sync removes stars that are no longer starred
+	Full bool `json:"full"`
+
+	// StartedAt is when the sync started. Stars synced before then that are
+	// not listed again are no longer starred.
+	StartedAt time.Time `json:"started_at"`
+}
+
+// SyncCheckpoint returns the checkpoint of an interrupted sync, or nil if the
+// last sync completed
+func (s *StarManager) SyncCheckpoint() (*SyncCheckpoint, error) {
+	value, err := s.store.GetMeta(SyncCheckpointKey)
+	if errors.Is(err, ErrMetaNotFound) || (err == nil && len(value) == 0) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	checkpoint := &SyncCheckpoint{}
+	if err := json.Unmarshal(value, checkpoint); err != nil {
+		return nil, fmt.Errorf("invalid sync checkpoint: %w", err)
+	}
+
+	return checkpoint, nil
+}
+
+// saveSyncCheckpoint records the progress of the running sync
+func (s *StarManager) saveSyncCheckpoint(checkpoint *SyncCheckpoint) error {
+	value, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	return s.store.SetMeta(SyncCheckpointKey, value)
+}
+
+// clearSyncCheckpoint marks the running sync as completed. Stores cannot
+// delete metadata, so the checkpoint is emptied instead.
+func (s *StarManager) clearSyncCheckpoint() error {
+	return s.store.SetMeta(SyncCheckpointKey, []byte{})
+}
+
+const (
+	// SaveCheckpointKey is the metadata key holding the progress of
+	// SaveAllStars, until it has saved every page
+	SaveCheckpointKey = "save_checkpoint"
+
+	// SaveCheckpointMaxAge is how long a SaveCheckpoint can be resumed from.
+	// Stars starred or unstarred since it was recorded would be missed.
+	SaveCheckpointMaxAge = 24 * time.Hour
+)
+
+// SaveCheckpoint records the pages SaveAllStars has saved, so that
+// ResumeSaveAllStars only fetches the remaining pages
+type SaveCheckpoint struct {
+	// Pages is how many pages of stars there are
+	Pages int `json:"pages"`
+
+	// Newest is the URL of the newest star. Any other newest star means that
+	// stars were starred or unstarred since, moving stars between pages.
+	Newest string `json:"newest"`
+
+	// Saved lists the pages all of whose stars were saved, in order
+	Saved []int `json:"saved"`
+
+	// StartedAt is when the first attempt to save the stars started
+	StartedAt time.Time `json:"started_at"`
+}
+
+// outdated explains why the checkpoint cannot be resumed from at now, given
+// the number of pages and the newest star listed then, or returns "" if it can
+func (c *SaveCheckpoint) outdated(now time.Time, pages int, newest string) string {
+	switch {
+	case now.Sub(c.StartedAt) > SaveCheckpointMaxAge:
+		return fmt.Sprintf("it was started more than %s ago", SaveCheckpointMaxAge)
+	case pages != c.Pages:
+		return fmt.Sprintf("the number of pages of stars changed from %d to %d", c.Pages, pages)
+	case newest != c.Newest:
+		return "stars were starred or unstarred since it was started"
+	}
+
+	return ""
+}
+
+// saved reports whether all stars of a page were saved
+func (c *SaveCheckpoint) saved(pageno int) bool {
+	i := sort.SearchInts(c.Saved, pageno)
+
+	return i < len(c.Saved) && c.Saved[i] == pageno
+}
+
+// markSaved records that all stars of a page were saved
+func (c *SaveCheckpoint) markSaved(pageno int) {
+	if !c.saved(pageno) {
+		c.Saved = append(c.Saved, pageno)
+		sort.Ints(c.Saved)
+	}
+}
+
+// SaveCheckpoint returns the checkpoint of an interrupted or failed
+// SaveAllStars, or nil if the last one saved every page
+func (s *StarManager) SaveCheckpoint() (*SaveCheckpoint, error) {
+	value, err := s.store.GetMeta(SaveCheckpointKey)
+	if errors.Is(err, ErrMetaNotFound) || (err == nil && len(value) == 0) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	checkpoint := &SaveCheckpoint{}
+	if err := json.Unmarshal(value, checkpoint); err != nil {
+		return nil, fmt.Errorf("invalid save checkpoint: %w", err)
+	}
+
+	return checkpoint, nil
+}
+
+// saveSaveCheckpoint records the progress of SaveAllStars
+func (s *StarManager) saveSaveCheckpoint(checkpoint *SaveCheckpoint) error {
+	value, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	return s.store.SetMeta(SaveCheckpointKey, value)
+}
+
+// clearSaveCheckpoint marks SaveAllStars as completed, emptying its
+// checkpoint like clearSyncCheckpoint
+func (s *StarManager) clearSaveCheckpoint() error {
+	return s.store.SetMeta(SaveCheckpointKey, []byte{})
+}
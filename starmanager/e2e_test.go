@@ -0,0 +1,225 @@
+package starmanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gkze/gh-stars/transport"
+	"github.com/stretchr/testify/assert"
+)
+
+// e2eRepos hosts a mix of repositories on the fake GitHub, starring all but
+// the last one oldest first, and returns the time they were pushed to
+func e2eRepos(f *fakeGitHub) time.Time {
+	recent := time.Now().AddDate(0, 0, -7).Truncate(time.Second)
+	old := time.Now().AddDate(-1, 0, 0).Truncate(time.Second)
+
+	f.addRepo(
+		&fakeRepo{Owner: "a", Name: "one", Language: "Go", PushedAt: recent, Stargazers: 10, Topics: []string{"cli"}},
+		&fakeRepo{Owner: "b", Name: "two", Language: "Rust", PushedAt: recent, Stargazers: 30, Topics: []string{"cli"}},
+		&fakeRepo{Owner: "c", Name: "three", Language: "Go", PushedAt: old, Stargazers: 20},
+		&fakeRepo{Owner: "d", Name: "four", Language: "Go", PushedAt: recent, Stargazers: 40, Archived: true},
+		&fakeRepo{Owner: "e", Name: "five", Language: "Python", PushedAt: recent, Stargazers: 5},
+		&fakeRepo{Owner: "f", Name: "six", Language: "Go", PushedAt: old, Stargazers: 50},
+		&fakeRepo{Owner: "g", Name: "seven", Language: "Go", PushedAt: recent, Stargazers: 1},
+	)
+
+	for i, name := range []string{"a/one", "b/two", "c/three", "d/four", "e/five", "f/six"} {
+		f.star(name, time.Date(2020, 1, i+1, 0, 0, 0, 0, time.UTC))
+	}
+
+	return recent
+}
+
+func TestE2ESaveAllStars(t *testing.T) {
+	f := newFakeGitHub(t, 4)
+	defer f.Close()
+
+	recent := e2eRepos(f)
+
+	sm, cleanup := f.starManager()
+	defer cleanup()
+
+	assert.NoError(t, sm.SaveAllStars(context.Background(), 2))
+	assert.Equal(t, 2, f.requestCount("GET", "/users/user/starred"))
+
+	stars, err := sm.store.All()
+	assert.NoError(t, err)
+	assert.Len(t, stars, 6)
+
+	star, err := sm.store.Get("https://github.com/a/one")
+	assert.NoError(t, err)
+	assert.Equal(t, "go", star.Language)
+	assert.Equal(t, 10, star.Stargazers)
+	assert.Equal(t, []string{"cli"}, star.Topics)
+	assert.True(t, recent.Equal(star.PushedAt))
+	assert.True(t, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC).Equal(star.StarredAt))
+
+	lastSync, err := sm.LastSync()
+	assert.NoError(t, err)
+	assert.False(t, lastSync.IsZero())
+}
+
+func TestE2EGetStars(t *testing.T) {
+	f := newFakeGitHub(t, 4)
+	defer f.Close()
+
+	e2eRepos(f)
+
+	sm, cleanup := f.starManager()
+	defer cleanup()
+
+	assert.NoError(t, sm.SaveIfEmpty(context.Background(), 2))
+
+	urls := func(stars []*Star) []string {
+		result := []string{}
+		for _, star := range stars {
+			result = append(result, star.URL)
+		}
+
+		return result
+	}
+
+	// The most starred Go repositories come first
+	stars, err := sm.GetStars(3, "go", "", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"https://github.com/f/six",
+		"https://github.com/d/four",
+		"https://github.com/c/three",
+	}, urls(stars))
+
+	stars, err = sm.GetStars(10, "", "cli", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"https://github.com/b/two", "https://github.com/a/one"}, urls(stars))
+
+	stars, err = sm.GetStars(10, "", "", RandomSort)
+	assert.NoError(t, err)
+	assert.Len(t, stars, 6)
+
+	_, err = sm.GetStars(10, "haskell", "", nil)
+	assert.Error(t, err)
+}
+
+func TestE2EStarRepositoriesFromOrg(t *testing.T) {
+	f := newFakeGitHub(t, 2)
+	defer f.Close()
+
+	recent := time.Now().AddDate(0, 0, -7)
+	f.addRepo(
+		&fakeRepo{Owner: "acme", Name: "active", PushedAt: recent},
+		&fakeRepo{Owner: "acme", Name: "archived", PushedAt: recent, Archived: true},
+		&fakeRepo{Owner: "acme", Name: "busy", PushedAt: recent},
+		&fakeRepo{Owner: "acme", Name: "stale", PushedAt: time.Now().AddDate(-1, 0, 0)},
+		&fakeRepo{Owner: "acme", Name: "starred", PushedAt: recent},
+		&fakeRepo{Owner: "other", Name: "repo", PushedAt: recent},
+	)
+	f.star("acme/starred", time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	sm, cleanup := f.starManager()
+	defer cleanup()
+
+	assert.NoError(t, sm.StarRepositoriesFromOrg(context.Background(), "acme", 2, 2))
+
+	// Every page of the org was listed, and only recently pushed, unarchived
+	// repositories that were not starred yet were starred
+	assert.Equal(t, 3, f.requestCount("GET", "/orgs/acme/repos"))
+	assert.Equal(t, []string{"acme/active", "acme/busy", "acme/starred"}, f.starred())
+	assert.Equal(t, 0, f.requestCount("PUT", "/user/starred/acme/starred"))
+	assert.Equal(t, 0, f.requestCount("PUT", "/user/starred/acme/stale"))
+}
+
+func TestE2EStarRepositoriesFromUser(t *testing.T) {
+	f := newFakeGitHub(t, 2)
+	defer f.Close()
+
+	recent := time.Now().AddDate(0, 0, -7)
+	f.addRepo(
+		&fakeRepo{Owner: "octo", Name: "alpha", PushedAt: recent},
+		&fakeRepo{Owner: "octo", Name: "archived", PushedAt: recent, Archived: true},
+		&fakeRepo{Owner: "octo", Name: "beta", PushedAt: recent},
+		&fakeRepo{Owner: "octo", Name: "gamma", PushedAt: recent},
+		&fakeRepo{Owner: "octo", Name: "stale", PushedAt: time.Now().AddDate(-1, 0, 0)},
+		&fakeRepo{Owner: "other", Name: "repo", PushedAt: recent},
+	)
+
+	sm, cleanup := f.starManager()
+	defer cleanup()
+
+	assert.NoError(t, sm.StarRepositoriesFromUser(context.Background(), "octo", 2, 2))
+
+	// Every page of the user's repositories was listed, not just the first
+	assert.Equal(t, 3, f.requestCount("GET", "/users/octo/repos"))
+	assert.Equal(t, []string{"octo/alpha", "octo/beta", "octo/gamma"}, f.starred())
+}
+
+func TestE2ECleanup(t *testing.T) {
+	f := newFakeGitHub(t, 4)
+	defer f.Close()
+
+	e2eRepos(f)
+
+	sm, cleanup := f.starManager()
+	defer cleanup()
+
+	assert.NoError(t, sm.SaveAllStars(context.Background(), 2))
+
+	// Repositories not pushed to in two months are unstarred, while archived
+	// ones are kept unless asked for
+	assert.NoError(t, sm.Cleanup(context.Background(), 2, false, 2))
+	assert.Equal(t, []string{"a/one", "b/two", "d/four", "e/five"}, f.starred())
+
+	count, err := sm.store.Count()
+	assert.NoError(t, err)
+	assert.Equal(t, 4, count)
+
+	assert.NoError(t, sm.Cleanup(context.Background(), 2, true, 2))
+	assert.Equal(t, []string{"a/one", "b/two", "e/five"}, f.starred())
+
+	_, err = sm.store.Get("https://github.com/d/four")
+	assert.ErrorIs(t, err, ErrStarNotFound)
+}
+
+func TestE2ECleanupErrors(t *testing.T) {
+	f := newFakeGitHub(t, 4)
+	defer f.Close()
+
+	e2eRepos(f)
+
+	sm, cleanup := f.starManager()
+	defer cleanup()
+
+	assert.NoError(t, sm.SaveAllStars(context.Background(), 2))
+
+	// A repository that no longer exists cannot be unstarred, which does not
+	// stop the others from being unstarred
+	f.mu.Lock()
+	delete(f.repos, "c/three")
+	f.mu.Unlock()
+
+	err := sm.Cleanup(context.Background(), 2, false, 2)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "could not unstar https://github.com/c/three")
+	assert.NotContains(t, f.starred(), "f/six")
+
+	_, err = sm.store.Get("https://github.com/c/three")
+	assert.NoError(t, err)
+}
+
+func TestE2ERateLimitExhausted(t *testing.T) {
+	f := newFakeGitHub(t, 4)
+	defer f.Close()
+
+	e2eRepos(f)
+	f.setRemaining(0)
+
+	sm, cleanup := f.starManager()
+	defer cleanup()
+
+	// The limit resets in an hour, which is too long to wait
+	err := sm.SaveAllStars(context.Background(), 2)
+	assert.True(t, errors.Is(err, transport.ErrRateLimitExhausted), fmt.Sprint(err))
+}
@@ -0,0 +1,360 @@
+package starmanager
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gkze/gh-stars/auth"
+	"github.com/gkze/gh-stars/transport"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRateLimit is the request quota of the fake GitHub
+const fakeRateLimit = 5000
+
+// fakeRepo is a repository hosted by the fake GitHub
+type fakeRepo struct {
+	Owner       string
+	Name        string
+	Description string
+	Language    string
+	Archived    bool
+	PushedAt    time.Time
+	Stargazers  int
+	Topics      []string
+
+	// Readme is the content of the README, if the repository has one
+	Readme string
+}
+
+// fullName returns the owner/name of the repository
+func (r *fakeRepo) fullName() string {
+	return r.Owner + "/" + r.Name
+}
+
+// htmlURL returns the web URL of the repository
+func (r *fakeRepo) htmlURL() string {
+	return "https://github.com/" + r.fullName()
+}
+
+// json returns the REST API representation of the repository
+func (r *fakeRepo) json() map[string]interface{} {
+	return map[string]interface{}{
+		"name":             r.Name,
+		"full_name":        r.fullName(),
+		"owner":            map[string]interface{}{"login": r.Owner},
+		"html_url":         r.htmlURL(),
+		"description":      r.Description,
+		"language":         r.Language,
+		"archived":         r.Archived,
+		"pushed_at":        r.PushedAt.UTC().Format(time.RFC3339),
+		"stargazers_count": r.Stargazers,
+		"topics":           r.Topics,
+	}
+}
+
+// fakeStar records when the authenticated user starred a repository
+type fakeStar struct {
+	repo      string
+	starredAt time.Time
+}
+
+// fakeGitHub is an in-memory stand-in for the GitHub REST API, serving the
+// endpoints StarManager uses for the authenticated user "user". List
+// endpoints are paginated with Link headers, and every response carries rate
+// limit headers.
+type fakeGitHub struct {
+	t      *testing.T
+	server *httptest.Server
+
+	// perPage caps the page size, as GitHub caps it at 100
+	perPage int
+
+	mu        sync.Mutex
+	repos     map[string]*fakeRepo
+	stars     []fakeStar
+	remaining int
+	requests  map[string]int
+}
+
+// newFakeGitHub starts a fake GitHub serving pages of perPage items
+func newFakeGitHub(t *testing.T, perPage int) *fakeGitHub {
+	f := &fakeGitHub{
+		t:         t,
+		perPage:   perPage,
+		repos:     map[string]*fakeRepo{},
+		remaining: fakeRateLimit,
+		requests:  map[string]int{},
+	}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+
+	return f
+}
+
+// Close shuts the fake GitHub down
+func (f *fakeGitHub) Close() {
+	f.server.Close()
+}
+
+// addRepo hosts repositories on the fake GitHub
+func (f *fakeGitHub) addRepo(repos ...*fakeRepo) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, repo := range repos {
+		f.repos[repo.fullName()] = repo
+	}
+}
+
+// star stars a repository on behalf of the user
+func (f *fakeGitHub) star(fullName string, starredAt time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.stars = append(f.stars, fakeStar{fullName, starredAt})
+}
+
+// starred returns the names of the starred repositories, sorted
+func (f *fakeGitHub) starred() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	names := []string{}
+	for _, star := range f.stars {
+		names = append(names, star.repo)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// requestCount returns how many requests were made for method and path
+func (f *fakeGitHub) requestCount(method, path string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.requests[method+" "+path]
+}
+
+// setRemaining sets how many requests are left before the rate limit is hit
+func (f *fakeGitHub) setRemaining(remaining int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.remaining = remaining
+}
+
+// starManager returns a StarManager for "user" talking to the fake GitHub,
+// backed by an in-memory store, along with a function to clean it up
+func (f *fakeGitHub) starManager() (*StarManager, func()) {
+	mem := auth.NewMemory()
+	mem.Set(GitHubAPIHost, "user", "secret")
+
+	sm, err := NewWithOptions(
+		WithAuth(mem), WithStore(NewMemoryStore()), WithBaseURL(f.server.URL),
+	)
+	assert.NoError(f.t, err)
+
+	return sm, func() { sm.Close() }
+}
+
+// serveHTTP routes requests to the fake endpoints
+func (f *fakeGitHub) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.requests[r.Method+" "+r.URL.Path]++
+
+	reset := time.Now().Add(time.Hour).Unix()
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(fakeRateLimit))
+	w.Header().Set(transport.RateLimitResetHeader, strconv.FormatInt(reset, 10))
+
+	if f.remaining == 0 {
+		w.Header().Set(transport.RateLimitRemainingHeader, "0")
+		http.Error(w, `{"message": "API rate limit exceeded"}`, http.StatusForbidden)
+		return
+	}
+	f.remaining--
+	w.Header().Set(transport.RateLimitRemainingHeader, strconv.Itoa(f.remaining))
+
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		http.Error(w, `{"message": "Bad credentials"}`, http.StatusUnauthorized)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	switch {
+	case r.Method == http.MethodGet && len(parts) == 3 && parts[0] == "users" && parts[2] == "starred":
+		if parts[1] != "user" {
+			http.NotFound(w, r)
+			return
+		}
+
+		items := []interface{}{}
+		for _, star := range f.sortedStars() {
+			items = append(items, map[string]interface{}{
+				"starred_at": star.starredAt.UTC().Format(time.RFC3339),
+				"repo":       f.repos[star.repo].json(),
+			})
+		}
+		f.writePage(w, r, items)
+
+	case len(parts) == 4 && parts[0] == "user" && parts[1] == "starred":
+		f.serveStar(w, r, parts[2]+"/"+parts[3])
+
+	case r.Method == http.MethodGet && len(parts) == 3 && parts[0] == "repos":
+		repo, ok := f.repos[parts[1]+"/"+parts[2]]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		f.writeJSON(w, repo.json())
+
+	case r.Method == http.MethodGet && len(parts) == 4 && parts[0] == "repos" && parts[3] == "readme":
+		repo, ok := f.repos[parts[1]+"/"+parts[2]]
+		if !ok || repo.Readme == "" {
+			http.NotFound(w, r)
+			return
+		}
+		f.writeJSON(w, map[string]interface{}{
+			"type":     "file",
+			"name":     "README.md",
+			"encoding": "base64",
+			"content":  base64.StdEncoding.EncodeToString([]byte(repo.Readme)),
+		})
+
+	case r.Method == http.MethodGet && len(parts) == 3 && parts[2] == "repos" &&
+		(parts[0] == "orgs" || parts[0] == "users"):
+		names := []string{}
+		for name, repo := range f.repos {
+			if repo.Owner == parts[1] {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+
+		items := []interface{}{}
+		for _, name := range names {
+			items = append(items, f.repos[name].json())
+		}
+		f.writePage(w, r, items)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// sortedStars returns the stars, newest first
+func (f *fakeGitHub) sortedStars() []fakeStar {
+	stars := append([]fakeStar{}, f.stars...)
+	sort.SliceStable(stars, func(i, j int) bool {
+		return stars[i].starredAt.After(stars[j].starredAt)
+	})
+
+	return stars
+}
+
+// serveStar stars, unstars or checks the star of a repository
+func (f *fakeGitHub) serveStar(w http.ResponseWriter, r *http.Request, fullName string) {
+	if _, ok := f.repos[fullName]; !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	index := -1
+	for i, star := range f.stars {
+		if star.repo == fullName {
+			index = i
+		}
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if index < 0 {
+			http.NotFound(w, r)
+			return
+		}
+	case http.MethodPut:
+		if index < 0 {
+			f.stars = append(f.stars, fakeStar{fullName, time.Now()})
+		}
+	case http.MethodDelete:
+		if index >= 0 {
+			f.stars = append(f.stars[:index], f.stars[index+1:]...)
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writePage writes the page of items requested with the page and per_page
+// query parameters, linking to the other pages like GitHub does
+func (f *fakeGitHub) writePage(w http.ResponseWriter, r *http.Request, items []interface{}) {
+	query := r.URL.Query()
+
+	perPage, _ := strconv.Atoi(query.Get("per_page"))
+	if perPage <= 0 || perPage > f.perPage {
+		perPage = f.perPage
+	}
+
+	page, _ := strconv.Atoi(query.Get("page"))
+	if page <= 0 {
+		page = 1
+	}
+
+	lastPage := (len(items) + perPage - 1) / perPage
+	if lastPage == 0 {
+		lastPage = 1
+	}
+
+	link := func(page int, rel string) string {
+		u := url.URL{Path: r.URL.Path}
+		q := r.URL.Query()
+		q.Set("page", strconv.Itoa(page))
+		u.RawQuery = q.Encode()
+
+		return fmt.Sprintf(`<%s%s>; rel="%s"`, f.server.URL, u.String(), rel)
+	}
+
+	links := []string{}
+	if page < lastPage {
+		links = append(links, link(page+1, "next"), link(lastPage, "last"))
+	}
+	if page > 1 {
+		links = append(links, link(1, "first"), link(page-1, "prev"))
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+
+	start := (page - 1) * perPage
+	if start > len(items) {
+		start = len(items)
+	}
+	end := start + perPage
+	if end > len(items) {
+		end = len(items)
+	}
+
+	f.writeJSON(w, items[start:end])
+}
+
+// writeJSON writes value as the JSON response body
+func (f *fakeGitHub) writeJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	assert.NoError(f.t, json.NewEncoder(w).Encode(value))
+}
@@ -0,0 +1,71 @@
+package starmanager
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// Fetcher lists the authenticated user's stars page by page, newest first
+type Fetcher interface {
+	// FetchPage returns the page of stars at cursor (empty for the first
+	// page), along with the cursor of the next page, which is empty after the
+	// last page
+	FetchPage(ctx context.Context, cursor string) ([]*Star, string, error)
+
+	// Name identifies the API the stars are listed with
+	Name() string
+}
+
+// RESTFetcher is a Fetcher using the REST API. Its cursors are page numbers.
+type RESTFetcher struct {
+	sm *StarManager
+}
+
+// RESTFetcher returns a Fetcher listing stars through the REST API
+func (s *StarManager) RESTFetcher() *RESTFetcher {
+	return &RESTFetcher{sm: s}
+}
+
+// Name satisfies Fetcher for RESTFetcher
+func (f *RESTFetcher) Name() string {
+	return "REST"
+}
+
+// FetchPage satisfies Fetcher for RESTFetcher
+func (f *RESTFetcher) FetchPage(ctx context.Context, cursor string) ([]*Star, string, error) {
+	pageno := 1
+	if cursor != "" {
+		var err error
+		if pageno, err = strconv.Atoi(cursor); err != nil {
+			return nil, "", fmt.Errorf("invalid page cursor %q: %w", cursor, err)
+		}
+	}
+
+	page, response, err := f.sm.listStarredPage(ctx, pageno)
+	if err != nil {
+		return nil, "", err
+	}
+
+	syncedAt := f.sm.now()
+
+	stars := make([]*Star, 0, len(page))
+	for _, starred := range page {
+		star, err := f.sm.newRESTStar(starred.GetRepository(), starred.GetStarredAt().Time, syncedAt)
+		if err != nil {
+			return nil, "", err
+		}
+
+		stars = append(stars, star)
+	}
+
+	next := ""
+	if response.NextPage != 0 {
+		next = strconv.Itoa(response.NextPage)
+	}
+
+	return stars, next, nil
+}
+
+// Compile-time interface satisfaction check
+var _ Fetcher = (*RESTFetcher)(nil)
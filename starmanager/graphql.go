@@ -0,0 +1,255 @@
+package starmanager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// starredRepositoriesQuery lists a page of the viewer's stars, newest first,
+// with everything a Star holds
+const starredRepositoriesQuery = `
+query($first: Int!, $cursor: String) {
+  viewer {
+    starredRepositories(
+      first: $first, after: $cursor, orderBy: {field: STARRED_AT, direction: DESC}
+    ) {
+      pageInfo {
+        hasNextPage
+        endCursor
+      }
+      edges {
+        starredAt
+        node {
+          url
+          description
+          isArchived
+          pushedAt
+          diskUsage
+          primaryLanguage { name }
+          stargazers { totalCount }
+          repositoryTopics(first: 100) { nodes { topic { name } } }
+          licenseInfo { spdxId }
+          parent { url }
+          latestRelease { tagName }
+          issues(states: OPEN) { totalCount }
+        }
+      }
+    }
+  }
+}`
+
+// graphQLRepository is a repository as returned by starredRepositoriesQuery
+type graphQLRepository struct {
+	URL             string     `json:"url"`
+	Description     string     `json:"description"`
+	IsArchived      bool       `json:"isArchived"`
+	PushedAt        *time.Time `json:"pushedAt"`
+	DiskUsage       int        `json:"diskUsage"`
+	PrimaryLanguage *struct {
+		Name string `json:"name"`
+	} `json:"primaryLanguage"`
+	Stargazers struct {
+		TotalCount int `json:"totalCount"`
+	} `json:"stargazers"`
+	RepositoryTopics struct {
+		Nodes []struct {
+			Topic struct {
+				Name string `json:"name"`
+			} `json:"topic"`
+		} `json:"nodes"`
+	} `json:"repositoryTopics"`
+	LicenseInfo *struct {
+		SPDXID string `json:"spdxId"`
+	} `json:"licenseInfo"`
+	Parent *struct {
+		URL string `json:"url"`
+	} `json:"parent"`
+	LatestRelease *struct {
+		TagName string `json:"tagName"`
+	} `json:"latestRelease"`
+	Issues struct {
+		TotalCount int `json:"totalCount"`
+	} `json:"issues"`
+}
+
+// star converts the repository, fetched at syncedAt, to a Star
+func (r *graphQLRepository) star(starredAt, syncedAt time.Time) *Star {
+	star := &Star{
+		StarredAt:   starredAt,
+		URL:         r.URL,
+		Description: r.Description,
+		Archived:    r.IsArchived,
+		DiskUsage:   r.DiskUsage,
+		Stargazers:  r.Stargazers.TotalCount,
+		OpenIssues:  r.Issues.TotalCount,
+		SyncedAt:    syncedAt,
+	}
+
+	if r.PushedAt != nil {
+		star.PushedAt = *r.PushedAt
+	}
+	if r.PrimaryLanguage != nil {
+		star.Language = strings.ToLower(r.PrimaryLanguage.Name)
+	}
+	for _, node := range r.RepositoryTopics.Nodes {
+		star.Topics = append(star.Topics, node.Topic.Name)
+	}
+	if r.LicenseInfo != nil {
+		star.License = r.LicenseInfo.SPDXID
+	}
+	if r.Parent != nil {
+		star.Parent = r.Parent.URL
+	}
+	if r.LatestRelease != nil {
+		star.LatestRelease = r.LatestRelease.TagName
+	}
+
+	return star
+}
+
+// graphQLResponse is the response to starredRepositoriesQuery
+type graphQLResponse struct {
+	Data struct {
+		Viewer struct {
+			StarredRepositories struct {
+				PageInfo struct {
+					HasNextPage bool   `json:"hasNextPage"`
+					EndCursor   string `json:"endCursor"`
+				} `json:"pageInfo"`
+				Edges []struct {
+					StarredAt time.Time         `json:"starredAt"`
+					Node      graphQLRepository `json:"node"`
+				} `json:"edges"`
+			} `json:"starredRepositories"`
+		} `json:"viewer"`
+	} `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// GraphQLFetcher is a Fetcher using the GraphQL API, which returns the
+// extended repository metadata (license, fork parent, latest release and open
+// issues) along with each star. Its cursors are GraphQL connection cursors.
+type GraphQLFetcher struct {
+	client   *http.Client
+	endpoint string
+	log      *log.Logger
+	now      func() time.Time
+}
+
+// NewGraphQLFetcher creates a GraphQLFetcher sending queries to endpoint with
+// client, which must add the authentication header
+func NewGraphQLFetcher(client *http.Client, endpoint string) *GraphQLFetcher {
+	return &GraphQLFetcher{
+		client:   client,
+		endpoint: endpoint,
+		log:      log.StandardLogger(),
+		now:      time.Now,
+	}
+}
+
+// graphQLEndpoint returns the GraphQL endpoint for a REST API base URL:
+// https://api.github.com/graphql for github.com and https://<host>/api/graphql
+// for GitHub Enterprise Server, whose REST API lives under /api/v3/
+func graphQLEndpoint(baseURL *url.URL) string {
+	return baseURL.ResolveReference(&url.URL{Path: "../graphql"}).String()
+}
+
+// GraphQLFetcher returns a Fetcher listing stars through the GraphQL API
+func (s *StarManager) GraphQLFetcher() *GraphQLFetcher {
+	fetcher := NewGraphQLFetcher(s.httpClient, graphQLEndpoint(s.client.BaseURL))
+	fetcher.log = s.log
+	fetcher.now = s.now
+
+	return fetcher
+}
+
+// Name satisfies Fetcher for GraphQLFetcher
+func (f *GraphQLFetcher) Name() string {
+	return "GraphQL"
+}
+
+// FetchPage satisfies Fetcher for GraphQLFetcher
+func (f *GraphQLFetcher) FetchPage(ctx context.Context, cursor string) ([]*Star, string, error) {
+	variables := map[string]interface{}{"first": PageSize}
+	if cursor != "" {
+		variables["cursor"] = cursor
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"query":     starredRepositoriesQuery,
+		"variables": variables,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodPost, f.endpoint, bytes.NewReader(body),
+	)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	f.log.Infof("Fetching stars after cursor %q with GraphQL...\n", cursor)
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	contents, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf(
+			"GraphQL query failed with %s: %s", resp.Status, bytes.TrimSpace(contents),
+		)
+	}
+
+	result := &graphQLResponse{}
+	if err := json.Unmarshal(contents, result); err != nil {
+		return nil, "", fmt.Errorf("could not decode GraphQL response: %w", err)
+	}
+
+	if len(result.Errors) > 0 {
+		messages := []string{}
+		for _, e := range result.Errors {
+			messages = append(messages, e.Message)
+		}
+
+		return nil, "", fmt.Errorf("GraphQL query failed: %s", strings.Join(messages, "; "))
+	}
+
+	connection := result.Data.Viewer.StarredRepositories
+
+	syncedAt := f.now()
+
+	stars := make([]*Star, 0, len(connection.Edges))
+	for _, edge := range connection.Edges {
+		stars = append(stars, edge.Node.star(edge.StarredAt, syncedAt))
+	}
+
+	next := ""
+	if connection.PageInfo.HasNextPage {
+		next = connection.PageInfo.EndCursor
+	}
+
+	return stars, next, nil
+}
+
+// Compile-time interface satisfaction check
+var _ Fetcher = (*GraphQLFetcher)(nil)
@@ -0,0 +1,194 @@
+package starmanager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// serveGraphQL points the StarManager at a test server answering star queries
+// with the recorded pages in testdata/graphql. It returns the server and the
+// cursors the pages were requested with.
+func serveGraphQL(t *testing.T, sm *StarManager) (*httptest.Server, *[]string) {
+	pages := map[string]string{
+		"": "page1.json",
+		"Y3Vyc29yOnYyOpK5MjAyMC0wMS0wMlQwMDowMDowMFo=": "page2.json",
+	}
+	cursors := []string{}
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/graphql", r.URL.Path)
+			assert.Equal(t, http.MethodPost, r.Method)
+
+			request := struct {
+				Query     string `json:"query"`
+				Variables struct {
+					First  int    `json:"first"`
+					Cursor string `json:"cursor"`
+				} `json:"variables"`
+			}{}
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+			assert.Contains(t, request.Query, "starredRepositories")
+			assert.Equal(t, PageSize, request.Variables.First)
+
+			cursors = append(cursors, request.Variables.Cursor)
+
+			page, ok := pages[request.Variables.Cursor]
+			if !ok {
+				fmt.Fprint(w, `{"data": null, "errors": [{"message": "invalid cursor"}]}`)
+				return
+			}
+
+			contents, err := ioutil.ReadFile(filepath.Join("testdata", "graphql", page))
+			assert.NoError(t, err)
+			w.Write(contents)
+		},
+	))
+
+	baseURL, err := url.Parse(server.URL + "/")
+	assert.NoError(t, err)
+	sm.client.BaseURL = baseURL
+
+	return server, &cursors
+}
+
+func TestGraphQLEndpoint(t *testing.T) {
+	for baseURL, endpoint := range map[string]string{
+		"https://api.github.com/":         "https://api.github.com/graphql",
+		"https://ghe.example.com/api/v3/": "https://ghe.example.com/api/graphql",
+	} {
+		u, err := url.Parse(baseURL)
+		assert.NoError(t, err)
+		assert.Equal(t, endpoint, graphQLEndpoint(u))
+	}
+}
+
+func TestGraphQLFetcher(t *testing.T) {
+	sm, cleanup := newTestStarManager(t)
+	defer cleanup()
+
+	server, cursors := serveGraphQL(t, sm)
+	defer server.Close()
+
+	fetcher := sm.GraphQLFetcher()
+
+	stars, next, err := fetcher.FetchPage(context.Background(), "")
+	assert.NoError(t, err)
+	assert.Equal(t, "Y3Vyc29yOnYyOpK5MjAyMC0wMS0wMlQwMDowMDowMFo=", next)
+	assert.Len(t, stars, 2)
+
+	three := stars[0]
+	assert.Equal(t, "https://github.com/c/three", three.URL)
+	assert.Equal(t, "A fork of two", three.Description)
+	assert.Equal(t, "go", three.Language)
+	assert.Equal(t, []string{"cli", "github"}, three.Topics)
+	assert.Equal(t, 30, three.Stargazers)
+	assert.Equal(t, "MIT", three.License)
+	assert.Equal(t, "https://github.com/b/two", three.Parent)
+	assert.Equal(t, 2048, three.DiskUsage)
+	assert.Equal(t, "v1.2.0", three.LatestRelease)
+	assert.Equal(t, 4, three.OpenIssues)
+	assert.True(t, syncTime(3).Equal(three.StarredAt))
+	assert.False(t, three.SyncedAt.IsZero())
+
+	two := stars[1]
+	assert.True(t, two.Archived)
+	assert.Empty(t, two.License)
+	assert.Empty(t, two.Parent)
+	assert.Empty(t, two.LatestRelease)
+
+	stars, next, err = fetcher.FetchPage(context.Background(), next)
+	assert.NoError(t, err)
+	assert.Empty(t, next)
+	assert.Len(t, stars, 1)
+	assert.Empty(t, stars[0].Language)
+	assert.True(t, stars[0].PushedAt.IsZero())
+
+	// GraphQL errors are reported even though the status is 200
+	_, _, err = fetcher.FetchPage(context.Background(), "bogus")
+	assert.EqualError(t, err, "GraphQL query failed: invalid cursor")
+
+	assert.Equal(t, []string{"", "Y3Vyc29yOnYyOpK5MjAyMC0wMS0wMlQwMDowMDowMFo=", "bogus"}, *cursors)
+}
+
+func TestSyncGraphQL(t *testing.T) {
+	sm, cleanup := newTestStarManager(t)
+	defer cleanup()
+
+	server, cursors := serveGraphQL(t, sm)
+	defer server.Close()
+
+	// An empty cache is filled page by page
+	result, err := sm.Sync(context.Background(), SyncOptions{Fetcher: sm.GraphQLFetcher()})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"https://github.com/c/three",
+		"https://github.com/b/two",
+		"https://github.com/a/one",
+	}, result.Added)
+	assert.Len(t, *cursors, 2)
+
+	star, err := sm.store.Get("https://github.com/a/one")
+	assert.NoError(t, err)
+	assert.Equal(t, "Apache-2.0", star.License)
+	assert.Equal(t, 1, star.OpenIssues)
+
+	// Nothing changed, so a full sync only lists the stars again
+	result, err = sm.Sync(context.Background(), SyncOptions{Fetcher: sm.GraphQLFetcher(), Full: true})
+	assert.NoError(t, err)
+	assert.Empty(t, result.Added)
+	assert.Empty(t, result.Updated)
+	assert.Empty(t, result.Removed)
+}
+
+func TestSyncRESTAfterGraphQL(t *testing.T) {
+	sm, cleanup := newTestStarManager(t)
+	defer cleanup()
+
+	server, _ := serveGraphQL(t, sm)
+	_, err := sm.Sync(context.Background(), SyncOptions{Fetcher: sm.GraphQLFetcher()})
+	server.Close()
+	assert.NoError(t, err)
+
+	assertGraphQLFields := func() {
+		star, err := sm.store.Get("https://github.com/c/three")
+		assert.NoError(t, err)
+		assert.Equal(t, "https://github.com/b/two", star.Parent)
+		assert.Equal(t, "v1.2.0", star.LatestRelease)
+		assert.Equal(t, 4, star.OpenIssues)
+	}
+
+	// The REST API does not return the metadata only fetched through
+	// GraphQL, so listing stars with it keeps what was cached
+	server, _ = serveStars(t, sm, map[string]int{"https://github.com/c/three": 31})
+	defer server.Close()
+
+	_, err = sm.Sync(context.Background(), SyncOptions{Full: true})
+	assert.NoError(t, err)
+	assertGraphQLFields()
+
+	// So does refreshing stale stars
+	star, err := sm.store.Get("https://github.com/c/three")
+	assert.NoError(t, err)
+	star.SyncedAt = time.Now().Add(-2 * DefaultStaleAfter)
+	assert.NoError(t, sm.store.Save(star))
+
+	result, err := sm.Sync(context.Background(), SyncOptions{StaleAfter: DefaultStaleAfter})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"https://github.com/c/three"}, result.Updated)
+	assertGraphQLFields()
+
+	star, err = sm.store.Get("https://github.com/c/three")
+	assert.NoError(t, err)
+	assert.Equal(t, 31, star.Stargazers)
+}
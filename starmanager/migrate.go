@@ -0,0 +1,202 @@
+package starmanager
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// SchemaVersionKey is the metadata key the cache schema version is stored
+// under
+const SchemaVersionKey string = "schema_version"
+
+// Migration upgrades cached stars from the previous schema version to Version
+type Migration struct {
+	// Version is the schema version the cache is at once the migration has
+	// been applied
+	Version int
+
+	// Description is a short, human-readable summary of the migration
+	Description string
+
+	// Apply upgrades a single star in place at time now, reporting whether it
+	// changed
+	Apply func(star *Star, now time.Time) bool
+}
+
+// migrations is the registry of schema migrations, in ascending version
+// order. Append new migrations to the end; never modify or reorder existing
+// ones, as caches in the wild may be at any of their versions.
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "Lowercase languages",
+		Apply: func(star *Star, now time.Time) bool {
+			language := strings.ToLower(star.Language)
+			if language == star.Language {
+				return false
+			}
+
+			star.Language = language
+
+			return true
+		},
+	},
+	{
+		// Stars saved before sync times were tracked are assumed to be fresh,
+		// so that the first sync does not refresh every single one of them
+		Version:     2,
+		Description: "Record sync times",
+		Apply: func(star *Star, now time.Time) bool {
+			if !star.SyncedAt.IsZero() {
+				return false
+			}
+
+			star.SyncedAt = now
+
+			return true
+		},
+	},
+}
+
+// CurrentSchemaVersion is the schema version of caches written by this
+// version of stars
+var CurrentSchemaVersion = migrations[len(migrations)-1].Version
+
+// MigrationStep reports the effect of a single migration
+type MigrationStep struct {
+	// Version is the schema version the migration upgrades to
+	Version int
+
+	// Description is the description of the migration
+	Description string
+
+	// Changed lists the URLs of the stars the migration modified
+	Changed []string
+}
+
+// MigrationReport summarizes a (possibly dry) migration run
+type MigrationReport struct {
+	// From is the schema version the cache was at
+	From int
+
+	// To is the schema version the cache is (or would be) at
+	To int
+
+	// Steps are the migrations that were (or would be) applied
+	Steps []MigrationStep
+}
+
+// SchemaVersion returns the schema version of a store. Stores written before
+// the schema was versioned are at version 0.
+func SchemaVersion(store Store) (int, error) {
+	value, err := store.GetMeta(SchemaVersionKey)
+	if errors.Is(err, ErrMetaNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	version, err := strconv.Atoi(string(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid schema version %q: %w", value, err)
+	}
+
+	return version, nil
+}
+
+// Migrate upgrades a store to CurrentSchemaVersion by applying all pending
+// migrations in order. With dryRun set, nothing is written and the report
+// describes what would change.
+func Migrate(store Store, dryRun bool) (*MigrationReport, error) {
+	return migrate(log.StandardLogger(), time.Now, store, dryRun)
+}
+
+// migrate implements Migrate, logging to logger and telling the time with
+// clock
+func migrate(
+	logger *log.Logger, clock func() time.Time, store Store, dryRun bool,
+) (*MigrationReport, error) {
+	from, err := SchemaVersion(store)
+	if err != nil {
+		return nil, err
+	}
+
+	if from > CurrentSchemaVersion {
+		return nil, fmt.Errorf(
+			"cache schema version %d is newer than the supported version %d, please upgrade stars",
+			from, CurrentSchemaVersion,
+		)
+	}
+
+	report := &MigrationReport{From: from, To: CurrentSchemaVersion}
+	if from == CurrentSchemaVersion {
+		return report, nil
+	}
+
+	stars, err := store.All()
+	if err != nil {
+		return nil, err
+	}
+
+	now := clock()
+	changed := map[string]*Star{}
+	for _, migration := range migrations {
+		if migration.Version <= from {
+			continue
+		}
+
+		step := MigrationStep{
+			Version:     migration.Version,
+			Description: migration.Description,
+			Changed:     []string{},
+		}
+
+		// Later migrations see the results of earlier ones, so that dry runs
+		// report the same changes a real run would make
+		for _, star := range stars {
+			if migration.Apply(star, now) {
+				step.Changed = append(step.Changed, star.URL)
+				changed[star.URL] = star
+			}
+		}
+
+		report.Steps = append(report.Steps, step)
+	}
+
+	if dryRun {
+		return report, nil
+	}
+
+	for _, star := range changed {
+		if err := store.Save(star); err != nil {
+			return nil, fmt.Errorf("could not save migrated star %s: %w", star.URL, err)
+		}
+	}
+
+	err = store.SetMeta(SchemaVersionKey, []byte(strconv.Itoa(CurrentSchemaVersion)))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, step := range report.Steps {
+		logger.Debugf(
+			"Applied migration %d (%s): %d stars changed\n",
+			step.Version, step.Description, len(step.Changed),
+		)
+	}
+
+	if len(changed) > 0 {
+		logger.Infof(
+			"Migrated cache from schema version %d to %d (%d stars changed)\n",
+			from, CurrentSchemaVersion, len(changed),
+		)
+	}
+
+	return report, nil
+}
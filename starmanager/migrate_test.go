@@ -0,0 +1,112 @@
+package starmanager
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gkze/gh-stars/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+// legacyStore returns a store as written before the schema was versioned
+func legacyStore(t *testing.T) *MemoryStore {
+	store := NewMemoryStore()
+
+	for _, star := range []*Star{
+		{URL: "https://github.com/a/one", Language: "Go"},
+		{URL: "https://github.com/b/two", Language: "rust"},
+		{URL: "https://github.com/c/three", Language: "TypeScript"},
+	} {
+		assert.NoError(t, store.Save(star))
+	}
+
+	return store
+}
+
+func TestMigrateDryRun(t *testing.T) {
+	store := legacyStore(t)
+
+	report, err := Migrate(store, true)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, report.From)
+	assert.Equal(t, CurrentSchemaVersion, report.To)
+	assert.Len(t, report.Steps, len(migrations))
+	assert.Equal(t, []string{
+		"https://github.com/a/one", "https://github.com/c/three",
+	}, report.Steps[0].Changed)
+
+	// Nothing must have been written
+	version, err := SchemaVersion(store)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, version)
+
+	star, err := store.Get("https://github.com/a/one")
+	assert.NoError(t, err)
+	assert.Equal(t, "Go", star.Language)
+}
+
+func TestMigrate(t *testing.T) {
+	store := legacyStore(t)
+
+	_, err := Migrate(store, false)
+	assert.NoError(t, err)
+
+	version, err := SchemaVersion(store)
+	assert.NoError(t, err)
+	assert.Equal(t, CurrentSchemaVersion, version)
+
+	stars, err := store.Query(Filter{Language: "go"})
+	assert.NoError(t, err)
+	assert.Len(t, stars, 1)
+
+	// Migrating again is a no-op
+	report, err := Migrate(store, false)
+	assert.NoError(t, err)
+	assert.Equal(t, CurrentSchemaVersion, report.From)
+	assert.Empty(t, report.Steps)
+}
+
+func TestMigrateNewerSchema(t *testing.T) {
+	store := NewMemoryStore()
+	assert.NoError(t, store.SetMeta(
+		SchemaVersionKey, []byte(strconv.Itoa(CurrentSchemaVersion+1)),
+	))
+
+	_, err := Migrate(store, false)
+	assert.Error(t, err)
+
+	assert.NoError(t, store.SetMeta(SchemaVersionKey, []byte("bogus")))
+
+	_, err = SchemaVersion(store)
+	assert.Error(t, err)
+}
+
+func TestMigrateOnOpen(t *testing.T) {
+	mem := auth.NewMemory()
+	mem.Set(GitHubAPIHost, "user", "secret")
+
+	store := legacyStore(t)
+	sm, err := NewWithConfig(&Config{Auth: mem, Store: store, SkipMigrations: true})
+	assert.NoError(t, err)
+
+	version, err := SchemaVersion(sm.Store())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, version)
+
+	// Migrations tell the time with the StarManager's clock
+	now := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	sm, err = NewWithOptions(
+		WithAuth(mem), WithStore(store), WithClock(func() time.Time { return now }),
+	)
+	assert.NoError(t, err)
+	defer sm.Close()
+
+	version, err = SchemaVersion(sm.Store())
+	assert.NoError(t, err)
+	assert.Equal(t, CurrentSchemaVersion, version)
+
+	star, err := sm.Store().Get("https://github.com/a/one")
+	assert.NoError(t, err)
+	assert.True(t, now.Equal(star.SyncedAt))
+}
@@ -0,0 +1,109 @@
+package starmanager
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gkze/gh-stars/auth"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+)
+
+// Option configures a StarManager constructed with NewWithOptions
+type Option func(*options)
+
+// options holds the settings of NewWithOptions
+type options struct {
+	host           string
+	profile        string
+	backend        string
+	cacheFile      string
+	skipMigrations bool
+	auth           auth.Interface
+	httpClient     *http.Client
+	baseURL        string
+	store          Store
+	logger         *log.Logger
+	clock          func() time.Time
+	fs             afero.Fs
+}
+
+// WithHost sets the GitHub web host, e.g. github.com (the default) or the
+// hostname of a GitHub Enterprise Server instance. An empty host is ignored.
+func WithHost(host string) Option {
+	return func(o *options) {
+		if host != "" {
+			o.host = host
+		}
+	}
+}
+
+// WithProfile sets the name of the account profile in use, which gets its own
+// cache
+func WithProfile(profile string) Option {
+	return func(o *options) { o.profile = profile }
+}
+
+// WithBackend sets the storage backend of the cache, BackendStorm (the
+// default) or BackendSQLite
+func WithBackend(backend string) Option {
+	return func(o *options) { o.backend = backend }
+}
+
+// WithCacheFile sets the path to the cache. If not set, it defaults to
+// DefaultCachePath for the host, profile and backend.
+func WithCacheFile(path string) Option {
+	return func(o *options) { o.cacheFile = path }
+}
+
+// WithSkipMigrations leaves the cache at its current schema version instead of
+// upgrading it on open
+func WithSkipMigrations(skip bool) Option {
+	return func(o *options) { o.skipMigrations = skip }
+}
+
+// WithAuth sets the provider of the credentials for the GitHub API host
+func WithAuth(a auth.Interface) Option {
+	return func(o *options) { o.auth = a }
+}
+
+// WithHTTPClient sets the HTTP client used for GitHub API requests. Requests
+// are authenticated, cached and rate limited before being sent with the
+// client's transport (or http.DefaultTransport if it has none). A nil client
+// is ignored.
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *options) {
+		if client != nil {
+			o.httpClient = client
+		}
+	}
+}
+
+// WithBaseURL overrides the base URL of the GitHub REST API, which otherwise
+// follows from the host. The GraphQL endpoint is derived from it.
+func WithBaseURL(baseURL string) Option {
+	return func(o *options) { o.baseURL = baseURL }
+}
+
+// WithStore sets where stars are persisted, instead of opening a database at
+// the cache file
+func WithStore(store Store) Option {
+	return func(o *options) { o.store = store }
+}
+
+// WithLogger sets the logger, which defaults to the global logrus logger
+func WithLogger(logger *log.Logger) Option {
+	return func(o *options) { o.logger = logger }
+}
+
+// WithClock sets the source of the current time, which defaults to time.Now
+func WithClock(now func() time.Time) Option {
+	return func(o *options) { o.clock = now }
+}
+
+// WithFs sets the filesystem the cache file is inspected on (see CacheInfo).
+// Databases can only be opened on the OS filesystem, so any other requires a
+// store to be given with WithStore.
+func WithFs(fs afero.Fs) Option {
+	return func(o *options) { o.fs = fs }
+}
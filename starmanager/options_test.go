@@ -0,0 +1,129 @@
+package starmanager
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gkze/gh-stars/auth"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingTransport counts the requests it sends
+type countingTransport struct {
+	requests int
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests++
+
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestNewWithOptionsRequiresAuth(t *testing.T) {
+	_, err := NewWithOptions(WithStore(NewMemoryStore()))
+	assert.EqualError(t, err, "no auth provider configured")
+}
+
+func TestNewWithOptions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/api/users/user/starred", r.URL.Path)
+			assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+
+			fmt.Fprint(w, `[
+				{"starred_at": "2020-01-01T00:00:00Z", "repo": {"html_url": "https://github.com/a/one"}}
+			]`)
+		},
+	))
+	defer server.Close()
+
+	mem := auth.NewMemory()
+	mem.Set(GitHubAPIHost, "user", "secret")
+
+	buf := &bytes.Buffer{}
+	logger := log.New()
+	logger.SetOutput(buf)
+
+	now := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	counter := &countingTransport{}
+	level := log.GetLevel()
+
+	sm, err := NewWithOptions(
+		WithAuth(mem),
+		WithStore(NewMemoryStore()),
+		WithHTTPClient(&http.Client{Transport: counter}),
+		WithBaseURL(server.URL+"/api"),
+		WithLogger(logger),
+		WithClock(func() time.Time { return now }),
+	)
+	assert.NoError(t, err)
+	defer sm.Close()
+
+	assert.NoError(t, sm.SaveAllStars(context.Background(), 1))
+	assert.Equal(t, 1, counter.requests)
+
+	star, err := sm.store.Get("https://github.com/a/one")
+	assert.NoError(t, err)
+	assert.True(t, now.Equal(star.SyncedAt))
+
+	lastSync, err := sm.LastSync()
+	assert.NoError(t, err)
+	assert.True(t, now.Equal(lastSync))
+
+	// Logs go to the given logger, and global state is left alone
+	assert.Contains(t, buf.String(), "Saved https://github.com/a/one")
+	assert.Equal(t, level, log.GetLevel())
+}
+
+func TestNewWithOptionsFs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stars-starmanager")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, CacheFile)
+
+	store, err := OpenStormStore(path)
+	assert.NoError(t, err)
+
+	fs := afero.NewMemMapFs()
+	assert.NoError(t, afero.WriteFile(fs, path, []byte("12345"), 0600))
+
+	mem := auth.NewMemory()
+	mem.Set(GitHubAPIHost, "user", "secret")
+
+	sm, err := NewWithOptions(WithAuth(mem), WithStore(store), WithFs(fs))
+	assert.NoError(t, err)
+	defer sm.Close()
+
+	info, err := sm.CacheInfo()
+	assert.NoError(t, err)
+	assert.Equal(t, path, info.Path)
+	assert.Equal(t, int64(5), info.Size)
+
+	// Databases cannot be opened on other filesystems
+	_, err = NewWithOptions(WithAuth(mem), WithCacheFile(path), WithFs(fs))
+	assert.Error(t, err)
+
+	// Failing to create the cache is an error
+	_, err = NewWithOptions(WithAuth(mem), WithCacheFile(filepath.Join(path, "stars.db")))
+	assert.Error(t, err)
+}
+
+func TestNewWithOptionsNilHTTPClient(t *testing.T) {
+	mem := auth.NewMemory()
+	mem.Set(GitHubAPIHost, "user", "secret")
+
+	sm, err := NewWithOptions(WithAuth(mem), WithStore(NewMemoryStore()), WithHTTPClient(nil))
+	assert.NoError(t, err)
+	sm.Close()
+}
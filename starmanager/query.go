@@ -0,0 +1,464 @@
+package starmanager
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Query is a parsed query expression selecting stars, such as
+//
+//	language:go,rust topic:cli stars:>500 pushed:>2024-01 -archived desc:~"parser"
+//
+// A query is a list of terms, all of which a star must match. Terms can be
+// combined with OR instead, negated with a leading - (or NOT) and grouped with
+// parentheses. Each term is one of:
+//
+//	field:value       the field equals the value (case-insensitively)
+//	field:a,b         the field equals any of the values
+//	field:~value      the field contains the value (case-insensitively)
+//	field:>value      the field is greater than the value (also >=, < and <=)
+//	field:low..high   the field is between low and high, inclusive (* leaves
+//	                  an end open)
+//	field             the boolean field is true
+//	text              the name, description or a topic contains the text
+//
+// Values containing spaces or special characters can be "double quoted". Dates
+// are written as YYYY, YYYY-MM, YYYY-MM-DD or RFC 3339 timestamps, and compare
+// with the whole period they name: pushed:>2024-01 matches stars pushed after
+// January 2024. Stars with unknown dates never match terms about them.
+//
+// The fields are archived, desc, fork, issues, language, license, name (the
+// owner/name of the repository), parent, pushed, release, size, starred, stars,
+// synced, topic and url.
+type Query struct {
+	root queryNode
+}
+
+// ParseQuery parses a query expression. An empty expression matches every
+// star. Errors are *QueryError.
+func ParseQuery(text string) (*Query, error) {
+	p := &queryParser{text: text, runes: []rune(text)}
+
+	root, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Query{root: root}, nil
+}
+
+// Match reports whether a star satisfies the query
+func (q *Query) Match(star *Star) bool {
+	if q == nil || q.root == nil {
+		return true
+	}
+
+	return q.root.match(star)
+}
+
+// String returns the query in a normalized form, which parses to the same
+// query
+func (q *Query) String() string {
+	if q == nil || q.root == nil {
+		return ""
+	}
+
+	return q.root.String()
+}
+
+// QueryError is an error in a query expression
+type QueryError struct {
+	// Query is the expression
+	Query string
+
+	// Column is the position of the error in the expression, counting
+	// characters from 1
+	Column int
+
+	// Message describes the error
+	Message string
+}
+
+// Error satisfies error for QueryError
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("invalid query at column %d: %s", e.Column, e.Message)
+}
+
+// fieldKind is the type of the values of a query field
+type fieldKind int
+
+const (
+	kindText fieldKind = iota
+	kindList
+	kindNumber
+	kindTime
+	kindFlag
+)
+
+// queryField is a property of stars that query terms can select on. Exactly
+// one of the accessors is set, according to the kind.
+type queryField struct {
+	name string
+	kind fieldKind
+
+	text   func(*Star) string
+	list   func(*Star) []string
+	number func(*Star) int
+	time   func(*Star) time.Time
+	flag   func(*Star) bool
+}
+
+// queryFields are the fields of query terms, by name
+var queryFields = map[string]*queryField{}
+
+// queryFieldAliases map alternative names of fields to their names
+var queryFieldAliases = map[string]string{
+	"description":    "desc",
+	"disk_usage":     "size",
+	"lang":           "language",
+	"latest_release": "release",
+	"open_issues":    "issues",
+	"repo":           "name",
+	"stargazers":     "stars",
+	"topics":         "topic",
+}
+
+func init() {
+	for _, field := range []*queryField{
+		{name: "archived", kind: kindFlag, flag: func(s *Star) bool { return s.Archived }},
+		{name: "desc", kind: kindText, text: func(s *Star) string { return s.Description }},
+		{name: "fork", kind: kindFlag, flag: func(s *Star) bool { return s.Parent != "" }},
+		{name: "issues", kind: kindNumber, number: func(s *Star) int { return s.OpenIssues }},
+		{name: "language", kind: kindText, text: func(s *Star) string { return s.Language }},
+		{name: "license", kind: kindText, text: func(s *Star) string { return s.License }},
+		{name: "name", kind: kindText, text: starName},
+		{name: "parent", kind: kindText, text: func(s *Star) string { return s.Parent }},
+		{name: "pushed", kind: kindTime, time: func(s *Star) time.Time { return s.PushedAt }},
+		{name: "release", kind: kindText, text: func(s *Star) string { return s.LatestRelease }},
+		{name: "size", kind: kindNumber, number: func(s *Star) int { return s.DiskUsage }},
+		{name: "starred", kind: kindTime, time: func(s *Star) time.Time { return s.StarredAt }},
+		{name: "stars", kind: kindNumber, number: func(s *Star) int { return s.Stargazers }},
+		{name: "synced", kind: kindTime, time: func(s *Star) time.Time { return s.SyncedAt }},
+		{name: "topic", kind: kindList, list: func(s *Star) []string { return s.Topics }},
+		{name: "url", kind: kindText, text: func(s *Star) string { return s.URL }},
+	} {
+		queryFields[field.name] = field
+	}
+}
+
+// queryFieldNames returns the names of the fields, sorted
+func queryFieldNames() []string {
+	names := []string{}
+	for name := range queryFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// starName returns the owner/name of the repository of a star
+func starName(star *Star) string {
+	owner, name, err := ownerAndRepo(star.URL)
+	if err != nil {
+		return ""
+	}
+
+	return owner + "/" + name
+}
+
+// queryNode is a node of the syntax tree of a query
+type queryNode interface {
+	match(star *Star) bool
+	String() string
+}
+
+// andNode matches stars matching all of its nodes
+type andNode []queryNode
+
+func (n andNode) match(star *Star) bool {
+	for _, node := range n {
+		if !node.match(star) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (n andNode) String() string {
+	parts := []string{}
+	for _, node := range n {
+		if _, ok := node.(orNode); ok {
+			parts = append(parts, "("+node.String()+")")
+		} else {
+			parts = append(parts, node.String())
+		}
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// orNode matches stars matching any of its nodes
+type orNode []queryNode
+
+func (n orNode) match(star *Star) bool {
+	for _, node := range n {
+		if node.match(star) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (n orNode) String() string {
+	parts := []string{}
+	for _, node := range n {
+		parts = append(parts, node.String())
+	}
+
+	return strings.Join(parts, " OR ")
+}
+
+// notNode matches stars not matching its node
+type notNode struct {
+	node queryNode
+}
+
+func (n notNode) match(star *Star) bool {
+	return !n.node.match(star)
+}
+
+func (n notNode) String() string {
+	switch n.node.(type) {
+	case andNode, orNode:
+		return "-(" + n.node.String() + ")"
+	default:
+		return "-" + n.node.String()
+	}
+}
+
+// interval is the range of numbers [low, high) that a value stands for. A
+// number n stands for [n, n+1), and a date for the nanoseconds of its period.
+type interval struct {
+	low, high int64
+}
+
+// compare reports whether v compares with the interval as op says
+func (i interval) compare(op string, v int64) bool {
+	switch op {
+	case ">":
+		return v >= i.high
+	case ">=":
+		return v >= i.low
+	case "<":
+		return v < i.low
+	case "<=":
+		return v < i.high
+	default:
+		return i.low <= v && v < i.high
+	}
+}
+
+// termNode matches stars whose field compares with one of the values as its
+// operator says. Text terms without a field match the name, description and
+// topics.
+type termNode struct {
+	field *queryField
+	op    string
+
+	// values are the values as written, for String
+	values []string
+
+	// texts are the lowercased values of text and list fields
+	texts []string
+
+	// intervals are the values of number and time fields
+	intervals []interval
+
+	// flag is the value of flag fields
+	flag bool
+}
+
+func (n *termNode) match(star *Star) bool {
+	if n.field == nil {
+		return n.matchText(star)
+	}
+
+	switch n.field.kind {
+	case kindText:
+		return n.matchString(n.field.text(star))
+	case kindList:
+		for _, elem := range n.field.list(star) {
+			if n.matchString(elem) {
+				return true
+			}
+		}
+
+		return false
+	case kindNumber:
+		return n.matchNumber(int64(n.field.number(star)))
+	case kindTime:
+		t := n.field.time(star)
+		if t.IsZero() {
+			return false
+		}
+
+		return n.matchNumber(t.UnixNano())
+	default:
+		return n.field.flag(star) == n.flag
+	}
+}
+
+// matchText matches the name, description and topics of a star
+func (n *termNode) matchText(star *Star) bool {
+	if n.matchString(starName(star)) || n.matchString(star.Description) {
+		return true
+	}
+
+	for _, topic := range star.Topics {
+		if n.matchString(topic) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchString matches a string, ignoring case
+func (n *termNode) matchString(s string) bool {
+	s = strings.ToLower(s)
+
+	for _, text := range n.texts {
+		if n.op == "~" && strings.Contains(s, text) || n.op != "~" && s == text {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchNumber matches a number or time (in nanoseconds)
+func (n *termNode) matchNumber(v int64) bool {
+	for _, i := range n.intervals {
+		if i.compare(n.op, v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (n *termNode) String() string {
+	values := []string{}
+	for _, value := range n.values {
+		values = append(values, quoteQueryValue(value))
+	}
+
+	if n.field == nil {
+		// Text naming a flag would parse back as the flag
+		if field, ok := queryFields[strings.ToLower(n.values[0])]; ok && field.kind == kindFlag {
+			return strconv.Quote(n.values[0])
+		}
+
+		return strings.Join(values, ",")
+	}
+
+	if n.field.kind == kindFlag && n.flag {
+		return n.field.name
+	}
+
+	op := n.op
+	if op == "=" {
+		op = ""
+	}
+
+	return n.field.name + ":" + op + strings.Join(values, ",")
+}
+
+// quoteQueryValue quotes a value if it would not parse back as written
+func quoteQueryValue(value string) string {
+	if value != "" && !strings.ContainsAny(value, " \t\n\"\\(),:~<>=") &&
+		!strings.HasPrefix(value, "-") && value != "OR" && value != "AND" && value != "NOT" {
+		return value
+	}
+
+	return strconv.Quote(value)
+}
+
+// dateLayouts are the layouts of dates in queries, with the period each one
+// names
+var dateLayouts = []struct {
+	layout string
+	period func(time.Time) time.Time
+}{
+	{time.RFC3339, func(t time.Time) time.Time { return t.Add(time.Second) }},
+	{"2006-01-02", func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }},
+	{"2006-01", func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }},
+	{"2006", func(t time.Time) time.Time { return t.AddDate(1, 0, 0) }},
+}
+
+// parseInterval parses a number or date (depending on the kind) to the
+// interval it stands for. An asterisk stands for everything.
+func parseInterval(kind fieldKind, value string) (interval, bool) {
+	if value == "*" {
+		return interval{math.MinInt64, math.MaxInt64}, true
+	}
+
+	if kind == kindNumber {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n == math.MaxInt64 {
+			return interval{}, false
+		}
+
+		return interval{n, n + 1}, true
+	}
+
+	for _, date := range dateLayouts {
+		t, err := time.Parse(date.layout, value)
+		if err == nil {
+			return interval{t.UnixNano(), date.period(t).UnixNano()}, true
+		}
+	}
+
+	return interval{}, false
+}
+
+// levenshtein returns the edit distance between two strings
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			cur[j] = minInt(prev[j]+1, minInt(cur[j-1]+1, prev[j-1]+cost))
+		}
+
+		prev = cur
+	}
+
+	return prev[len(b)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
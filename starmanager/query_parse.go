@@ -0,0 +1,455 @@
+package starmanager
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// queryRune is a character of a query term, recording whether it was quoted
+// (and so has no special meaning) and its column
+type queryRune struct {
+	r      rune
+	quoted bool
+	column int
+}
+
+// queryWord is a sequence of characters of a query term
+type queryWord []queryRune
+
+// String returns the characters of the word
+func (w queryWord) String() string {
+	b := strings.Builder{}
+	for _, qr := range w {
+		b.WriteRune(qr.r)
+	}
+
+	return b.String()
+}
+
+// index returns the index of the first unquoted occurrence of sep in the
+// word, or -1
+func (w queryWord) index(sep string) int {
+	seps := []rune(sep)
+
+outer:
+	for i := 0; i+len(seps) <= len(w); i++ {
+		for j, r := range seps {
+			if w[i+j].quoted || w[i+j].r != r {
+				continue outer
+			}
+		}
+
+		return i
+	}
+
+	return -1
+}
+
+// split splits the word around the unquoted occurrences of sep
+func (w queryWord) split(sep string) []queryWord {
+	parts := []queryWord{}
+	for {
+		i := w.index(sep)
+		if i < 0 {
+			return append(parts, w)
+		}
+
+		parts = append(parts, w[:i])
+		w = w[i+len(sep):]
+	}
+}
+
+// hasPrefix reports whether the word starts with the unquoted prefix
+func (w queryWord) hasPrefix(prefix string) bool {
+	return w.index(prefix) == 0
+}
+
+// queryParser is a recursive descent parser of query expressions:
+//
+//	query := or?
+//	or    := and ("OR" and)*
+//	and   := unary ("AND"? unary)*
+//	unary := ("-" | "NOT") unary | "(" or ")" | term
+type queryParser struct {
+	text  string
+	runes []rune
+	pos   int
+}
+
+// errorf returns a QueryError at a column
+func (p *queryParser) errorf(column int, format string, args ...interface{}) error {
+	return &QueryError{Query: p.text, Column: column, Message: fmt.Sprintf(format, args...)}
+}
+
+// parse parses the whole expression
+func (p *queryParser) parse() (queryNode, error) {
+	p.skipSpace()
+	if p.pos == len(p.runes) {
+		return nil, nil
+	}
+
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos < len(p.runes) {
+		return nil, p.errorf(p.pos+1, "unexpected %q", p.runes[p.pos])
+	}
+
+	return node, nil
+}
+
+// parseOr parses terms separated by OR
+func (p *queryParser) parseOr() (queryNode, error) {
+	nodes := orNode{}
+
+	for {
+		node, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+
+		if !p.keyword("OR") {
+			break
+		}
+	}
+
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+
+	return nodes, nil
+}
+
+// parseAnd parses terms that must all match
+func (p *queryParser) parseAnd() (queryNode, error) {
+	nodes := andNode{}
+
+	for {
+		p.skipSpace()
+		if p.pos == len(p.runes) || p.runes[p.pos] == ')' || p.peekKeyword("OR") {
+			break
+		}
+
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+
+		if p.keyword("AND") {
+			p.skipSpace()
+			if p.pos == len(p.runes) || p.runes[p.pos] == ')' || p.peekKeyword("OR") {
+				return nil, p.errorf(p.pos+1, "expected a term after AND")
+			}
+		}
+	}
+
+	switch len(nodes) {
+	case 0:
+		if p.pos == len(p.runes) {
+			return nil, p.errorf(p.pos+1, "expected a term at the end")
+		}
+
+		return nil, p.errorf(p.pos+1, "expected a term before %q", p.nextWord())
+	case 1:
+		return nodes[0], nil
+	default:
+		return nodes, nil
+	}
+}
+
+// parseUnary parses a negated term, a group or a term
+func (p *queryParser) parseUnary() (queryNode, error) {
+	p.skipSpace()
+	start := p.pos
+
+	if p.pos == len(p.runes) {
+		return nil, p.errorf(p.pos+1, "expected a term at the end")
+	} else if p.runes[p.pos] == ')' {
+		return nil, p.errorf(p.pos+1, "unexpected )")
+	}
+
+	switch {
+	case p.keyword("NOT"):
+	case p.runes[p.pos] == '-':
+		p.pos++
+		if p.pos == len(p.runes) || unicode.IsSpace(p.runes[p.pos]) {
+			return nil, p.errorf(start+1, "nothing to negate after -")
+		}
+	case p.runes[p.pos] == '(':
+		p.pos++
+
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		p.skipSpace()
+		if p.pos == len(p.runes) || p.runes[p.pos] != ')' {
+			return nil, p.errorf(start+1, "unclosed (")
+		}
+		p.pos++
+
+		return node, nil
+	default:
+		return p.parseTerm()
+	}
+
+	node, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	if not, ok := node.(notNode); ok {
+		return not.node, nil
+	}
+
+	return notNode{node}, nil
+}
+
+// parseTerm parses a single term
+func (p *queryParser) parseTerm() (queryNode, error) {
+	word, err := p.scanWord()
+	if err != nil {
+		return nil, err
+	}
+
+	colon := word.index(":")
+	if colon < 0 {
+		// A lone field name is a flag, anything else is text
+		if field, ok := p.lookupField(word.String()); ok && !word[0].quoted && field.kind == kindFlag {
+			return &termNode{field: field, op: "=", values: []string{"true"}, flag: true}, nil
+		}
+
+		text := word.String()
+		return &termNode{op: "~", values: []string{text}, texts: []string{strings.ToLower(text)}}, nil
+	}
+
+	key := word[:colon]
+	if len(key) == 0 {
+		return nil, p.errorf(word[0].column, "missing field name before :")
+	}
+
+	field, ok := p.lookupField(key.String())
+	if !ok {
+		return nil, p.unknownField(key)
+	}
+
+	value := word[colon+1:]
+	op := "="
+	for _, prefix := range []string{">=", "<=", ">", "<", "=", "~"} {
+		if value.hasPrefix(prefix) {
+			op = prefix
+			value = value[len(prefix):]
+			break
+		}
+	}
+
+	column := word[colon].column + 1
+	if len(value) > 0 {
+		column = value[0].column
+	}
+
+	switch {
+	case op == "~" && field.kind != kindText && field.kind != kindList:
+		return nil, p.errorf(column, "%s cannot be matched with ~, only text fields can", field.name)
+	case op != "=" && op != "~" && field.kind != kindNumber && field.kind != kindTime:
+		return nil, p.errorf(column, "%s cannot be compared with %s, only numbers and dates can", field.name, op)
+	}
+
+	values := value.split(",")
+	if len(values) > 1 && op != "=" && op != "~" {
+		return nil, p.errorf(column, "only one value can be compared with %s", op)
+	} else if len(values) > 1 && field.kind == kindFlag {
+		return nil, p.errorf(column, "%s takes a single value", field.name)
+	}
+
+	node := &termNode{field: field, op: op}
+	for _, value := range values {
+		if len(value) == 0 {
+			return nil, p.errorf(column, "missing value for %s", field.name)
+		}
+		column = value[0].column
+
+		node.values = append(node.values, value.String())
+
+		switch field.kind {
+		case kindText, kindList:
+			node.texts = append(node.texts, strings.ToLower(value.String()))
+
+		case kindFlag:
+			switch strings.ToLower(value.String()) {
+			case "true", "yes":
+				node.flag = true
+			case "false", "no":
+				node.flag = false
+			default:
+				return nil, p.errorf(column, "%s must be true or false, not %q", field.name, value.String())
+			}
+
+		default:
+			i, err := p.parseValue(field, value, op)
+			if err != nil {
+				return nil, err
+			}
+			node.intervals = append(node.intervals, i)
+		}
+	}
+
+	return node, nil
+}
+
+// parseValue parses a number or date, or a range of them
+func (p *queryParser) parseValue(field *queryField, value queryWord, op string) (interval, error) {
+	bounds := value.split("..")
+	if len(bounds) > 2 {
+		return interval{}, p.errorf(value[0].column, "a range has two ends")
+	}
+
+	if len(bounds) == 2 && op != "=" {
+		return interval{}, p.errorf(value[0].column, "a range cannot be compared with %s", op)
+	}
+
+	intervals := []interval{}
+	for _, bound := range bounds {
+		column := value[0].column
+		if len(bound) > 0 {
+			column = bound[0].column
+		}
+
+		i, ok := parseInterval(field.kind, bound.String())
+		if !ok && field.kind == kindNumber {
+			return interval{}, p.errorf(column, "%s must be a number, not %q", field.name, bound.String())
+		} else if !ok {
+			return interval{}, p.errorf(
+				column, "%s must be a date (YYYY, YYYY-MM, YYYY-MM-DD or RFC 3339), not %q",
+				field.name, bound.String(),
+			)
+		}
+
+		intervals = append(intervals, i)
+	}
+
+	return interval{intervals[0].low, intervals[len(intervals)-1].high}, nil
+}
+
+// lookupField returns the field with a name or alias
+func (p *queryParser) lookupField(name string) (*queryField, bool) {
+	name = strings.ToLower(name)
+	if alias, ok := queryFieldAliases[name]; ok {
+		name = alias
+	}
+
+	field, ok := queryFields[name]
+
+	return field, ok
+}
+
+// unknownField returns an error for an unknown field, suggesting the closest
+// one
+func (p *queryParser) unknownField(key queryWord) error {
+	name := strings.ToLower(key.String())
+
+	suggestion, distance := "", 3
+	for candidate := range queryFieldAliases {
+		if d := levenshtein(name, candidate); d < distance {
+			suggestion, distance = candidate, d
+		}
+	}
+	for _, candidate := range queryFieldNames() {
+		if d := levenshtein(name, candidate); d < distance {
+			suggestion, distance = candidate, d
+		}
+	}
+
+	if suggestion != "" {
+		return p.errorf(key[0].column, "unknown field %q, did you mean %q?", key.String(), suggestion)
+	}
+
+	return p.errorf(
+		key[0].column, "unknown field %q (fields are %s)",
+		key.String(), strings.Join(queryFieldNames(), ", "),
+	)
+}
+
+// scanWord scans a term up to the next unquoted space or parenthesis
+func (p *queryParser) scanWord() (queryWord, error) {
+	word := queryWord{}
+	quote := -1
+
+	for ; p.pos < len(p.runes); p.pos++ {
+		r := p.runes[p.pos]
+
+		if quote < 0 && (unicode.IsSpace(r) || r == '(' || r == ')') {
+			break
+		}
+
+		switch {
+		case r == '"':
+			if quote < 0 {
+				quote = p.pos
+			} else {
+				quote = -1
+			}
+		case quote >= 0 && r == '\\' && p.pos+1 < len(p.runes):
+			p.pos++
+			word = append(word, queryRune{p.runes[p.pos], true, p.pos + 1})
+		default:
+			word = append(word, queryRune{r, quote >= 0, p.pos + 1})
+		}
+	}
+
+	if quote >= 0 {
+		return nil, p.errorf(quote+1, "unclosed quote")
+	}
+
+	if len(word) == 0 {
+		return nil, p.errorf(p.pos+1, "empty term")
+	}
+
+	return word, nil
+}
+
+// skipSpace skips spaces
+func (p *queryParser) skipSpace() {
+	for p.pos < len(p.runes) && unicode.IsSpace(p.runes[p.pos]) {
+		p.pos++
+	}
+}
+
+// peekKeyword reports whether the next word is the keyword
+func (p *queryParser) peekKeyword(keyword string) bool {
+	p.skipSpace()
+
+	end := p.pos + len(keyword)
+	if end > len(p.runes) || string(p.runes[p.pos:end]) != keyword {
+		return false
+	}
+
+	return end == len(p.runes) || unicode.IsSpace(p.runes[end]) || p.runes[end] == '('
+}
+
+// keyword skips the next word if it is the keyword, and reports whether it
+// was
+func (p *queryParser) keyword(keyword string) bool {
+	if !p.peekKeyword(keyword) {
+		return false
+	}
+	p.pos += len(keyword)
+
+	return true
+}
+
+// nextWord returns the next word, for error messages
+func (p *queryParser) nextWord() string {
+	end := p.pos
+	for end < len(p.runes) && !unicode.IsSpace(p.runes[end]) {
+		end++
+	}
+
+	return string(p.runes[p.pos:end])
+}
@@ -0,0 +1,191 @@
+package starmanager
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// mustParseQuery parses a query that is known to be valid
+func mustParseQuery(t *testing.T, text string) *Query {
+	query, err := ParseQuery(text)
+	assert.NoError(t, err, text)
+
+	return query
+}
+
+// queryFixtures are the stars queries are matched against
+var queryFixtures = []*Star{
+	{
+		URL:         "https://github.com/a/one",
+		Description: "A fast YAML parser",
+		Language:    "go",
+		Topics:      []string{"cli", "yaml"},
+		Stargazers:  800,
+		PushedAt:    time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+		StarredAt:   time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		License:     "MIT",
+		OpenIssues:  3,
+	},
+	{
+		URL:         "https://github.com/b/two",
+		Description: "Diff tool for structured data",
+		Language:    "rust",
+		Topics:      []string{"cli", "diff"},
+		Stargazers:  450,
+		PushedAt:    time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC),
+		StarredAt:   time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC),
+		Parent:      "https://github.com/a/one",
+	},
+	{
+		URL:         "https://github.com/c/three",
+		Description: "Old and archived",
+		Language:    "go",
+		Stargazers:  2000,
+		PushedAt:    time.Date(2019, 5, 1, 0, 0, 0, 0, time.UTC),
+		Archived:    true,
+	},
+	{
+		URL:      "https://github.com/d/four",
+		Language: "python",
+	},
+}
+
+func TestQueryMatch(t *testing.T) {
+	for text, expected := range map[string][]string{
+		"":                             {"a/one", "b/two", "c/three", "d/four"},
+		"language:go":                  {"a/one", "c/three"},
+		"lang:Go,RUST":                 {"a/one", "b/two", "c/three"},
+		"topic:cli":                    {"a/one", "b/two"},
+		"topic:~ya":                    {"a/one"},
+		"stars:>500":                   {"a/one", "c/three"},
+		"stars:>=450 stars:<=800":      {"a/one", "b/two"},
+		"stars:450..800":               {"a/one", "b/two"},
+		"stars:*..450":                 {"b/two", "d/four"},
+		"stars:450,2000":               {"b/two", "c/three"},
+		"pushed:>2024-01":              {"a/one"},
+		"pushed:2024-01":               {"b/two"},
+		"pushed:>=2024-01":             {"a/one", "b/two"},
+		"pushed:<2024":                 {"c/three"},
+		"pushed:2019..2024-01-15":      {"b/two", "c/three"},
+		"pushed:>2024-01-14T12:00:00Z": {"a/one", "b/two"},
+		"starred:<=2020":               {"a/one"},
+		"archived":                     {"c/three"},
+		"-archived":                    {"a/one", "b/two", "d/four"},
+		"archived:false":               {"a/one", "b/two", "d/four"},
+		"fork":                         {"b/two"},
+		`desc:~"parser"`:               {"a/one"},
+		`description:~"yaml parser"`:   {"a/one"},
+		`desc:"a fast yaml parser"`:    {"a/one"},
+		"yaml":                         {"a/one"},
+		"diff":                         {"b/two"},
+		`"structured data"`:            {"b/two"},
+		"name:a/one":                   {"a/one"},
+		"repo:~/t":                     {"b/two", "c/three"},
+		"license:mit":                  {"a/one"},
+		"issues:>0":                    {"a/one"},
+		"language:go,rust topic:cli stars:>500 pushed:>2024-01 -archived desc:~parser": {"a/one"},
+		"language:rust OR archived":             {"b/two", "c/three"},
+		"language:go AND -archived":             {"a/one"},
+		"NOT language:go":                       {"b/two", "d/four"},
+		"-(language:go OR language:rust)":       {"d/four"},
+		"(language:go OR language:rust) -fork":  {"a/one", "c/three"},
+		"language:python OR topic:yaml stars:0": {"d/four"},
+	} {
+		query := mustParseQuery(t, text)
+		if query == nil {
+			continue
+		}
+
+		matching := []string{}
+		for _, star := range queryFixtures {
+			if query.Match(star) {
+				matching = append(matching, starName(star))
+			}
+		}
+		assert.Equal(t, expected, matching, text)
+	}
+}
+
+func TestQueryString(t *testing.T) {
+	for text, expected := range map[string]string{
+		"":                                "",
+		"  Language:Go   topic:CLI ":      "language:Go topic:CLI",
+		"lang:go,rust stargazers:>=10":    "language:go,rust stars:>=10",
+		"archived:true -archived:false":   "archived -archived:false",
+		"--fork":                          "fork",
+		"NOT (a OR b) c":                  "-(a OR b) c",
+		"a OR b c":                        "a OR b c",
+		"(a OR b) c":                      "(a OR b) c",
+		`desc:~"yaml parser" "x\"y"`:      `desc:~"yaml parser" "x\"y"`,
+		"pushed:2020..* stars:=5":         "pushed:2020..* stars:5",
+		`"OR" "archived" "-x" "a:b" "(c"`: `"OR" "archived" "-x" "a:b" "(c"`,
+	} {
+		query := mustParseQuery(t, text)
+		if query == nil {
+			continue
+		}
+
+		assert.Equal(t, expected, query.String(), text)
+
+		// The normalized form parses to the same query
+		assert.Equal(t, expected, mustParseQuery(t, query.String()).String(), text)
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	for text, expected := range map[string]string{
+		"langauge:go":        `invalid query at column 1: unknown field "langauge", did you mean "language"?`,
+		"stars:>5 bogus:x":   `invalid query at column 10: unknown field "bogus" (fields are archived, desc, fork, issues, language, license, name, parent, pushed, release, size, starred, stars, synced, topic, url)`,
+		"stars:many":         `invalid query at column 7: stars must be a number, not "many"`,
+		"pushed:>2024-13":    `invalid query at column 9: pushed must be a date (YYYY, YYYY-MM, YYYY-MM-DD or RFC 3339), not "2024-13"`,
+		"desc:>5":            `invalid query at column 7: desc cannot be compared with >, only numbers and dates can`,
+		"stars:~5":           `invalid query at column 8: stars cannot be matched with ~, only text fields can`,
+		"stars:>5,6":         `invalid query at column 8: only one value can be compared with >`,
+		"stars:1..2..3":      `invalid query at column 7: a range has two ends`,
+		"archived:maybe":     `invalid query at column 10: archived must be true or false, not "maybe"`,
+		"language:":          `invalid query at column 10: missing value for language`,
+		":go":                `invalid query at column 1: missing field name before :`,
+		`desc:~"parser`:      `invalid query at column 7: unclosed quote`,
+		"(language:go":       `invalid query at column 1: unclosed (`,
+		"language:go)":       `invalid query at column 12: unexpected ')'`,
+		"()":                 `invalid query at column 2: expected a term before ")"`,
+		"language:go OR":     `invalid query at column 15: expected a term at the end`,
+		"OR language:go":     `invalid query at column 1: expected a term before "OR"`,
+		"language:go AND":    `invalid query at column 16: expected a term after AND`,
+		"- archived":         `invalid query at column 1: nothing to negate after -`,
+		"NOT":                `invalid query at column 4: expected a term at the end`,
+		"stars:>1..2":        `invalid query at column 8: a range cannot be compared with >`,
+		"archived:true,true": `invalid query at column 10: archived takes a single value`,
+	} {
+		_, err := ParseQuery(text)
+		assert.EqualError(t, err, expected, text)
+
+		queryErr := &QueryError{}
+		assert.True(t, errors.As(err, &queryErr), text)
+		assert.Equal(t, text, queryErr.Query)
+	}
+}
+
+func TestFindStars(t *testing.T) {
+	sm, cleanup := newTestStarManager(t)
+	defer cleanup()
+
+	saveFixtures(t, sm)
+
+	stars, err := sm.FindStars(10, Filter{Query: mustParseQuery(t, "topic:cli")}, nil)
+	assert.NoError(t, err)
+	assert.Len(t, stars, 2)
+	assert.Equal(t, "https://github.com/b/two", stars[0].URL)
+
+	// The query narrows down the other criteria, before the count applies
+	stars, err = sm.FindStars(1, Filter{Language: "go", Query: mustParseQuery(t, "-topic:parser")}, nil)
+	assert.NoError(t, err)
+	assert.Len(t, stars, 1)
+	assert.Equal(t, "https://github.com/a/one", stars[0].URL)
+
+	_, err = sm.FindStars(10, Filter{Query: mustParseQuery(t, "stars:>100")}, nil)
+	assert.Error(t, err)
+}
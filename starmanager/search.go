@@ -0,0 +1,351 @@
+package starmanager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gkze/gh-stars/search"
+	"go.uber.org/multierr"
+)
+
+const (
+	// SearchIndexKey is the metadata key holding the full-text search index
+	SearchIndexKey = "search_index"
+
+	// ReadmeKeyPrefix prefixes the URL of a star to form the metadata key
+	// holding its README
+	ReadmeKeyPrefix = "readme:"
+)
+
+// searchWeights weighs the fields of stars in search results: a term in the
+// name of a repository counts more than one in its README
+var searchWeights = map[string]float64{
+	"name":        3,
+	"topics":      2,
+	"description": 1.5,
+	"readme":      0.5,
+}
+
+var (
+	// readmeLinkPattern matches the targets of Markdown links and images in
+	// READMEs, which are mostly noise to search
+	readmeLinkPattern = regexp.MustCompile(`\]\([^)\s]*\)`)
+
+	// readmeURLPattern matches bare URLs in READMEs
+	readmeURLPattern = regexp.MustCompile(`https?://\S+`)
+
+	// readmeTagPattern matches HTML tags in READMEs
+	readmeTagPattern = regexp.MustCompile(`<[^>]*>`)
+)
+
+// Readme is the README of a star, as saved by SaveReadmes
+type Readme struct {
+	// FetchedAt is when the README was fetched
+	FetchedAt time.Time `json:"fetched_at"`
+
+	// Content is the text of the README, empty if the repository has none
+	Content string `json:"content"`
+}
+
+// SearchResult is a star matching a search
+type SearchResult struct {
+	// Star is the matching star
+	Star *Star
+
+	// Score is how well the star matches, higher is better
+	Score float64
+
+	// Terms are the terms searched for, to highlight matches with
+	Terms []string
+
+	// Fields are the fields of the star that matched (name, description,
+	// topics and readme), sorted
+	Fields []string
+
+	// Readme is the README of the star, if it was saved
+	Readme string
+}
+
+// Readme returns the saved README of a star, or nil if it was never fetched
+func (s *StarManager) Readme(url string) (*Readme, error) {
+	value, err := s.store.GetMeta(ReadmeKeyPrefix + url)
+	if errors.Is(err, ErrMetaNotFound) || (err == nil && len(value) == 0) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	readme := &Readme{}
+	if err := json.Unmarshal(value, readme); err != nil {
+		return nil, fmt.Errorf("invalid README of %s: %w", url, err)
+	}
+
+	return readme, nil
+}
+
+// saveReadme stores the README of a star
+func (s *StarManager) saveReadme(url string, readme *Readme) error {
+	value, err := json.Marshal(readme)
+	if err != nil {
+		return err
+	}
+
+	return s.store.SetMeta(ReadmeKeyPrefix+url, value)
+}
+
+// SaveReadmes fetches the READMEs of stars with up to maxConcurrency
+// goroutines, so that searches match their content, and rebuilds the search
+// index. READMEs are only refetched when their repository was pushed to since
+// they were fetched. Stars whose README fails to be fetched do not stop the
+// others; their errors are returned together.
+func (s *StarManager) SaveReadmes(ctx context.Context, maxConcurrency int) error {
+	stars, err := s.store.All()
+	if err != nil {
+		return err
+	}
+
+	outdated := make(chan *Star)
+	go func() {
+		defer close(outdated)
+
+		for _, star := range stars {
+			readme, err := s.Readme(star.URL)
+			if err == nil && readme != nil && !star.PushedAt.After(readme.FetchedAt) {
+				continue
+			}
+
+			select {
+			case outdated <- star:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	if maxConcurrency < 1 {
+		maxConcurrency = DefaultConcurrency
+	}
+
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		errs error
+	)
+
+	for i := 0; i < maxConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for star := range outdated {
+				err := s.fetchReadme(ctx, star)
+				if ctx.Err() != nil {
+					return
+				}
+
+				if err != nil {
+					mu.Lock()
+					errs = multierr.Append(errs, err)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return multierr.Append(errs, fmt.Errorf("saving READMEs was interrupted: %w", err))
+	}
+
+	return multierr.Append(errs, s.RebuildSearchIndex())
+}
+
+// fetchReadme fetches and saves the README of a star. Repositories without
+// one are saved with an empty README, so that it is not requested again until
+// they are pushed to.
+func (s *StarManager) fetchReadme(ctx context.Context, star *Star) error {
+	owner, name, err := ownerAndRepo(star.URL)
+	if err != nil {
+		return err
+	}
+
+	fetchedAt := s.now()
+
+	s.log.Debugf("Fetching the README of %s/%s\n", owner, name)
+	file, response, err := s.client.Repositories.GetReadme(ctx, owner, name, nil)
+	if err != nil {
+		if response != nil && response.StatusCode == http.StatusNotFound {
+			return s.saveReadme(star.URL, &Readme{FetchedAt: fetchedAt})
+		}
+
+		return fmt.Errorf("could not fetch the README of %s: %w", star.URL, err)
+	}
+
+	content, err := file.GetContent()
+	if err != nil {
+		return fmt.Errorf("could not decode the README of %s: %w", star.URL, err)
+	}
+
+	return s.saveReadme(star.URL, &Readme{FetchedAt: fetchedAt, Content: content})
+}
+
+// readmeText strips the links and markup from a README that are not worth
+// searching
+func readmeText(content string) string {
+	content = readmeLinkPattern.ReplaceAllString(content, "]")
+	content = readmeURLPattern.ReplaceAllString(content, " ")
+
+	return readmeTagPattern.ReplaceAllString(content, " ")
+}
+
+// RebuildSearchIndex indexes the name, description, topics and saved README
+// of every star for Search. It is called after stars are saved or synced.
+func (s *StarManager) RebuildSearchIndex() error {
+	stars, err := s.store.All()
+	if err != nil {
+		return err
+	}
+
+	ix, err := s.buildSearchIndex(stars)
+	if err != nil {
+		return err
+	}
+
+	return s.saveSearchIndex(ix)
+}
+
+// searchStamp fingerprints the names, descriptions and topics of stars, so
+// that a search index built from them is known to be out of date once any
+// star is added, removed or changed, even if the number of stars stays the
+// same. READMEs are left out, as SaveReadmes rebuilds the index itself.
+func searchStamp(stars []*Star) string {
+	sorted := make([]*Star, len(stars))
+	copy(sorted, stars)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].URL < sorted[j].URL })
+
+	h := fnv.New64a()
+	for _, star := range sorted {
+		fmt.Fprintf(h, "%q %q %q\n", star.URL, star.Description, star.Topics)
+	}
+
+	return fmt.Sprintf("%d:%x", len(stars), h.Sum64())
+}
+
+// buildSearchIndex indexes stars
+func (s *StarManager) buildSearchIndex(stars []*Star) (*search.Index, error) {
+	ix := search.NewIndex()
+	ix.Stamp = searchStamp(stars)
+	for _, star := range stars {
+		readme, err := s.Readme(star.URL)
+		if err != nil {
+			return nil, fmt.Errorf("could not build the search index: %w", err)
+		}
+
+		fields := map[string]string{
+			"name":        starName(star),
+			"description": star.Description,
+			"topics":      strings.Join(star.Topics, " "),
+		}
+		if readme != nil {
+			fields["readme"] = readmeText(readme.Content)
+		}
+
+		ix.Add(search.Document{ID: star.URL, Fields: fields})
+	}
+
+	return ix, nil
+}
+
+// saveSearchIndex stores the search index
+func (s *StarManager) saveSearchIndex(ix *search.Index) error {
+	value, err := json.Marshal(ix)
+	if err != nil {
+		return err
+	}
+
+	return s.store.SetMeta(SearchIndexKey, value)
+}
+
+// searchIndex returns the stored search index, rebuilding it if there is
+// none, it was built by another version, or stars were added, removed or
+// changed since
+func (s *StarManager) searchIndex() (*search.Index, error) {
+	stars, err := s.store.All()
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := s.store.GetMeta(SearchIndexKey)
+	if err != nil && !errors.Is(err, ErrMetaNotFound) {
+		return nil, err
+	}
+
+	ix := &search.Index{}
+	if len(value) > 0 && json.Unmarshal(value, ix) == nil &&
+		ix.Version == search.Version && ix.Stamp == searchStamp(stars) {
+		return ix, nil
+	}
+
+	s.log.Info("Rebuilding the search index...")
+	if ix, err = s.buildSearchIndex(stars); err != nil {
+		return nil, err
+	}
+
+	return ix, s.saveSearchIndex(ix)
+}
+
+// Search returns up to count stars matching any of the terms of text, best
+// first. Matches are ranked with BM25, terms in names weighing the most,
+// then topics, descriptions and READMEs (see SaveReadmes).
+func (s *StarManager) Search(text string, count int) ([]*SearchResult, error) {
+	terms := search.UniqueTerms(text)
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("nothing to search for in %q", text)
+	}
+
+	ix, err := s.searchIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	results := []*SearchResult{}
+	for _, match := range ix.Search(text, searchWeights, 0) {
+		if count > 0 && len(results) == count {
+			break
+		}
+
+		// Stars removed since the index was checked are skipped
+		star, err := s.store.Get(match.ID)
+		if errors.Is(err, ErrStarNotFound) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		result := &SearchResult{
+			Star: star, Score: match.Score, Terms: terms, Fields: match.Fields,
+		}
+
+		readme, err := s.Readme(star.URL)
+		if err != nil {
+			return nil, err
+		}
+		if readme != nil {
+			result.Readme = readmeText(readme.Content)
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
@@ -0,0 +1,154 @@
+package starmanager
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// searchNames returns the owner/name of the stars of search results
+func searchNames(results []*SearchResult) []string {
+	names := []string{}
+	for _, result := range results {
+		names = append(names, starName(result.Star))
+	}
+
+	return names
+}
+
+func TestSearch(t *testing.T) {
+	sm, cleanup := newTestStarManager(t)
+	defer cleanup()
+
+	for _, star := range queryFixtures {
+		assert.NoError(t, sm.store.Save(star))
+	}
+
+	// The index is built on the first search
+	results, err := sm.Search("YAML parsers", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a/one"}, searchNames(results))
+	assert.Equal(t, []string{"yaml", "parser"}, results[0].Terms)
+	assert.Equal(t, []string{"description", "topics"}, results[0].Fields)
+	assert.Empty(t, results[0].Readme)
+
+	_, err = sm.store.GetMeta(SearchIndexKey)
+	assert.NoError(t, err)
+
+	// Names weigh more than descriptions
+	results, err = sm.Search("one diff", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a/one", "b/two"}, searchNames(results))
+
+	results, err = sm.Search("one diff", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a/one"}, searchNames(results))
+
+	// Adding a star makes the index stale
+	assert.NoError(t, sm.store.Save(&Star{
+		URL: "https://github.com/e/five", Description: "Another diff",
+	}))
+
+	results, err = sm.Search("diff", 10)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"b/two", "e/five"}, searchNames(results))
+
+	// So does changing a star without changing how many there are
+	star, err := sm.store.Get("https://github.com/e/five")
+	assert.NoError(t, err)
+	star.Description = "Another merge tool"
+	assert.NoError(t, sm.store.Save(star))
+
+	results, err = sm.Search("diff", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b/two"}, searchNames(results))
+
+	results, err = sm.Search("merge", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"e/five"}, searchNames(results))
+
+	// READMEs are indexed once saved
+	assert.NoError(t, sm.saveReadme("https://github.com/d/four", &Readme{
+		FetchedAt: time.Now(),
+		Content:   "# Four\n\n<img src=\"https://example.com/yaml.png\">\n\nConverts YAML to TOML.",
+	}))
+	assert.NoError(t, sm.RebuildSearchIndex())
+
+	results, err = sm.Search("yaml", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a/one", "d/four"}, searchNames(results))
+	assert.Equal(t, []string{"readme"}, results[1].Fields)
+	assert.NotContains(t, results[1].Readme, "example.com")
+	assert.Contains(t, results[1].Readme, "Converts YAML to TOML.")
+
+	results, err = sm.Search("kubernetes", 10)
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+
+	_, err = sm.Search("the", 10)
+	assert.EqualError(t, err, `nothing to search for in "the"`)
+}
+
+func TestE2ESaveReadmes(t *testing.T) {
+	f := newFakeGitHub(t, 4)
+	defer f.Close()
+
+	pushed := time.Now().AddDate(0, 0, -7).Truncate(time.Second)
+	f.addRepo(
+		&fakeRepo{
+			Owner: "a", Name: "one", PushedAt: pushed, Description: "A command-line tool",
+			Readme: "# One\n\nOne is a fast [YAML](https://yaml.org) processor.",
+		},
+		&fakeRepo{Owner: "b", Name: "two", PushedAt: pushed, Description: "YAML diffs"},
+	)
+	f.star("a/one", time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	f.star("b/two", time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC))
+
+	sm, cleanup := f.starManager()
+	defer cleanup()
+
+	ctx := context.Background()
+
+	// Syncing indexes the stars
+	_, err := sm.Sync(ctx, SyncOptions{})
+	assert.NoError(t, err)
+
+	results, err := sm.Search("yaml", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b/two"}, searchNames(results))
+
+	assert.NoError(t, sm.SaveReadmes(ctx, 2))
+	assert.Equal(t, 1, f.requestCount("GET", "/repos/a/one/readme"))
+	assert.Equal(t, 1, f.requestCount("GET", "/repos/b/two/readme"))
+
+	readme, err := sm.Readme("https://github.com/b/two")
+	assert.NoError(t, err)
+	assert.Empty(t, readme.Content)
+
+	results, err = sm.Search("yaml processor", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a/one", "b/two"}, searchNames(results))
+	assert.Equal(t, []string{"readme"}, results[0].Fields)
+	assert.Contains(t, results[0].Readme, "fast [YAML] processor")
+
+	// READMEs are only refetched once their repository is pushed to
+	assert.NoError(t, sm.SaveReadmes(ctx, 2))
+	assert.Equal(t, 1, f.requestCount("GET", "/repos/a/one/readme"))
+
+	star, err := sm.store.Get("https://github.com/a/one")
+	assert.NoError(t, err)
+	star.PushedAt = time.Now().Add(time.Hour)
+	assert.NoError(t, sm.store.Save(star))
+
+	assert.NoError(t, sm.SaveReadmes(ctx, 2))
+	assert.Equal(t, 2, f.requestCount("GET", "/repos/a/one/readme"))
+	assert.Equal(t, 1, f.requestCount("GET", "/repos/b/two/readme"))
+
+	// Failures are reported without stopping the other stars
+	f.setRemaining(0)
+	star.PushedAt = time.Now().Add(2 * time.Hour)
+	assert.NoError(t, sm.store.Save(star))
+	assert.Error(t, sm.SaveReadmes(ctx, 2))
+}
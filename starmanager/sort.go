@@ -0,0 +1,258 @@
+package starmanager
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SortKey is a property stars can be sorted by
+type SortKey string
+
+const (
+	// SortStars - by number of stargazers, most first by default
+	SortStars SortKey = "stars"
+
+	// SortStarred - by when the repository was starred, newest first by
+	// default
+	SortStarred SortKey = "starred"
+
+	// SortPushed - by when the repository was last pushed to, newest first by
+	// default
+	SortPushed SortKey = "pushed"
+
+	// SortName - by owner/name of the repository, alphabetically by default
+	SortName SortKey = "name"
+
+	// SortLanguage - by language, alphabetically by default
+	SortLanguage SortKey = "language"
+
+	// SortRandom - in random order. It cannot be combined with other keys.
+	SortRandom SortKey = "random"
+)
+
+// sortKeys lists the keys stars can be sorted by, with whether they sort in
+// descending order by default
+var sortKeys = []struct {
+	key        SortKey
+	descending bool
+}{
+	{SortStars, true},
+	{SortStarred, true},
+	{SortPushed, true},
+	{SortName, false},
+	{SortLanguage, false},
+	{SortRandom, false},
+}
+
+// sortKeyAliases map alternative names of sort keys to their names, matching
+// the names of query fields
+var sortKeyAliases = map[string]string{
+	"lang":       string(SortLanguage),
+	"repo":       string(SortName),
+	"stargazers": string(SortStars),
+}
+
+// SortField is a key of a sort order, in a direction
+type SortField struct {
+	Key        SortKey
+	Descending bool
+}
+
+// SortSpec orders stars by its first field, then by the next ones for stars
+// that are equal by it, and finally by URL. An empty SortSpec is DefaultSort.
+// Stars whose value for a field is unknown (no language, or an unknown time)
+// come after the others, whatever the direction.
+type SortSpec []SortField
+
+// DefaultSort orders stars by stargazers, most first
+var DefaultSort = SortSpec{{Key: SortStars, Descending: true}}
+
+// RandomSort shuffles stars
+var RandomSort = SortSpec{{Key: SortRandom}}
+
+// ParseSortSpec parses a comma-separated list of sort keys, each optionally
+// followed by :asc or :desc to override its default direction, e.g.
+// "language,stars:asc". Keys sort in their natural direction by default: most
+// stars and newest times first, names and languages alphabetically.
+func ParseSortSpec(text string) (SortSpec, error) {
+	spec := SortSpec{}
+	if strings.TrimSpace(text) == "" {
+		return spec, nil
+	}
+
+	keys := []string{}
+	for _, k := range sortKeys {
+		keys = append(keys, string(k.key))
+	}
+
+	for _, part := range strings.Split(text, ",") {
+		name, direction := strings.TrimSpace(part), ""
+		if i := strings.Index(name, ":"); i >= 0 {
+			name, direction = name[:i], name[i+1:]
+		}
+
+		key := strings.ToLower(name)
+		if alias, ok := sortKeyAliases[key]; ok {
+			key = alias
+		}
+
+		field := SortField{}
+		found := false
+		for _, k := range sortKeys {
+			if string(k.key) == key {
+				field, found = SortField{Key: k.key, Descending: k.descending}, true
+			}
+		}
+
+		if !found {
+			return nil, fmt.Errorf(
+				"unknown sort key %q (must be one of %s)", name, strings.Join(keys, ", "),
+			)
+		}
+
+		switch strings.ToLower(direction) {
+		case "":
+		case "asc":
+			field.Descending = false
+		case "desc":
+			field.Descending = true
+		default:
+			return nil, fmt.Errorf("unknown sort direction %q for %s (must be asc or desc)", direction, name)
+		}
+
+		spec = append(spec, field)
+	}
+
+	if spec.random() && len(spec) > 1 {
+		return nil, fmt.Errorf("%s cannot be combined with other sort keys", SortRandom)
+	}
+
+	return spec, nil
+}
+
+// String returns the spec in the form ParseSortSpec parses
+func (s SortSpec) String() string {
+	parts := []string{}
+	for _, field := range s {
+		if field.Key == SortRandom {
+			parts = append(parts, string(field.Key))
+			continue
+		}
+
+		direction := "asc"
+		if field.Descending {
+			direction = "desc"
+		}
+
+		parts = append(parts, string(field.Key)+":"+direction)
+	}
+
+	return strings.Join(parts, ",")
+}
+
+// Reverse returns the spec with the direction of every field flipped
+func (s SortSpec) Reverse() SortSpec {
+	reversed := SortSpec{}
+	for _, field := range s.orDefault() {
+		reversed = append(reversed, SortField{Key: field.Key, Descending: !field.Descending})
+	}
+
+	return reversed
+}
+
+// Sort sorts stars in place. Random orders are seeded with seed.
+func (s SortSpec) Sort(stars []*Star, seed int64) {
+	if s.random() {
+		r := rand.New(rand.NewSource(seed))
+		r.Shuffle(len(stars), func(i, j int) {
+			stars[i], stars[j] = stars[j], stars[i]
+		})
+
+		return
+	}
+
+	spec := s.orDefault()
+	sort.SliceStable(stars, func(i, j int) bool {
+		for _, field := range spec {
+			if c := field.compare(stars[i], stars[j]); c != 0 {
+				return c < 0
+			}
+		}
+
+		return stars[i].URL < stars[j].URL
+	})
+}
+
+// random reports whether the spec shuffles stars
+func (s SortSpec) random() bool {
+	for _, field := range s {
+		if field.Key == SortRandom {
+			return true
+		}
+	}
+
+	return false
+}
+
+// orDefault returns the spec, or DefaultSort if it is empty
+func (s SortSpec) orDefault() SortSpec {
+	if len(s) == 0 {
+		return DefaultSort
+	}
+
+	return s
+}
+
+// compare returns a negative number if a sorts before b by the field, a
+// positive one if it sorts after, and zero if they are equal
+func (f SortField) compare(a, b *Star) int {
+	c := 0
+
+	switch f.Key {
+	case SortStars:
+		c = a.Stargazers - b.Stargazers
+	case SortStarred:
+		return f.compareTimes(a.StarredAt, b.StarredAt)
+	case SortPushed:
+		return f.compareTimes(a.PushedAt, b.PushedAt)
+	case SortName:
+		c = strings.Compare(strings.ToLower(starName(a)), strings.ToLower(starName(b)))
+	case SortLanguage:
+		switch {
+		case a.Language == b.Language:
+			return 0
+		case a.Language == "":
+			return 1
+		case b.Language == "":
+			return -1
+		}
+
+		c = strings.Compare(strings.ToLower(a.Language), strings.ToLower(b.Language))
+	}
+
+	if f.Descending {
+		return -c
+	}
+
+	return c
+}
+
+// compareTimes compares times in the direction of the field, with unknown
+// times last
+func (f SortField) compareTimes(a, b time.Time) int {
+	switch {
+	case a.Equal(b):
+		return 0
+	case a.IsZero():
+		return 1
+	case b.IsZero():
+		return -1
+	case a.Before(b) != f.Descending:
+		return -1
+	default:
+		return 1
+	}
+}
@@ -0,0 +1,92 @@
+package starmanager
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSortSpec(t *testing.T) {
+	for text, expected := range map[string]SortSpec{
+		"":                       {},
+		"stars":                  {{Key: SortStars, Descending: true}},
+		"Stargazers:ASC":         {{Key: SortStars}},
+		"language, stars":        {{Key: SortLanguage}, {Key: SortStars, Descending: true}},
+		"pushed:asc,name:desc":   {{Key: SortPushed}, {Key: SortName, Descending: true}},
+		"starred,repo,lang:desc": {{Key: SortStarred, Descending: true}, {Key: SortName}, {Key: SortLanguage, Descending: true}},
+		"random":                 RandomSort,
+	} {
+		spec, err := ParseSortSpec(text)
+		assert.NoError(t, err, text)
+		assert.Equal(t, expected, spec, text)
+
+		// The spec can be written back out
+		if len(spec) > 0 {
+			parsed, err := ParseSortSpec(spec.String())
+			assert.NoError(t, err, text)
+			assert.Equal(t, spec, parsed, text)
+		}
+	}
+
+	for text, expected := range map[string]string{
+		"forks":         `unknown sort key "forks" (must be one of stars, starred, pushed, name, language, random)`,
+		"stars:up":      `unknown sort direction "up" for stars (must be asc or desc)`,
+		"stars,":        `unknown sort key "" (must be one of stars, starred, pushed, name, language, random)`,
+		"random,stars":  `random cannot be combined with other sort keys`,
+		"name,random:x": `unknown sort direction "x" for random (must be asc or desc)`,
+	} {
+		_, err := ParseSortSpec(text)
+		assert.EqualError(t, err, expected, text)
+	}
+}
+
+func TestSortSpecSort(t *testing.T) {
+	urls := func(stars []*Star) []string {
+		result := []string{}
+		for _, star := range stars {
+			result = append(result, starName(star))
+		}
+
+		return result
+	}
+
+	for text, expected := range map[string][]string{
+		// queryFixtures has stars 800, 450, 2000 and 0
+		"":                 {"c/three", "a/one", "b/two", "d/four"},
+		"stars:asc":        {"d/four", "b/two", "a/one", "c/three"},
+		"name:desc":        {"d/four", "c/three", "b/two", "a/one"},
+		"language,stars":   {"c/three", "a/one", "d/four", "b/two"},
+		"language:desc":    {"b/two", "d/four", "a/one", "c/three"},
+		"pushed":           {"a/one", "b/two", "c/three", "d/four"},
+		"pushed:asc":       {"c/three", "b/two", "a/one", "d/four"},
+		"starred,name":     {"b/two", "a/one", "c/three", "d/four"},
+		"starred:asc,name": {"a/one", "b/two", "c/three", "d/four"},
+	} {
+		spec, err := ParseSortSpec(text)
+		assert.NoError(t, err, text)
+
+		stars := append([]*Star{}, queryFixtures...)
+		spec.Sort(stars, 0)
+		assert.Equal(t, expected, urls(stars), text)
+	}
+
+	// Reversing flips every key, so unknown times still come last
+	spec, err := ParseSortSpec("pushed:asc")
+	assert.NoError(t, err)
+
+	stars := append([]*Star{}, queryFixtures...)
+	spec.Reverse().Sort(stars, 0)
+	assert.Equal(t, []string{"a/one", "b/two", "c/three", "d/four"}, urls(stars))
+
+	stars = append([]*Star{}, queryFixtures...)
+	SortSpec{}.Reverse().Sort(stars, 0)
+	assert.Equal(t, []string{"d/four", "b/two", "a/one", "c/three"}, urls(stars))
+
+	// Random orders are the same for the same seed
+	first := append([]*Star{}, queryFixtures...)
+	RandomSort.Sort(first, 42)
+	second := append([]*Star{}, queryFixtures...)
+	RandomSort.Sort(second, 42)
+	assert.Equal(t, urls(first), urls(second))
+	assert.ElementsMatch(t, urls(queryFixtures), urls(first))
+}
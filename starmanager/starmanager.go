@@ -6,28 +6,24 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"math/rand"
 	"net/http"
 	"net/url"
 	"os"
-	"os/user"
 	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/hashicorp/go-multierror"
-
-	"github.com/asdine/storm"
-	"github.com/asdine/storm/q"
 	"github.com/gkze/gh-stars/auth"
+	"github.com/gkze/gh-stars/transport"
 	"github.com/gkze/gh-stars/utils"
 	"github.com/google/go-github/v25/github"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/afero"
 	"go.uber.org/multierr"
 	"golang.org/x/oauth2"
+	"golang.org/x/sync/errgroup"
 )
 
 const (
@@ -37,12 +33,35 @@ const (
 	// GitHubAPIHost - the GitHub API host
 	GitHubAPIHost string = "api." + GitHubHost
 
-	// CachePath - the path to the cache db file
+	// CachePath - the directory of the cache db file, relative to the home
+	// directory, when $XDG_CACHE_HOME is not set
 	CachePath string = ".cache"
 
 	// CacheFile - the filename of the db cache
 	CacheFile string = "stars.db"
 
+	// CacheEnvVar - the environment variable overriding the directory the db
+	// cache files are kept in
+	CacheEnvVar string = "STARS_CACHE"
+
+	// XDGCacheHomeEnvVar - the environment variable holding the base
+	// directory for user-specific cache files
+	XDGCacheHomeEnvVar string = "XDG_CACHE_HOME"
+
+	// XDGCacheDir - the directory of the db cache files in $XDG_CACHE_HOME
+	XDGCacheDir string = "stars"
+
+	// SQLiteCacheExt - the extension of the db cache when using the SQLite
+	// backend
+	SQLiteCacheExt string = ".sqlite"
+
+	// BackendStorm - the default storage backend, a Storm (BoltDB) database
+	BackendStorm string = "storm"
+
+	// BackendSQLite - the SQLite storage backend, which supports raw SQL
+	// queries
+	BackendSQLite string = "sqlite"
+
 	// PageSize - the default response page size (GitHub maximum is 100 so we
 	// use that)
 	PageSize int = 100
@@ -83,107 +102,413 @@ type Star struct {
 	// URL is the full web URL of the repository (html_url field in the GitHub
 	// API)
 	URL string `storm:"id,index,unique"`
+
+	// SyncedAt is when the repository metadata was last fetched from GitHub
+	SyncedAt time.Time
+
+	// License is the SPDX identifier of the repository license, if known
+	License string
+
+	// Parent is the URL of the repository this one was forked from, empty if
+	// it is not a fork (only fetched by the GraphQL fetcher)
+	Parent string
+
+	// DiskUsage is the size of the repository in kilobytes
+	DiskUsage int
+
+	// LatestRelease is the tag name of the latest release, if any (only
+	// fetched by the GraphQL fetcher)
+	LatestRelease string
+
+	// OpenIssues is the number of open issues, excluding pull requests (only
+	// fetched by the GraphQL fetcher)
+	OpenIssues int
+}
+
+// newStar builds a Star from a repository fetched from GitHub at syncedAt
+func newStar(repo *github.Repository, starredAt, syncedAt time.Time) *Star {
+	return &Star{
+		PushedAt:    repo.GetPushedAt().Time,
+		StarredAt:   starredAt,
+		URL:         repo.GetHTMLURL(),
+		Language:    strings.ToLower(repo.GetLanguage()),
+		Stargazers:  repo.GetStargazersCount(),
+		Description: repo.GetDescription(),
+		Topics:      repo.Topics,
+		Archived:    repo.GetArchived(),
+		SyncedAt:    syncedAt,
+		License:     repo.GetLicense().GetSPDXID(),
+		DiskUsage:   repo.GetSize(),
+	}
+}
+
+// keepGraphQLFields copies the metadata that only the GraphQL fetcher fetches
+// from the cached version of a star, so that refreshing it through the REST
+// API does not erase it
+func (s *Star) keepGraphQLFields(cached *Star) {
+	s.Parent = cached.Parent
+	s.LatestRelease = cached.LatestRelease
+	s.OpenIssues = cached.OpenIssues
+}
+
+// newRESTStar builds a Star from a repository fetched through the REST API at
+// syncedAt, keeping the GraphQL-only metadata of its cached version, if any
+func (s *StarManager) newRESTStar(
+	repo *github.Repository, starredAt, syncedAt time.Time,
+) (*Star, error) {
+	star := newStar(repo, starredAt, syncedAt)
+
+	cached, err := s.store.Get(star.URL)
+	if errors.Is(err, ErrStarNotFound) {
+		return star, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	star.keepGraphQLFields(cached)
+
+	return star, nil
 }
 
 // StarManager is the central object used to manage stars for a GitHub account
 type StarManager struct {
-	username string
-	password string
-	context  context.Context
-	client   *github.Client
-	db       *storm.DB
+	host             string
+	username         string
+	password         string
+	credentialSource string
+	tokenInfo        *TokenInfo
+	client           *github.Client
+	httpClient       *http.Client
+	etag             *transport.ETagTransport
+	store            Store
+	log              *log.Logger
+	now              func() time.Time
+	fs               afero.Fs
+}
+
+// Config holds the parameters needed to construct a StarManager
+type Config struct {
+	// Host is the GitHub web host, e.g. github.com (the default) or the
+	// hostname of a GitHub Enterprise Server instance
+	Host string
+
+	// Auth supplies the credentials for the GitHub API host
+	Auth auth.Interface
+
+	// Profile is the name of the account profile in use, if any. Each
+	// profile gets its own cache.
+	Profile string
+
+	// Store is where stars are persisted. If nil, a database of the type
+	// given by Backend is opened at CacheFile.
+	Store Store
+
+	// Backend is the storage backend, BackendStorm (the default) or
+	// BackendSQLite
+	Backend string
+
+	// CacheFile is the path to the local database. If empty, it defaults to
+	// DefaultCachePath for the host, profile and backend.
+	CacheFile string
+
+	// SkipMigrations leaves the cache at its current schema version instead
+	// of upgrading it on open
+	SkipMigrations bool
 }
 
-// New constructs a new StarManager object. This method reads authentication
-// configuration from the user's ~/.netrc file for the GitHub API host.
-func New(logLevel log.Level) (*StarManager, error) {
+// New constructs a new StarManager object. Credentials for the GitHub API
+// host are resolved from the default provider chain ($GITHUB_TOKEN,
+// $GH_TOKEN, the given token file, the gh CLI configuration and ~/.netrc).
+// It sets the level of the global logger, which the StarManager logs to.
+func New(logLevel log.Level, tokenFile string) (*StarManager, error) {
 	log.Tracef("Setting log level to %+v\n", logLevel)
 	log.SetLevel(logLevel)
 
-	log.Debug("Initializing auth")
-	cfg, err := auth.NewConfig()
-	if err != nil {
-		log.Errorf("Could not parse netrc config: %v", err)
+	return NewWithOptions(WithAuth(auth.NewDefaultChain(tokenFile)))
+}
 
-		return nil, err
+// NewWithConfig constructs a new StarManager object from the given
+// configuration
+func NewWithConfig(cfg *Config) (*StarManager, error) {
+	opts := []Option{
+		WithHost(cfg.Host),
+		WithProfile(cfg.Profile),
+		WithBackend(cfg.Backend),
+		WithCacheFile(cfg.CacheFile),
+		WithSkipMigrations(cfg.SkipMigrations),
+	}
+	if cfg.Auth != nil {
+		opts = append(opts, WithAuth(cfg.Auth))
+	}
+	if cfg.Store != nil {
+		opts = append(opts, WithStore(cfg.Store))
+	}
+
+	return NewWithOptions(opts...)
+}
+
+// NewWithOptions constructs a new StarManager object configured by the given
+// options, for embedding in other programs. An auth provider is required.
+// Unlike New, it leaves global state alone, and only looks at the environment
+// and the home directory to locate the cache if neither a store nor a cache
+// file is given.
+func NewWithOptions(opts ...Option) (*StarManager, error) {
+	o := &options{
+		host:       GitHubHost,
+		httpClient: &http.Client{},
+		logger:     log.StandardLogger(),
+		clock:      time.Now,
+		fs:         afero.NewOsFs(),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if o.auth == nil {
+		return nil, errors.New("no auth provider configured")
+	}
+
+	// Databases can only be opened on the OS filesystem
+	if _, ok := o.fs.(*afero.OsFs); !ok && o.store == nil {
+		return nil, errors.New("a store is required when the filesystem is not the OS filesystem")
 	}
 
-	log.Debug("Parsing auth credentials from .netrc")
-	netrcAuth, err := auth.NewNetrc(cfg)
-	username, password, err := netrcAuth.GetAuth(GitHubAPIHost)
+	logger := o.logger
+
+	logger.Debugf("Resolving auth credentials for %s\n", APIHost(o.host))
+	creds, err := resolveCredentials(o.auth, APIHost(o.host))
 	if err != nil {
-		log.Errorf(
-			"Could not find authentication credentials for %s in netrc configuration",
-			GitHubAPIHost,
-		)
+		logger.Errorf("Could not find authentication credentials: %v", err)
 
 		return nil, err
 	}
+	logger.Infof("Using GitHub credentials from %s\n", creds.Source)
+
+	store := o.store
+	if store == nil {
+		store, err = openCache(o.fs, logger, o.cacheFile, o.host, o.profile, o.backend)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !o.skipMigrations {
+		if _, err := migrate(logger, o.clock, store, false); err != nil {
+			store.Close()
+
+			return nil, fmt.Errorf("could not migrate cache: %w", err)
+		}
+	}
 
-	log.Trace("Initializing context")
-	ctx := context.Background()
-	client := github.NewClient(oauth2.NewClient(
-		ctx, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: password}),
-	))
+	// The given client's transport sends the requests, after they have been
+	// authenticated, checked against the ETag cache and rate limited
+	httpClient := *o.httpClient
+	base := httpClient.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
 
-	log.Debug("Determining current user")
-	currentUser, err := user.Current()
+	rateLimit := transport.NewRateLimit(base)
+	rateLimit.Logger = logger
+	etag := transport.NewETag(rateLimit, metaCache{store, ETagKeyPrefix})
+	etag.Logger = logger
+	httpClient.Transport = &oauth2.Transport{
+		Source: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: creds.Password}),
+		Base:   etag,
+	}
+
+	client, err := newClient(o.host, &httpClient)
+	if err == nil && o.baseURL != "" {
+		client.BaseURL, err = url.Parse(strings.TrimSuffix(o.baseURL, "/") + "/")
+	}
 	if err != nil {
-		log.Errorf("Could not determine the current user! %v\n", err)
+		logger.Errorf("Could not create GitHub client for %s: %v", o.host, err)
+		store.Close()
 
 		return nil, err
 	}
-	log.Debugf("Current user: %s\n", currentUser.Username)
 
-	log.Debug("Ensuring local cache")
-	cacheDir := filepath.Join(currentUser.HomeDir, CachePath)
-	cacheFullPath := filepath.Join(cacheDir, CacheFile)
+	return &StarManager{
+		host:             o.host,
+		username:         creds.Username,
+		password:         creds.Password,
+		credentialSource: creds.Source,
+		client:           client,
+		httpClient:       &httpClient,
+		etag:             etag,
+		store:            store,
+		log:              logger,
+		now:              o.clock,
+		fs:               o.fs,
+	}, nil
+}
+
+// openCache opens the database for the given backend at cacheFullPath, or at
+// the default location for the host and profile if cacheFullPath is empty (see
+// DefaultCachePath). Its directory is created on fs if missing.
+func openCache(
+	fs afero.Fs, logger *log.Logger, cacheFullPath, host, profile, backend string,
+) (Store, error) {
+	if backend == "" {
+		backend = BackendStorm
+	}
+
+	if backend != BackendStorm && backend != BackendSQLite {
+		return nil, fmt.Errorf("unknown storage backend %s", backend)
+	}
+
+	if cacheFullPath == "" {
+		var err error
+		if cacheFullPath, err = DefaultCachePath(host, profile, backend); err != nil {
+			return nil, err
+		}
+	}
 
+	logger.Debug("Ensuring local cache")
 	for _, p := range []struct {
 		path string
 		mode os.FileMode
 	}{
-		{cacheDir, os.ModeDir},
+		{filepath.Dir(cacheFullPath), os.ModeDir},
 		{cacheFullPath, 0},
 	} {
-		err := utils.CreateIfNotExists(p.path, p.mode, afero.NewOsFs())
-		if err != nil {
-			log.Infof("An error occurred while attempting to create %s: %v\n",
-				p.path, err,
-			)
+		if err := utils.CreateIfNotExists(p.path, p.mode, fs); err != nil {
+			return nil, fmt.Errorf("could not create %s: %w", p.path, err)
 		}
 	}
 
-	log.Debug("Initializing Storm/Bolt")
-	db, err := storm.Open(cacheFullPath, storm.Batch())
+	var (
+		store Store
+		err   error
+	)
+
+	if backend == BackendSQLite {
+		logger.Debug("Initializing SQLite")
+		store, err = OpenSQLiteStore(cacheFullPath)
+	} else {
+		logger.Debug("Initializing Storm/Bolt")
+		store, err = OpenStormStore(cacheFullPath)
+	}
 	if err != nil {
-		log.Errorf("An error occurred opening the db! %v", err)
+		logger.Errorf("An error occurred opening the db! %v", err)
 
 		return nil, err
 	}
 
-	return &StarManager{
-		username: username,
-		password: password,
-		context:  ctx,
-		client:   client,
-		db:       db,
+	return store, nil
+}
+
+// APIHost returns the hostname serving the REST API for a GitHub web host.
+// github.com has a dedicated API host, while GitHub Enterprise Server serves
+// its API from the web host under /api/v3.
+func APIHost(host string) string {
+	if host == GitHubHost {
+		return GitHubAPIHost
+	}
+
+	return host
+}
+
+// CacheFileFor returns the cache filename for a GitHub web host, profile and
+// storage backend, so that stars from different accounts are kept apart
+func CacheFileFor(host, profile, backend string) string {
+	ext := filepath.Ext(CacheFile)
+	if backend == BackendSQLite {
+		ext = SQLiteCacheExt
+	}
+
+	name := strings.TrimSuffix(CacheFile, filepath.Ext(CacheFile))
+
+	suffix := profile
+	if suffix == "" && host != GitHubHost {
+		suffix = host
+	}
+
+	if suffix == "" {
+		return name + ext
+	}
+
+	return fmt.Sprintf("%s-%s%s", name, suffix, ext)
+}
+
+// newClient creates a GitHub API client for the given web host
+func newClient(host string, httpClient *http.Client) (*github.Client, error) {
+	if host == GitHubHost {
+		return github.NewClient(httpClient), nil
+	}
+
+	return github.NewEnterpriseClient(
+		fmt.Sprintf("https://%s/api/v3/", host),
+		fmt.Sprintf("https://%s/api/uploads/", host),
+		httpClient,
+	)
+}
+
+// resolveCredentials looks up the credentials for host, keeping track of the
+// source that supplied them when the provider is able to report it
+func resolveCredentials(a auth.Interface, host string) (*auth.Credentials, error) {
+	if chain, ok := a.(*auth.Chain); ok {
+		return chain.Resolve(host)
+	}
+
+	username, password, err := a.GetUsernamePassword(host)
+	if err != nil {
+		return nil, err
+	}
+
+	return &auth.Credentials{
+		Username: username,
+		Password: password,
+		Source:   auth.Describe(a),
 	}, nil
 }
 
-// ClearCache resets the filesystem-local cache database file.
+// Host returns the GitHub web host this StarManager talks to
+func (s *StarManager) Host() string {
+	return s.host
+}
+
+// CredentialSource describes where the credentials in use came from
+func (s *StarManager) CredentialSource() string {
+	return s.credentialSource
+}
+
+// Store returns the store stars are persisted in
+func (s *StarManager) Store() Store {
+	return s.store
+}
+
+// SQL runs a raw, read-only SQL query against the cache, returning the column
+// names and rows. Only the SQLite backend supports this.
+func (s *StarManager) SQL(query string) ([]string, [][]string, error) {
+	querier, ok := s.store.(SQLQuerier)
+	if !ok {
+		return nil, nil, ErrSQLUnsupported
+	}
+
+	return querier.RawQuery(query)
+}
+
+// Close closes the local cache database
+func (s *StarManager) Close() error {
+	return s.store.Close()
+}
+
+// ClearCache removes every star from the local cache, along with everything
+// recorded about them (ETags, the last sync, the search index...), so that the
+// next save fetches them all again. See Store.Clear.
 func (s *StarManager) ClearCache() error {
-	log.Debug("Clearing out cache")
-	return os.Remove(s.db.Bolt.Path())
+	s.log.Debug("Clearing out cache")
+	return s.store.Clear()
 }
 
 // StarRepository stars a given repository by owner and repository name
-func (s *StarManager) StarRepository(owner, repo string) error {
-	log.Debugf("Starring %s/%s\n", owner, repo)
+func (s *StarManager) StarRepository(ctx context.Context, owner, repo string) error {
+	s.log.Debugf("Starring %s/%s\n", owner, repo)
 
-	resp, err := s.client.Activity.Star(s.context, owner, repo)
+	resp, err := s.client.Activity.Star(ctx, owner, repo)
 	if err != nil {
-		log.Errorf(
+		s.log.Errorf(
 			"An error occurred starring a repository! Error: %+v, Response: %+v\n",
 			err, resp,
 		)
@@ -191,10 +516,10 @@ func (s *StarManager) StarRepository(owner, repo string) error {
 		return err
 	}
 
-	if resp.StatusCode == (http.StatusOK | http.StatusNoContent) {
-		log.Infof("Successfully starred %s/%s", owner, repo)
+	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusNoContent {
+		s.log.Infof("Successfully starred %s/%s", owner, repo)
 	} else {
-		log.Warningf("Got non-200 response for %s/%s: %d",
+		s.log.Warningf("Got non-200 response for %s/%s: %d",
 			owner, repo, resp.StatusCode,
 		)
 	}
@@ -202,63 +527,90 @@ func (s *StarManager) StarRepository(owner, repo string) error {
 	return nil
 }
 
+// starResult is the outcome of evaluating a repository for starring
+type starResult struct {
+	starred bool
+	err     error
+}
+
 func (s *StarManager) starReposFromURLsChan(
+	ctx context.Context,
 	g *sync.WaitGroup,
 	urlsChan chan *url.URL,
-	successfulStars chan int,
+	results chan starResult,
 	notOlderThanMonths int,
 ) {
-	g.Add(1)
 	defer g.Done()
 
-	wg := sync.WaitGroup{}
-	defer wg.Wait()
-	then := time.Now().AddDate(0, -notOlderThanMonths, 0)
+	then := s.now().AddDate(0, -notOlderThanMonths, 0)
 
 	for u := range urlsChan {
-		log.Debugf("Got URL: %+v\n", u)
+		// Once cancelled, the remaining URLs are drained without requests,
+		// and the cancellation is reported once by the caller
+		if ctx.Err() != nil {
+			continue
+		}
+
+		s.log.Debugf("Got URL: %+v\n", u)
 
 		parts := strings.Split(strings.Trim((*u).EscapedPath(), "/"), "/")
 		if len(parts) != 2 {
-			log.Errorf("%+v invalid", u)
+			s.log.Errorf("%+v invalid", u)
 			continue
 		}
 
-		log.Infof("Evaluating %s/%s\n", parts[0], parts[1])
-		repo, _, err := s.client.Repositories.Get(s.context, parts[0], parts[1])
+		s.log.Infof("Evaluating %s/%s\n", parts[0], parts[1])
+		repo, _, err := s.client.Repositories.Get(ctx, parts[0], parts[1])
+		if ctx.Err() != nil {
+			continue
+		}
 		if err != nil {
-			log.Errorf("encountered error: %+v", err)
+			s.log.Errorf("encountered error: %+v", err)
+			results <- starResult{err: fmt.Errorf("could not get %s: %w", u, err)}
 			continue
 		}
 
 		owner := repo.GetOwner().GetLogin()
 		name := repo.GetName()
 
-		log.Debugf("Checking whether %s/%s is starred\n", owner, name)
-		starred, _, err := s.client.Activity.IsStarred(s.context, owner, name)
+		s.log.Debugf("Checking whether %s/%s is starred\n", owner, name)
+		starred, _, err := s.client.Activity.IsStarred(ctx, owner, name)
+		if ctx.Err() != nil {
+			continue
+		}
 		if err != nil {
-			log.Errorf("Encountered error: %+v", err)
+			s.log.Errorf("Encountered error: %+v", err)
+			results <- starResult{err: fmt.Errorf(
+				"could not check whether %s/%s is starred: %w", owner, name, err,
+			)}
 			continue
 		}
 		if starred {
-			log.Infof("%s/%s already starred - skipping\n", owner, name)
+			s.log.Infof("%s/%s already starred - skipping\n", owner, name)
 			continue
 		}
 
-		if !(repo.GetPushedAt().Before(then) || repo.GetArchived()) {
-			if err := s.StarRepository(owner, name); err != nil {
-				log.Errorf(
+		tooOld := notOlderThanMonths > 0 && repo.GetPushedAt().Before(then)
+		if !(tooOld || repo.GetArchived()) {
+			if err := s.StarRepository(ctx, owner, name); err != nil {
+				if ctx.Err() != nil {
+					continue
+				}
+
+				s.log.Errorf(
 					"failed to star %s/%s\n",
 					repo.GetOwner().GetLogin(),
 					repo.GetName(),
 				)
+				results <- starResult{err: fmt.Errorf(
+					"could not star %s/%s: %w", owner, name, err,
+				)}
 				continue
 			}
 
-			wg.Add(1)
-			go func() { defer wg.Done(); successfulStars <- 1 }()
+			results <- starResult{starred: true}
 		} else {
-			log.Infof(
+			s.log.Infof(
 				"%s/%s does not qualify - archived: %t, pushed: %s\n",
 				repo.GetOwner().GetLogin(),
 				repo.GetName(),
@@ -269,204 +621,175 @@ func (s *StarManager) starReposFromURLsChan(
 	}
 }
 
-// StarRepositoriesFromURLs stars each repository in the given slice of
-// repository URLs
-func (s *StarManager) StarRepositoriesFromURLs(
-	urls []*url.URL, notOlderThanMonths, maxConcurrency int,
+// starReposFromURLs stars the repositories whose URLs are sent on urlsCh by
+// feed, which may also report its own errors on the results channel and must
+// stop sending once ctx is done. It returns the number of repositories starred
+// and all errors encountered.
+func (s *StarManager) starReposFromURLs(
+	ctx context.Context,
+	feed func(urlsCh chan *url.URL, results chan starResult),
+	notOlderThanMonths, maxConcurrency int,
 ) (int, error) {
-	log.Debugf("Preparing to star %d repositories\n", len(urls))
-
 	urlsCh := make(chan *url.URL)
-	starCountCh := make(chan int)
+	results := make(chan starResult)
 	wg := sync.WaitGroup{}
 
-	log.Debugf("Spawning %d goroutines\n", maxConcurrency)
+	s.log.Debugf("Spawning %d goroutines\n", maxConcurrency)
 	for i := 0; i < maxConcurrency; i++ {
-		go s.starReposFromURLsChan(&wg, urlsCh, starCountCh, notOlderThanMonths)
-	}
-
-	for _, u := range urls {
-		urlsCh <- u
+		wg.Add(1)
+		go s.starReposFromURLsChan(ctx, &wg, urlsCh, results, notOlderThanMonths)
 	}
-	close(urlsCh)
 
 	go func() {
+		feed(urlsCh, results)
+		close(urlsCh)
 		wg.Wait()
-		close(starCountCh)
+		close(results)
 	}()
 
 	total := 0
-	for count := range starCountCh {
-		total += count
+	var errs error
+	for result := range results {
+		if result.starred {
+			total++
+		}
+
+		errs = multierr.Append(errs, result.err)
 	}
+	errs = multierr.Append(errs, ctx.Err())
 
 	if total == 0 {
-		log.Warn("Added 0 repos")
-		return 0, nil
+		s.log.Warn("Added 0 repos")
+	} else {
+		s.log.Infof("Successfully starred %d repos\n", total)
 	}
 
-	log.Infof("Successfully starred %d repos\n", total)
-	return total, nil
+	return total, errs
 }
 
-func (s *StarManager) getReposFromOrgPageChan(
-	org string, orgReposPageCh chan int, reposCh chan *github.Repository,
-) {
-	for pageNo := range orgReposPageCh {
-		log.Printf("Fetching repos from page %d of %s org\n", pageNo, org)
-
-		repos, resp, err := s.client.Repositories.ListByOrg(
-			s.context,
-			org,
-			&github.RepositoryListByOrgOptions{
-				Type:        "sources",
-				ListOptions: github.ListOptions{PerPage: PageSize, Page: pageNo},
-			},
-		)
-		if err != nil {
-			log.Errorf("encountered error fetching page %d for org %s\n", pageNo, org)
-			log.Errorf("response: %+v\n", resp)
-			log.Errorf("error: %+v\n", err)
-
-			continue
-		}
-
-		log.Infof("Successfully fetched %d repos from page %d of %s org",
-			len(repos), pageNo, org,
-		)
-
-		for _, repo := range repos {
-			reposCh <- repo
-		}
+// sendURL sends u on urlsCh, reporting false if ctx is done first
+func sendURL(ctx context.Context, urlsCh chan *url.URL, u *url.URL) bool {
+	select {
+	case urlsCh <- u:
+		return true
+	case <-ctx.Done():
+		return false
 	}
 }
 
+// StarRepositoriesFromURLs stars each repository in the given slice of
+// repository URLs. Repositories not pushed to in the last notOlderThanMonths
+// months are skipped, unless notOlderThanMonths is zero or less. Cancelling
+// ctx stops starring further repositories.
+func (s *StarManager) StarRepositoriesFromURLs(
+	ctx context.Context, urls []*url.URL, notOlderThanMonths, maxConcurrency int,
+) (int, error) {
+	s.log.Debugf("Preparing to star %d repositories\n", len(urls))
+
+	return s.starReposFromURLs(
+		ctx,
+		func(urlsCh chan *url.URL, results chan starResult) {
+			for _, u := range urls {
+				if !sendURL(ctx, urlsCh, u) {
+					return
+				}
+			}
+		},
+		notOlderThanMonths,
+		maxConcurrency,
+	)
+}
+
 // StarRepositoriesFromOrg stars a given org's repositories, given that they
 // are not archived and are recently pushed to.
 func (s *StarManager) StarRepositoriesFromOrg(
-	org string, notOlderThanMonths, maxConcurrency int,
+	ctx context.Context, org string, notOlderThanMonths, maxConcurrency int,
 ) error {
 	repoURLs := []*url.URL{}
 
-	log.Infof("Listing first %d repos for %s\n", PageSize, org)
-	orgReposPage1, resp, err := s.client.Repositories.ListByOrg(
-		s.context,
-		org,
-		&github.RepositoryListByOrgOptions{
-			Type:        "sources",
-			ListOptions: github.ListOptions{PerPage: PageSize, Page: 1},
-		},
-	)
-	if err != nil {
-		return fmt.Errorf("Got error: %+v (%w)", resp, err)
-	}
-
-	log.Infof("Parsing %d repos into URLs\n", len(orgReposPage1))
-	for _, p1Repo := range orgReposPage1 {
-		repoURL, err := url.Parse(p1Repo.GetHTMLURL())
+	for pageNo := 1; pageNo != 0; {
+		s.log.Infof("Fetching repos from page %d of %s org\n", pageNo, org)
+		repos, resp, err := s.client.Repositories.ListByOrg(
+			ctx,
+			org,
+			&github.RepositoryListByOrgOptions{
+				Type:        "sources",
+				ListOptions: github.ListOptions{PerPage: PageSize, Page: pageNo},
+			},
+		)
 		if err != nil {
-			log.Errorf(
-				"encountered error parsing repo url for %s/%s: %+v",
-				org, p1Repo.GetName(), err,
+			return fmt.Errorf(
+				"could not fetch page %d of repositories for org %s: %w", pageNo, org, err,
 			)
-			continue
 		}
 
-		log.Debugf("Parsed %+v\n", repoURL)
-
-		repoURLs = append(repoURLs, repoURL)
-	}
-
-	// Gotta fetch more if that's the case
-	if resp.LastPage > 1 {
-		log.Infof("Last page is %d. Fetching the rest of the pages\n", resp.LastPage)
-
-		orgPagesCh := make(chan int)
-		reposCh := make(chan *github.Repository)
-		urlsCh := make(chan *url.URL)
-		defer func() { close(orgPagesCh); close(reposCh); close(urlsCh) }()
-
-		startIdx := 2
-		numGoroutines := resp.LastPage
-
-		if maxConcurrency > 0 {
-			startIdx = 0
-			numGoroutines = maxConcurrency
-		}
-
-		for i := startIdx; i < numGoroutines; i++ {
-			go s.getReposFromOrgPageChan(org, orgPagesCh, reposCh)
-		}
-
-		go func(opc chan int, lastPage int) {
-			// We start at 2 here since we've already fetched the first page at the
-			// beginning of this function. We also end at last page + 1 since we
-			// want to include the last page to be fetched.
-			for i := 2; i < lastPage+1; i++ {
-				opc <- i
+		s.log.Infof("Parsing %d repos into URLs\n", len(repos))
+		for _, repo := range repos {
+			repoURL, err := url.Parse(repo.GetHTMLURL())
+			if err != nil {
+				s.log.Errorf(
+					"encountered error parsing repo url for %s/%s: %+v",
+					org, repo.GetName(), err,
+				)
+				continue
 			}
-		}(orgPagesCh, resp.LastPage)
 
-		go func(rCh chan *github.Repository, uCh chan *url.URL) {
-			for repo := range reposCh {
-				repoURL, err := url.Parse(repo.GetHTMLURL())
-				if err != nil {
-					log.Errorf(
-						"encountered error parsing repo url for %s/%s: %+v",
-						org, repo.GetName(), err,
-					)
-					continue
-				}
+			s.log.Debugf("Parsed %+v\n", repoURL)
 
-				urlsCh <- repoURL
-			}
-		}(reposCh, urlsCh)
+			repoURLs = append(repoURLs, repoURL)
+		}
 
-		go func(uCh chan *url.URL, uSl []*url.URL) {
-			for u := range uCh {
-				repoURLs = append(uSl, u)
-			}
-		}(urlsCh, repoURLs)
+		pageNo = resp.NextPage
 	}
 
 	_, starErr := s.StarRepositoriesFromURLs(
-		repoURLs, notOlderThanMonths, maxConcurrency,
+		ctx, repoURLs, notOlderThanMonths, maxConcurrency,
 	)
 	return starErr
 }
 
 // StarRepositoriesFromUser stars all of a given user's repositories.
 func (s *StarManager) StarRepositoriesFromUser(
-	username string, notOlderThanMonths, maxConcurrency int,
+	ctx context.Context, username string, notOlderThanMonths, maxConcurrency int,
 ) error {
 	repoURLs := []*url.URL{}
 
-	repos, _, err := s.client.Repositories.List(
-		s.context, username, &github.RepositoryListOptions{},
-	)
-	if err != nil {
-		return fmt.Errorf(
-			"error listing repositories for user %s: %w", username, err,
+	for pageNo := 1; pageNo != 0; {
+		s.log.Infof("Fetching repos from page %d of user %s\n", pageNo, username)
+		repos, resp, err := s.client.Repositories.List(
+			ctx,
+			username,
+			&github.RepositoryListOptions{
+				ListOptions: github.ListOptions{PerPage: PageSize, Page: pageNo},
+			},
 		)
-	}
-
-	log.Infof("Parsing %d repos into URLs\n", len(repos))
-	for _, repo := range repos {
-		repoURL, err := url.Parse(repo.GetHTMLURL())
 		if err != nil {
-			log.Errorf(
-				"encountered error parsing repo url for %s/%s: %+v",
-				username, repo.GetName(), err,
+			return fmt.Errorf(
+				"could not fetch page %d of repositories for user %s: %w", pageNo, username, err,
 			)
 		}
 
-		log.Debugf("Parsed %+v\n", repoURL)
+		s.log.Infof("Parsing %d repos into URLs\n", len(repos))
+		for _, repo := range repos {
+			repoURL, err := url.Parse(repo.GetHTMLURL())
+			if err != nil {
+				s.log.Errorf(
+					"encountered error parsing repo url for %s/%s: %+v",
+					username, repo.GetName(), err,
+				)
+				continue
+			}
+
+			s.log.Debugf("Parsed %+v\n", repoURL)
 
-		repoURLs = append(repoURLs, repoURL)
+			repoURLs = append(repoURLs, repoURL)
+		}
+
+		pageNo = resp.NextPage
 	}
 
 	count, err := s.StarRepositoriesFromURLs(
-		repoURLs, notOlderThanMonths, maxConcurrency,
+		ctx, repoURLs, notOlderThanMonths, maxConcurrency,
 	)
 	if err != nil {
 		return fmt.Errorf(
@@ -475,99 +798,126 @@ func (s *StarManager) StarRepositoriesFromUser(
 		)
 	}
 
-	log.Infof("Successfully starred %d repos\n", count)
+	s.log.Infof("Successfully starred %d repos\n", count)
 	return nil
 }
 
 // StarRepositoriesFromReader stars repositories from URLs passed in an io.Reader
 func (s *StarManager) StarRepositoriesFromReader(
-	r io.Reader, maxConcurrency, notOlderThanMonths int,
+	ctx context.Context, r io.Reader, maxConcurrency, notOlderThanMonths int,
 ) (int, error) {
-	urlsCh := make(chan *url.URL)
-	starCountCh := make(chan int)
-	wg := sync.WaitGroup{}
-	var combinedErrors error
+	return s.starReposFromURLs(
+		ctx,
+		func(urlsCh chan *url.URL, results chan starResult) {
+			scanner := bufio.NewScanner(r)
+			for scanner.Scan() {
+				urlStr := scanner.Text()
+				urlStrByDot := strings.Split(urlStr, ".")
+				if urlStrByDot[len(urlStrByDot)-1] == "git" {
+					urlStrByDot = urlStrByDot[:len(urlStrByDot)-1]
+				}
+				urlStr = strings.Join(urlStrByDot, ".")
 
-	log.Debugf("Spawning %d goroutines\n", maxConcurrency)
-	for i := 0; i < maxConcurrency; i++ {
-		go s.starReposFromURLsChan(&wg, urlsCh, starCountCh, notOlderThanMonths)
-	}
+				u, err := url.Parse(urlStr)
+				if err != nil {
+					results <- starResult{err: err}
+					continue
+				}
 
-	scanner := bufio.NewScanner(r)
-	for scanner.Scan() {
-		urlStr := scanner.Text()
-		urlStrByDot := strings.Split(urlStr, ".")
-		if urlStrByDot[len(urlStrByDot)-1] == "git" {
-			urlStrByDot = urlStrByDot[:len(urlStrByDot)-1]
-		}
-		urlStr = strings.Join(urlStrByDot, ".")
+				if !sendURL(ctx, urlsCh, u) {
+					return
+				}
+			}
+
+			if err := scanner.Err(); err != nil {
+				results <- starResult{err: err}
+			}
+		},
+		notOlderThanMonths,
+		maxConcurrency,
+	)
+}
+
+// CopyStarsFrom stars every repository cached by another StarManager (e.g.
+// one for a different profile), regardless of when it was last pushed to.
+// Archived repositories are skipped.
+func (s *StarManager) CopyStarsFrom(
+	ctx context.Context, src *StarManager, maxConcurrency int,
+) (int, error) {
+	stars, err := src.store.All()
+	if err != nil {
+		return 0, err
+	}
 
-		u, err := url.Parse(urlStr)
+	urls := []*url.URL{}
+	for _, star := range stars {
+		u, err := url.Parse(star.URL)
 		if err != nil {
-			multierror.Append(combinedErrors, err)
+			s.log.Errorf("encountered error parsing %s: %+v", star.URL, err)
+			continue
 		}
 
-		urlsCh <- u
+		urls = append(urls, u)
 	}
-	close(urlsCh)
 
-	go func() {
-		wg.Wait()
-		close(starCountCh)
-	}()
+	s.log.Infof("Copying %d stars\n", len(urls))
+	return s.StarRepositoriesFromURLs(ctx, urls, 0, maxConcurrency)
+}
 
-	total := 0
-	for count := range starCountCh {
-		total += count
+// SaveStarredRepository saves a single starred repository to the local cache.
+func (s *StarManager) SaveStarredRepository(star *github.StarredRepository) error {
+	repoURL := star.GetRepository().GetHTMLURL()
+
+	saved, err := s.newRESTStar(star.GetRepository(), star.GetStarredAt().Time, s.now())
+	if err != nil {
+		return fmt.Errorf("could not save %s: %w", repoURL, err)
 	}
 
-	if total == 0 {
-		log.Warn("Added 0 repos")
-		return 0, nil
+	if err := s.store.Save(saved); err != nil {
+		return fmt.Errorf("could not save %s: %w", repoURL, err)
 	}
 
-	log.Infof("Successfully starred %d repos\n", total)
-	return total, combinedErrors
+	s.log.Infof("Saved %s (with topics %s)\n", repoURL, star.GetRepository().Topics)
+
+	return nil
 }
 
-// SaveStarredRepository saves a single starred repository to the local cache.
-func (s *StarManager) SaveStarredRepository(
-	star *github.StarredRepository, wg *sync.WaitGroup,
-) error {
-	defer wg.Done()
-
-	err := s.db.Save(&Star{
-		PushedAt:    star.GetRepository().GetPushedAt().Time,
-		StarredAt:   star.StarredAt.Time,
-		URL:         star.GetRepository().GetHTMLURL(),
-		Language:    strings.ToLower(star.GetRepository().GetLanguage()),
-		Stargazers:  star.GetRepository().GetStargazersCount(),
-		Description: star.GetRepository().GetDescription(),
-		Topics:      star.GetRepository().Topics,
-		Archived:    star.GetRepository().GetArchived(),
-	})
-	if err != nil {
-		return err
-	}
+// SaveError reports the pages and stars that SaveAllStars could not save
+type SaveError struct {
+	// Pages is how many pages of stars there are
+	Pages int
+
+	// FailedPages lists the pages that could not be fetched, in order
+	FailedPages []int
+
+	// FailedStars is how many stars on the fetched pages could not be saved
+	FailedStars int
 
-	log.Infof(
-		"Saved %s (with topics %s)\n",
-		star.GetRepository().GetHTMLURL(),
-		star.GetRepository().Topics,
+	// Err holds the errors of every failed page and star
+	Err error
+}
+
+// Error satisfies error for SaveError
+func (e *SaveError) Error() string {
+	return fmt.Sprintf(
+		"could not fetch %d of %d pages of stars, and could not save %d stars",
+		len(e.FailedPages), e.Pages, e.FailedStars,
 	)
-	return nil
 }
 
-// SaveStarredPage saves an entire page of starred repositories concurrently,
-// optionally sending server responses to a channel if it is provided.
-func (s *StarManager) SaveStarredPage(
-	pageno int, responses chan *github.Response,
-) chan error {
-	wg := sync.WaitGroup{}
-	errors := make(chan error)
+// Unwrap returns the errors of every failed page and star
+func (e *SaveError) Unwrap() error {
+	return e.Err
+}
 
+// saveStarredPage fetches a page of starred repositories and saves them. It
+// returns the page, the response listing it and the errors saving its stars,
+// or an error if the page could not be fetched.
+func (s *StarManager) saveStarredPage(
+	ctx context.Context, pageno int,
+) ([]*github.StarredRepository, *github.Response, []error, error) {
 	page, response, err := s.client.Activity.ListStarred(
-		s.context,
+		ctx,
 		s.username,
 		&github.ActivityListStarredOptions{
 			ListOptions: github.ListOptions{
@@ -577,96 +927,212 @@ func (s *StarManager) SaveStarredPage(
 		},
 	)
 	if err != nil {
-		log.Infof(
-			"An error occurred while fetching page %d of %s's GitHub stars: %+v\n",
-			pageno,
-			s.username,
-			err,
+		return nil, response, nil, fmt.Errorf(
+			"could not fetch page %d of %s's stars: %w", pageno, s.username, err,
 		)
-
-		errors <- err
 	}
 
-	if responses != nil {
-		responses <- response
+	s.log.Infof("Attempting to save starred projects on page %d...\n", pageno)
+	errs := []error{}
+	for _, r := range page {
+		if err := s.SaveStarredRepository(r); err != nil {
+			errs = append(errs, err)
+		}
 	}
 
-	log.Infof("Attempting to save starred projects on page %d...\n", pageno)
-	for _, r := range page {
-		wg.Add(1)
-		go s.SaveStarredRepository(r, &wg)
+	return page, response, errs, nil
+}
+
+// SaveStarredPage saves an entire page of starred repositories. It returns the
+// response listing the page, along with the errors fetching the page or saving
+// any of its stars.
+func (s *StarManager) SaveStarredPage(
+	ctx context.Context, pageno int,
+) (*github.Response, error) {
+	_, response, errs, err := s.saveStarredPage(ctx, pageno)
+	if err != nil {
+		return response, err
 	}
 
-	wg.Wait()
-	close(errors)
+	return response, multierr.Combine(errs...)
+}
 
-	return errors
+// SaveAllStars saves all of the user's starred repositories. The first page is
+// fetched on its own to learn how many pages there are, and the rest are then
+// fetched by up to maxConcurrency goroutines (one per page if not positive).
+// Pages and stars that fail do not stop the others from being saved; their
+// errors are returned together in a *SaveError. Cancelling ctx stops fetching
+// further pages.
+//
+// The pages that were saved are recorded in a SaveCheckpoint, from which
+// ResumeSaveAllStars continues if not all of them were. SaveAllStars itself
+// always starts over from the first page.
+func (s *StarManager) SaveAllStars(ctx context.Context, maxConcurrency int) error {
+	return s.saveAllStars(ctx, maxConcurrency, false)
 }
 
-// SaveAllStars saves all of the user's starred repositories
-func (s *StarManager) SaveAllStars(maxConcurrency int) error {
-	wg := sync.WaitGroup{}
-	responses := make(chan *github.Response, 1)
-
-	// Fetch the first page to determine the last page number from the response
-	// "Link" header
-	log.Info("Attempting to save first page...")
-	go s.SaveStarredPage(1, responses)
-	firstPageResponse := <-responses
-
-	// We start from 2 by default because we already fetched the first page
-	// above, we want to avoid repeating that operation
-	startPage := 2
-	startIdx := startPage
-	numGoroutines := firstPageResponse.LastPage
-
-	// If concurrency is explictly bounded, we alter the parameters to
-	// accomodate the requirements. By default we start at startPage, otherwise
-	// we start at 0 since we would like to spin up exactly numGoroutunes
-	// goroutines.
+// ResumeSaveAllStars continues an interrupted or failed SaveAllStars from its
+// checkpoint, only fetching the pages that were not saved. Stars that were
+// starred or unstarred since move between pages, so the save is started over
+// instead if the newest star or the number of pages changed, or the
+// checkpoint is older than SaveCheckpointMaxAge.
+func (s *StarManager) ResumeSaveAllStars(ctx context.Context, maxConcurrency int) error {
+	return s.saveAllStars(ctx, maxConcurrency, true)
+}
+
+// saveAllStars implements SaveAllStars and ResumeSaveAllStars
+func (s *StarManager) saveAllStars(ctx context.Context, maxConcurrency int, resume bool) error {
+	var checkpoint *SaveCheckpoint
+	if resume {
+		var err error
+		if checkpoint, err = s.SaveCheckpoint(); err != nil {
+			return err
+		}
+
+		if checkpoint == nil {
+			s.log.Info("There is no interrupted save to resume")
+		}
+	} else if err := s.clearSaveCheckpoint(); err != nil {
+		return err
+	}
+
+	// The first page is always fetched, to check that the checkpoint still
+	// matches the stars on GitHub
+	s.log.Info("Attempting to save first page...")
+	firstPage, firstPageResponse, errs, err := s.saveStarredPage(ctx, 1)
+	if ctx.Err() != nil {
+		return fmt.Errorf("saving stars was interrupted: %w", ctx.Err())
+	}
+	if err != nil {
+		return &SaveError{Pages: 1, FailedPages: []int{1}, Err: err}
+	}
+
+	pages := firstPageResponse.LastPage
+	if pages == 0 {
+		pages = 1
+	}
+
+	newest := ""
+	if len(firstPage) > 0 {
+		newest = firstPage[0].GetRepository().GetHTMLURL()
+	}
+
+	if checkpoint != nil {
+		if reason := checkpoint.outdated(s.now(), pages, newest); reason != "" {
+			s.log.Warnf("Starting the save over instead of resuming it: %s\n", reason)
+			checkpoint = nil
+		} else {
+			s.log.Infof(
+				"Resuming the save started at %s, %d of %d pages were saved\n",
+				checkpoint.StartedAt.Local().Format(time.RFC1123), len(checkpoint.Saved), pages,
+			)
+		}
+	}
+
+	if checkpoint == nil {
+		checkpoint = &SaveCheckpoint{
+			Pages: pages, Newest: newest, Saved: []int{}, StartedAt: s.now(),
+		}
+	}
+
+	if len(errs) == 0 {
+		checkpoint.markSaved(1)
+	}
+	if err := s.saveSaveCheckpoint(checkpoint); err != nil {
+		return err
+	}
+
+	var (
+		mu          sync.Mutex
+		allErrs     = errs
+		failedPages []int
+	)
+
+	group, groupCtx := errgroup.WithContext(ctx)
 	if maxConcurrency > 0 {
-		numGoroutines = maxConcurrency
-		startIdx = 0
+		group.SetLimit(maxConcurrency)
+	}
+
+	// The checkpoint is updated as pages are saved, so the pages to save are
+	// picked first
+	pending := []int{}
+	for pageno := 2; pageno <= checkpoint.Pages; pageno++ {
+		if !checkpoint.saved(pageno) {
+			pending = append(pending, pageno)
+		}
 	}
 
-	log.Info("Attempting to save the rest of the pages...")
-	pagesToSave := make(chan int)
-	errsCh := make(chan error)
+	s.log.Info("Attempting to save the rest of the pages...")
+	for _, pageno := range pending {
+		pageno := pageno
 
-	for i := startIdx; i <= numGoroutines; i++ {
-		wg.Add(1)
-		go func(pagesCh chan int, errs chan error, g *sync.WaitGroup) {
-			defer g.Done()
-			for pageNo := range pagesCh {
-				for e := range s.SaveStarredPage(pageNo, nil) {
-					errs <- e
-				}
+		group.Go(func() error {
+			if err := groupCtx.Err(); err != nil {
+				return err
+			}
+
+			_, _, errs, err := s.saveStarredPage(groupCtx, pageno)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if groupCtx.Err() != nil {
+				return groupCtx.Err()
+			}
+
+			if err != nil {
+				failedPages = append(failedPages, pageno)
+				allErrs = append(allErrs, err)
 			}
-		}(pagesToSave, errsCh, &wg)
+			allErrs = append(allErrs, errs...)
+
+			if err != nil || len(errs) > 0 {
+				return nil
+			}
+
+			checkpoint.markSaved(pageno)
+
+			return s.saveSaveCheckpoint(checkpoint)
+		})
 	}
 
-	for i := startPage; i < firstPageResponse.LastPage+1; i++ {
-		pagesToSave <- i
+	if err := group.Wait(); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("saving stars was interrupted: %w", err)
+		}
+
+		return err
 	}
-	close(pagesToSave)
 
-	go func() {
-		wg.Wait()
-		close(errsCh)
-	}()
+	if len(allErrs) == 0 {
+		if err := s.clearSaveCheckpoint(); err != nil {
+			return err
+		}
 
-	var finalErrs error
-	for err := range errsCh {
-		finalErrs = multierr.Append(finalErrs, err)
+		return s.finishSync(checkpoint.StartedAt)
 	}
 
-	return finalErrs
+	sort.Ints(failedPages)
+
+	// The stars that were saved are searchable, although the cache is not
+	// considered synced
+	return multierr.Append(&SaveError{
+		Pages:       checkpoint.Pages,
+		FailedPages: failedPages,
+		FailedStars: len(allErrs) - len(failedPages),
+		Err:         multierr.Combine(allErrs...),
+	}, s.RebuildSearchIndex())
 }
 
 // SaveIfEmpty saves all stars if the local cache is empty
-func (s *StarManager) SaveIfEmpty(concurrency int) error {
-	if count, _ := s.db.Count(&Star{}); count == 0 {
-		return s.SaveAllStars(concurrency)
+func (s *StarManager) SaveIfEmpty(ctx context.Context, concurrency int) error {
+	count, err := s.store.Count()
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return s.SaveAllStars(ctx, concurrency)
 	}
 
 	return nil
@@ -681,10 +1147,9 @@ type KV struct {
 // GetTopics returns topics for a repository, otherwise if no repository is
 // passed, returns a list of all topics
 func (s *StarManager) GetTopics() []KV {
-	stars := []Star{}
 	topicCounts := map[string]int{}
 
-	s.db.All(&stars)
+	stars, _ := s.store.All()
 
 	for _, star := range stars {
 		for _, topic := range star.Topics {
@@ -706,44 +1171,30 @@ func (s *StarManager) GetTopics() []KV {
 }
 
 // GetStars returns repositories given a project count to return, and an
-// optional language and topic to filter by. It can also randomize the results.
+// optional language and topic to filter by, in the given order (by default,
+// most starred first).
 func (s *StarManager) GetStars(
-	count int, language, topic string, random bool,
+	count int, language, topic string, order SortSpec,
 ) ([]*Star, error) {
-	stars := []*Star{}
+	return s.FindStars(count, Filter{Language: language, Topic: topic}, order)
+}
 
-	if language != "" {
-		if err := s.db.Select(q.Eq("Language", language)).Find(&stars); err != nil {
-			return nil, err
-		}
-	} else {
-		if err := s.db.All(&stars); err != nil {
-			return nil, err
-		}
+// FindStars returns up to count stars matching the filter, in the given order
+// (by default, most starred first). A query expression is parsed with
+// ParseQuery, and an order with ParseSortSpec:
+//
+//	query, err := starmanager.ParseQuery("language:go stars:>500 -archived")
+//	...
+//	order, err := starmanager.ParseSortSpec("pushed,name")
+//	...
+//	stars, err := sm.FindStars(10, starmanager.Filter{Query: query}, order)
+func (s *StarManager) FindStars(count int, filter Filter, order SortSpec) ([]*Star, error) {
+	stars, err := s.store.Query(filter)
+	if err != nil {
+		return nil, err
 	}
 
-	if topic != "" {
-		topicStars := []*Star{}
-
-		for _, star := range stars {
-			if utils.StringInSlice(topic, star.Topics) {
-				topicStars = append(topicStars, star)
-			}
-		}
-
-		stars = topicStars
-	}
-
-	if random {
-		rand.Seed(time.Now().UTC().UnixNano())
-		rand.Shuffle(len(stars), func(i, j int) {
-			stars[i], stars[j] = stars[j], stars[i]
-		})
-	} else {
-		sort.Slice(stars, func(i, j int) bool {
-			return stars[i].Stargazers > stars[j].Stargazers
-		})
-	}
+	order.Sort(stars, s.now().UTC().UnixNano())
 
 	if len(stars) > 0 {
 		if len(stars) > count {
@@ -758,75 +1209,84 @@ func (s *StarManager) GetStars(
 
 // RemoveStar unstars the repository on Github and removes the star from the
 // local cache.
-func (s *StarManager) RemoveStar(star *Star, wg *sync.WaitGroup) (bool, error) {
-	wg.Add(1)
-	defer wg.Done()
-
-	starURL, parseErr := url.Parse(star.URL)
-	if parseErr != nil {
-		return false, parseErr
+func (s *StarManager) RemoveStar(ctx context.Context, star *Star) (bool, error) {
+	owner, name, err := ownerAndRepo(star.URL)
+	if err != nil {
+		return false, err
 	}
 
-	splitPath := strings.Split(starURL.Path, "/")
-
-	_, unstarErr := s.client.Activity.Unstar(s.context, splitPath[1], splitPath[2])
-	if unstarErr != nil {
-		log.Infof("An error occurred while attempting to unstar %s: %s\n",
-			star.URL, unstarErr.Error(),
+	if _, err := s.client.Activity.Unstar(ctx, owner, name); err != nil {
+		s.log.Infof("An error occurred while attempting to unstar %s: %s\n",
+			star.URL, err.Error(),
 		)
-		return false, unstarErr
+		return false, fmt.Errorf("could not unstar %s: %w", star.URL, err)
 	}
 
-	deleteErr := s.db.DeleteStruct(star)
-	if deleteErr != nil {
-		return false, deleteErr
+	if err := s.store.Delete(star.URL); err != nil {
+		return false, err
 	}
 
-	log.Infof("Removed %s\n", star.URL)
+	s.log.Infof("Removed %s\n", star.URL)
 
 	return true, nil
 }
 
 // Cleanup removes stars older than a specified time in months, optionally
-// unstarring archived repositories as well
-func (s *StarManager) Cleanup(age int, archived bool) error {
-	allStars := []*Star{}
-	toDelete := make(chan *Star)
-	wg := sync.WaitGroup{}
-	then := time.Now().AddDate(0, -age, 0)
-
-	if err := s.db.All(&allStars); err != nil {
+// unstarring archived repositories as well. Up to maxConcurrency stars are
+// removed at once (all of them if not positive). Failures do not stop the
+// other stars from being removed, and are returned together. Cancelling ctx
+// stops removing further stars.
+func (s *StarManager) Cleanup(ctx context.Context, age int, archived bool, maxConcurrency int) error {
+	then := s.now().AddDate(0, -age, 0)
+
+	allStars, err := s.store.All()
+	if err != nil {
 		return err
 	}
 
-	log.Infof("Filtering stars to delete (from %d)...\n", len(allStars))
+	var (
+		mu   sync.Mutex
+		errs error
+	)
+
+	group, groupCtx := errgroup.WithContext(ctx)
+	if maxConcurrency > 0 {
+		group.SetLimit(maxConcurrency)
+	}
+
+	s.log.Infof("Filtering stars to delete (from %d)...\n", len(allStars))
 	for _, star := range allStars {
-		if star.PushedAt.Before(then) || star.Archived == archived {
-			log.Infof(
+		if star.PushedAt.Before(then) || (archived && star.Archived) {
+			s.log.Infof(
 				"Queueing %s for deletion (last pushed at %+v, archive status: %t)\n",
 				star.URL,
 				star.PushedAt,
 				star.Archived,
 			)
 
-			wg.Add(1)
-			go func(ch chan *Star, s *Star, wg *sync.WaitGroup) {
-				defer wg.Done()
-				ch <- s
-			}(toDelete, star, &wg)
+			star := star
+			group.Go(func() error {
+				if err := groupCtx.Err(); err != nil {
+					return err
+				}
+
+				_, err := s.RemoveStar(groupCtx, star)
+				if groupCtx.Err() != nil {
+					return groupCtx.Err()
+				}
+
+				mu.Lock()
+				errs = multierr.Append(errs, err)
+				mu.Unlock()
+
+				return nil
+			})
 		}
 	}
 
-	// Cannot close channel in main goroutine as it will block
-	go func() {
-		wg.Wait()
-		close(toDelete)
-	}()
-
-	for star := range toDelete {
-		go s.RemoveStar(star, &wg)
+	if err := group.Wait(); err != nil {
+		return multierr.Append(errs, fmt.Errorf("cleanup was interrupted: %w", err))
 	}
-	wg.Wait()
 
-	return nil
+	return errs
 }
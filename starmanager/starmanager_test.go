@@ -0,0 +1,522 @@
+package starmanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gkze/gh-stars/auth"
+	"github.com/google/go-github/v25/github"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/multierr"
+)
+
+// newTestStarManager returns a StarManager backed by in-memory credentials and
+// an in-memory store, along with a function to clean it up
+func newTestStarManager(t *testing.T) (*StarManager, func()) {
+	mem := auth.NewMemory()
+	mem.Set(GitHubAPIHost, "user", "secret")
+
+	sm, err := NewWithConfig(&Config{Auth: mem, Store: NewMemoryStore()})
+	assert.NoError(t, err)
+
+	return sm, func() { sm.Close() }
+}
+
+// starredRepo builds a github.StarredRepository fixture
+func starredRepo(
+	url, language string, stargazers int, topics ...string,
+) *github.StarredRepository {
+	now := time.Now()
+
+	return &github.StarredRepository{
+		StarredAt: &github.Timestamp{Time: now},
+		Repository: &github.Repository{
+			HTMLURL:         github.String(url),
+			Language:        github.String(language),
+			StargazersCount: github.Int(stargazers),
+			PushedAt:        &github.Timestamp{Time: now},
+			Topics:          topics,
+		},
+	}
+}
+
+func saveFixtures(t *testing.T, sm *StarManager) {
+	for _, r := range []*github.StarredRepository{
+		starredRepo("https://github.com/a/one", "Go", 10, "cli", "git"),
+		starredRepo("https://github.com/b/two", "Rust", 30, "cli"),
+		starredRepo("https://github.com/c/three", "Go", 20, "parser"),
+	} {
+		assert.NoError(t, sm.SaveStarredRepository(r))
+	}
+}
+
+func TestNewWithConfigMissingCredentials(t *testing.T) {
+	sm, err := NewWithConfig(&Config{Auth: auth.NewMemory()})
+	assert.Error(t, err)
+	assert.Nil(t, sm)
+
+	sm, err = NewWithConfig(&Config{})
+	assert.Error(t, err)
+	assert.Nil(t, sm)
+}
+
+func TestGetStars(t *testing.T) {
+	sm, cleanup := newTestStarManager(t)
+	defer cleanup()
+
+	saveFixtures(t, sm)
+
+	testCases := []struct {
+		count    int
+		language string
+		topic    string
+		order    SortSpec
+		urls     []string
+	}{
+		{
+			count: 10,
+			urls: []string{
+				"https://github.com/b/two",
+				"https://github.com/c/three",
+				"https://github.com/a/one",
+			},
+		},
+		{
+			count: 1,
+			urls:  []string{"https://github.com/b/two"},
+		},
+		{
+			count:    10,
+			language: "go",
+			urls: []string{
+				"https://github.com/c/three",
+				"https://github.com/a/one",
+			},
+		},
+		{
+			count:    10,
+			language: "go",
+			topic:    "cli",
+			urls:     []string{"https://github.com/a/one"},
+		},
+		{
+			count: 10,
+			order: DefaultSort.Reverse(),
+			urls: []string{
+				"https://github.com/a/one",
+				"https://github.com/c/three",
+				"https://github.com/b/two",
+			},
+		},
+		{
+			count: 10,
+			order: SortSpec{{Key: SortLanguage}, {Key: SortName, Descending: true}},
+			urls: []string{
+				"https://github.com/c/three",
+				"https://github.com/a/one",
+				"https://github.com/b/two",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		stars, err := sm.GetStars(tc.count, tc.language, tc.topic, tc.order)
+		assert.NoError(t, err)
+
+		urls := []string{}
+		for _, star := range stars {
+			urls = append(urls, star.URL)
+		}
+		assert.Equal(t, tc.urls, urls)
+	}
+
+	_, err := sm.GetStars(10, "haskell", "", nil)
+	assert.Error(t, err)
+}
+
+func TestStormCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stars-starmanager")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	mem := auth.NewMemory()
+	mem.Set(GitHubAPIHost, "user", "secret")
+
+	sm, err := NewWithConfig(&Config{
+		Auth:      mem,
+		CacheFile: filepath.Join(dir, "cache", CacheFile),
+	})
+	assert.NoError(t, err)
+
+	saveFixtures(t, sm)
+
+	stars, err := sm.GetStars(10, "go", "", nil)
+	assert.NoError(t, err)
+	assert.Len(t, stars, 2)
+
+	assert.NoError(t, sm.ClearCache())
+
+	count, err := sm.store.Count()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	_, err = sm.LastSync()
+	assert.NoError(t, err)
+
+	assert.NoError(t, sm.Close())
+}
+
+func TestSQL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stars-starmanager")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	mem := auth.NewMemory()
+	mem.Set(GitHubAPIHost, "user", "secret")
+
+	sm, err := NewWithConfig(&Config{
+		Auth:      mem,
+		Backend:   BackendSQLite,
+		CacheFile: filepath.Join(dir, CacheFileFor(GitHubHost, "", BackendSQLite)),
+	})
+	assert.NoError(t, err)
+	defer sm.Close()
+
+	saveFixtures(t, sm)
+
+	columns, rows, err := sm.SQL(`SELECT language, COUNT(*) FROM stars GROUP BY language`)
+	assert.NoError(t, err)
+	assert.Len(t, columns, 2)
+	assert.Equal(t, [][]string{{"go", "2"}, {"rust", "1"}}, rows)
+
+	memSM, cleanup := newTestStarManager(t)
+	defer cleanup()
+
+	_, _, err = memSM.SQL(`SELECT 1`)
+	assert.ErrorIs(t, err, ErrSQLUnsupported)
+
+	_, err = NewWithConfig(&Config{Auth: mem, Backend: "mongodb"})
+	assert.Error(t, err)
+}
+
+func TestGetTopics(t *testing.T) {
+	sm, cleanup := newTestStarManager(t)
+	defer cleanup()
+
+	saveFixtures(t, sm)
+
+	topics := sm.GetTopics()
+	assert.Len(t, topics, 3)
+	assert.Equal(t, KV{"cli", 2}, topics[0])
+}
+
+func TestEnterpriseHost(t *testing.T) {
+	assert.Equal(t, GitHubAPIHost, APIHost(GitHubHost))
+	assert.Equal(t, "ghe.example.com", APIHost("ghe.example.com"))
+
+	assert.Equal(t, CacheFile, CacheFileFor(GitHubHost, "", ""))
+	assert.Equal(t, "stars-ghe.example.com.db", CacheFileFor("ghe.example.com", "", ""))
+	assert.Equal(t, "stars-work.db", CacheFileFor("ghe.example.com", "work", BackendStorm))
+	assert.Equal(t, "stars-work.sqlite", CacheFileFor(GitHubHost, "work", BackendSQLite))
+
+	dir, err := ioutil.TempDir("", "stars-starmanager")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	mem := auth.NewMemory()
+	mem.Set("ghe.example.com", "user", "secret")
+
+	sm, err := NewWithConfig(&Config{
+		Host:      "ghe.example.com",
+		Auth:      mem,
+		CacheFile: filepath.Join(dir, CacheFileFor("ghe.example.com", "", "")),
+	})
+	assert.NoError(t, err)
+	defer sm.Close()
+
+	assert.Equal(t, "ghe.example.com", sm.Host())
+	assert.Equal(t, "https://ghe.example.com/api/v3/", sm.client.BaseURL.String())
+}
+
+func TestStarRepositoriesFromURLsErrors(t *testing.T) {
+	sm, cleanup := newTestStarManager(t)
+	defer cleanup()
+
+	starred := []string{}
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.URL.Path == "/repos/b/two":
+				fmt.Fprintf(w, `{"name": "two", "owner": {"login": "b"}, "pushed_at": %q}`,
+					time.Now().Format(time.RFC3339),
+				)
+			case r.URL.Path == "/user/starred/b/two" && r.Method == http.MethodPut:
+				starred = append(starred, "b/two")
+				w.WriteHeader(http.StatusNoContent)
+			default:
+				http.NotFound(w, r)
+			}
+		},
+	))
+	defer server.Close()
+
+	baseURL, err := url.Parse(server.URL + "/")
+	assert.NoError(t, err)
+	sm.client.BaseURL = baseURL
+
+	urls := []*url.URL{}
+	for _, u := range []string{"https://github.com/a/one", "https://github.com/b/two"} {
+		parsed, err := url.Parse(u)
+		assert.NoError(t, err)
+		urls = append(urls, parsed)
+	}
+
+	// Failures are reported instead of silently skipping repositories
+	count, err := sm.StarRepositoriesFromURLs(context.Background(), urls, 1, 2)
+	assert.Equal(t, 1, count)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "https://github.com/a/one")
+	assert.Equal(t, []string{"b/two"}, starred)
+}
+
+// failingStore is a Store that cannot save the star with the given URL
+type failingStore struct {
+	*MemoryStore
+	url string
+}
+
+func (s failingStore) Save(star *Star) error {
+	if star.URL == s.url {
+		return errors.New("disk full")
+	}
+
+	return s.MemoryStore.Save(star)
+}
+
+func TestSaveAllStarsErrors(t *testing.T) {
+	sm, cleanup := newTestStarManager(t)
+	defer cleanup()
+
+	sm.store = failingStore{NewMemoryStore(), "https://github.com/d/four"}
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Query().Get("page") {
+			case "1":
+				w.Header().Set("Link", fmt.Sprintf(
+					`<%s/users/user/starred?page=2>; rel="next", <%s/users/user/starred?page=3>; rel="last"`,
+					server.URL, server.URL,
+				))
+				fmt.Fprint(w, `[{"repo": {"html_url": "https://github.com/a/one"}}]`)
+			case "2":
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+			case "3":
+				fmt.Fprint(w, `[
+					{"repo": {"html_url": "https://github.com/c/three"}},
+					{"repo": {"html_url": "https://github.com/d/four"}}
+				]`)
+			}
+		},
+	))
+	defer server.Close()
+
+	baseURL, err := url.Parse(server.URL + "/")
+	assert.NoError(t, err)
+	sm.client.BaseURL = baseURL
+
+	// Failed pages and stars do not stop the others from being saved
+	err = sm.SaveAllStars(context.Background(), 2)
+
+	saveErr := &SaveError{}
+	assert.True(t, errors.As(err, &saveErr))
+	assert.Equal(t, 3, saveErr.Pages)
+	assert.Equal(t, []int{2}, saveErr.FailedPages)
+	assert.Equal(t, 1, saveErr.FailedStars)
+	assert.Len(t, multierr.Errors(saveErr.Err), 2)
+	assert.Contains(t, saveErr.Err.Error(), "could not fetch page 2")
+	assert.Contains(t, saveErr.Err.Error(), "could not save https://github.com/d/four: disk full")
+
+	stars, err := sm.store.All()
+	assert.NoError(t, err)
+	assert.Len(t, stars, 2)
+
+	// The cache is not considered synced, but the saved stars are indexed
+	lastSync, err := sm.LastSync()
+	assert.NoError(t, err)
+	assert.True(t, lastSync.IsZero())
+
+	results, err := sm.Search("one", 10)
+	assert.NoError(t, err)
+	assert.Len(t, results, 1)
+
+	// A page that cannot be fetched is reported rather than dereferenced
+	_, err = sm.SaveStarredPage(context.Background(), 2)
+	assert.Error(t, err)
+}
+
+func TestResumeSaveAllStars(t *testing.T) {
+	sm, cleanup := newTestStarManager(t)
+	defer cleanup()
+
+	var (
+		server   *httptest.Server
+		mu       sync.Mutex
+		requests = map[string]int{}
+		broken   = true
+		newest   = "https://github.com/a/one"
+	)
+	server = httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			page := r.URL.Query().Get("page")
+
+			mu.Lock()
+			defer mu.Unlock()
+			requests[page]++
+
+			if page != "4" {
+				next, _ := strconv.Atoi(page)
+				w.Header().Set("Link", fmt.Sprintf(
+					`<%s/users/user/starred?page=%d>; rel="next", <%s/users/user/starred?page=4>; rel="last"`,
+					server.URL, next+1, server.URL,
+				))
+			}
+
+			switch page {
+			case "1":
+				fmt.Fprintf(w, `[{"repo": {"html_url": %q}}]`, newest)
+			case "2":
+				if broken {
+					http.Error(w, "unauthorized", http.StatusUnauthorized)
+					return
+				}
+				fmt.Fprint(w, `[{"repo": {"html_url": "https://github.com/b/two"}}]`)
+			case "3":
+				fmt.Fprint(w, `[{"repo": {"html_url": "https://github.com/c/three"}}]`)
+			case "4":
+				fmt.Fprint(w, `[{"repo": {"html_url": "https://github.com/d/four"}}]`)
+			}
+		},
+	))
+	defer server.Close()
+
+	baseURL, err := url.Parse(server.URL + "/")
+	assert.NoError(t, err)
+	sm.client.BaseURL = baseURL
+
+	ctx := context.Background()
+
+	assert.Error(t, sm.SaveAllStars(ctx, 2))
+
+	checkpoint, err := sm.SaveCheckpoint()
+	assert.NoError(t, err)
+	assert.Equal(t, 4, checkpoint.Pages)
+	assert.Equal(t, "https://github.com/a/one", checkpoint.Newest)
+	assert.Equal(t, []int{1, 3, 4}, checkpoint.Saved)
+
+	// Stars are only saved again if the cache is empty, not because a save
+	// is unfinished
+	broken = false
+	requests = map[string]int{}
+	assert.NoError(t, sm.SaveIfEmpty(ctx, 2))
+	assert.Empty(t, requests)
+
+	// Resuming only fetches the first page, to check that the stars did not
+	// change, and the pages that were not saved
+	assert.NoError(t, sm.ResumeSaveAllStars(ctx, 2))
+	assert.Equal(t, map[string]int{"1": 1, "2": 1}, requests)
+
+	count, err := sm.store.Count()
+	assert.NoError(t, err)
+	assert.Equal(t, 4, count)
+
+	checkpoint, err = sm.SaveCheckpoint()
+	assert.NoError(t, err)
+	assert.Nil(t, checkpoint)
+
+	lastSync, err := sm.LastSync()
+	assert.NoError(t, err)
+	assert.False(t, lastSync.IsZero())
+
+	// A save is started over if stars were starred since it was interrupted
+	broken = true
+	assert.Error(t, sm.SaveAllStars(ctx, 2))
+
+	broken = false
+	newest = "https://github.com/e/five"
+	requests = map[string]int{}
+	assert.NoError(t, sm.ResumeSaveAllStars(ctx, 2))
+	assert.Equal(t, map[string]int{"1": 1, "2": 1, "3": 1, "4": 1}, requests)
+}
+
+func TestSaveCheckpointOutdated(t *testing.T) {
+	now := time.Now()
+	checkpoint := &SaveCheckpoint{Pages: 4, Newest: "https://github.com/a/one", StartedAt: now}
+
+	assert.Empty(t, checkpoint.outdated(now.Add(time.Hour), 4, "https://github.com/a/one"))
+	assert.NotEmpty(t, checkpoint.outdated(now.Add(2*SaveCheckpointMaxAge), 4, "https://github.com/a/one"))
+	assert.NotEmpty(t, checkpoint.outdated(now, 5, "https://github.com/a/one"))
+	assert.NotEmpty(t, checkpoint.outdated(now, 4, "https://github.com/e/five"))
+}
+
+func TestCancellation(t *testing.T) {
+	sm, cleanup := newTestStarManager(t)
+	defer cleanup()
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			http.NotFound(w, r)
+		},
+	))
+	defer server.Close()
+
+	baseURL, err := url.Parse(server.URL + "/")
+	assert.NoError(t, err)
+	sm.client.BaseURL = baseURL
+
+	saveFixtures(t, sm)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	urls := []*url.URL{}
+	for _, u := range []string{"https://github.com/a/one", "https://github.com/b/two"} {
+		parsed, err := url.Parse(u)
+		assert.NoError(t, err)
+		urls = append(urls, parsed)
+	}
+
+	// Cancellation is reported once, rather than as a failure per repository
+	count, err := sm.StarRepositoriesFromURLs(ctx, urls, 0, 2)
+	assert.Equal(t, 0, count)
+	assert.Equal(t, []error{context.Canceled}, multierr.Errors(err))
+
+	err = sm.SaveAllStars(ctx, 2)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	err = sm.Cleanup(ctx, 0, false, 2)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	_, err = sm.Sync(ctx, SyncOptions{Full: true})
+	assert.ErrorIs(t, err, context.Canceled)
+
+	assert.Equal(t, 0, requests)
+
+	// Nothing was removed from the cache
+	count, err = sm.store.Count()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+}
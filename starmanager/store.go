@@ -0,0 +1,85 @@
+package starmanager
+
+import (
+	"errors"
+
+	"github.com/gkze/gh-stars/utils"
+)
+
+var (
+	// ErrStarNotFound is returned by Store.Get when no star has the requested
+	// URL
+	ErrStarNotFound = errors.New("star not found")
+
+	// ErrMetaNotFound is returned by Store.GetMeta when nothing is stored under
+	// the requested key
+	ErrMetaNotFound = errors.New("metadata not found")
+)
+
+// Filter narrows down the stars returned by Store.Query. Empty fields match
+// everything.
+type Filter struct {
+	// Language is the (lowercased) language stars must be written in
+	Language string
+
+	// Topic is a topic stars must be labeled with
+	Topic string
+
+	// Query is a query expression stars must match
+	Query *Query
+}
+
+// Match reports whether a star satisfies the filter
+func (f Filter) Match(star *Star) bool {
+	if f.Language != "" && star.Language != f.Language {
+		return false
+	}
+
+	if f.Topic != "" && !utils.StringInSlice(f.Topic, star.Topics) {
+		return false
+	}
+
+	return f.Query.Match(star)
+}
+
+// Store is the local persistence layer for stars, keyed by URL
+type Store interface {
+	// Save inserts or replaces a star
+	Save(star *Star) error
+
+	// Get returns the star with the given URL, or ErrStarNotFound
+	Get(url string) (*Star, error)
+
+	// All returns every star
+	All() ([]*Star, error)
+
+	// Query returns the stars matching the filter
+	Query(filter Filter) ([]*Star, error)
+
+	// Delete removes the star with the given URL
+	Delete(url string) error
+
+	// Count returns the number of stars
+	Count() (int, error)
+
+	// Each calls fn for every star, stopping at the first error
+	Each(fn func(*Star) error) error
+
+	// Clear removes all stars and all metadata (ETags, checkpoints, the search
+	// index, READMEs...) except the schema version, which still describes the
+	// emptied store. The store remains usable.
+	Clear() error
+
+	// GetMeta returns the metadata value stored under key, or ErrMetaNotFound
+	GetMeta(key string) ([]byte, error)
+
+	// SetMeta stores a metadata value under key, replacing any existing one
+	SetMeta(key string, value []byte) error
+
+	// Path returns the location of the store, or an empty string if it is not
+	// backed by a file
+	Path() string
+
+	// Close releases the resources held by the store
+	Close() error
+}
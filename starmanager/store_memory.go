@@ -0,0 +1,162 @@
+package starmanager
+
+import (
+	"sort"
+	"sync"
+)
+
+// MemoryStore is a Store that keeps stars in memory, mainly useful for tests
+type MemoryStore struct {
+	mu    sync.RWMutex
+	stars map[string]Star
+	meta  map[string][]byte
+}
+
+// NewMemoryStore creates a new, empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{stars: map[string]Star{}, meta: map[string][]byte{}}
+}
+
+// copyStar returns a copy of a star that does not share its topics slice, so
+// that callers cannot modify stored stars behind the store's back
+func copyStar(star Star) *Star {
+	star.Topics = append([]string(nil), star.Topics...)
+
+	return &star
+}
+
+// Save satisfies Store for MemoryStore
+func (m *MemoryStore) Save(star *Star) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.stars[star.URL] = *copyStar(*star)
+
+	return nil
+}
+
+// Get satisfies Store for MemoryStore
+func (m *MemoryStore) Get(url string) (*Star, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	star, ok := m.stars[url]
+	if !ok {
+		return nil, ErrStarNotFound
+	}
+
+	return copyStar(star), nil
+}
+
+// All satisfies Store for MemoryStore. Stars are returned in URL order, like
+// the Storm store does.
+func (m *MemoryStore) All() ([]*Star, error) {
+	return m.Query(Filter{})
+}
+
+// Query satisfies Store for MemoryStore
+func (m *MemoryStore) Query(filter Filter) ([]*Star, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stars := []*Star{}
+	for _, star := range m.stars {
+		if filter.Match(&star) {
+			stars = append(stars, copyStar(star))
+		}
+	}
+
+	sort.Slice(stars, func(i, j int) bool { return stars[i].URL < stars[j].URL })
+
+	return stars, nil
+}
+
+// Delete satisfies Store for MemoryStore
+func (m *MemoryStore) Delete(url string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.stars[url]; !ok {
+		return ErrStarNotFound
+	}
+
+	delete(m.stars, url)
+
+	return nil
+}
+
+// Count satisfies Store for MemoryStore
+func (m *MemoryStore) Count() (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return len(m.stars), nil
+}
+
+// Each satisfies Store for MemoryStore
+func (m *MemoryStore) Each(fn func(*Star) error) error {
+	stars, err := m.All()
+	if err != nil {
+		return err
+	}
+
+	for _, star := range stars {
+		if err := fn(star); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Clear satisfies Store for MemoryStore
+func (m *MemoryStore) Clear() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.stars = map[string]Star{}
+
+	for key := range m.meta {
+		if key != SchemaVersionKey {
+			delete(m.meta, key)
+		}
+	}
+
+	return nil
+}
+
+// GetMeta satisfies Store for MemoryStore
+func (m *MemoryStore) GetMeta(key string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	value, ok := m.meta[key]
+	if !ok {
+		return nil, ErrMetaNotFound
+	}
+
+	return append([]byte(nil), value...), nil
+}
+
+// SetMeta satisfies Store for MemoryStore
+func (m *MemoryStore) SetMeta(key string, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.meta[key] = append([]byte(nil), value...)
+
+	return nil
+}
+
+// Path satisfies Store for MemoryStore
+func (m *MemoryStore) Path() string {
+	return ""
+}
+
+// Close satisfies Store for MemoryStore
+func (m *MemoryStore) Close() error {
+	return nil
+}
+
+// Compile-time interface satisfaction check
+var _ Store = (*MemoryStore)(nil)
@@ -0,0 +1,579 @@
+package starmanager
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	// Registers the pure-Go "sqlite" database/sql driver
+	_ "modernc.org/sqlite"
+)
+
+// sqliteSchema is the normalized SQLite schema: one row per star, and one row
+// per (star, topic) pair. Timestamps are stored as RFC 3339 text so that they
+// sort and compare naturally in ad-hoc queries.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS stars (
+	url            TEXT PRIMARY KEY,
+	archived       INTEGER NOT NULL DEFAULT 0,
+	description    TEXT NOT NULL DEFAULT '',
+	language       TEXT NOT NULL DEFAULT '',
+	pushed_at      TEXT NOT NULL DEFAULT '',
+	stargazers     INTEGER NOT NULL DEFAULT 0,
+	starred_at     TEXT NOT NULL DEFAULT '',
+	synced_at      TEXT NOT NULL DEFAULT '',
+	license        TEXT NOT NULL DEFAULT '',
+	parent         TEXT NOT NULL DEFAULT '',
+	disk_usage     INTEGER NOT NULL DEFAULT 0,
+	latest_release TEXT NOT NULL DEFAULT '',
+	open_issues    INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS stars_language ON stars (language);
+CREATE TABLE IF NOT EXISTS topics (
+	url   TEXT NOT NULL REFERENCES stars (url),
+	topic TEXT NOT NULL,
+	PRIMARY KEY (url, topic)
+);
+CREATE INDEX IF NOT EXISTS topics_topic ON topics (topic);
+CREATE TABLE IF NOT EXISTS meta (
+	key   TEXT PRIMARY KEY,
+	value BLOB NOT NULL
+);
+`
+
+// sqliteAddedColumns are the columns added to the stars table after its
+// creation, with their definitions. They are added to older databases on open.
+var sqliteAddedColumns = []struct{ name, definition string }{
+	{"synced_at", "TEXT NOT NULL DEFAULT ''"},
+	{"license", "TEXT NOT NULL DEFAULT ''"},
+	{"parent", "TEXT NOT NULL DEFAULT ''"},
+	{"disk_usage", "INTEGER NOT NULL DEFAULT 0"},
+	{"latest_release", "TEXT NOT NULL DEFAULT ''"},
+	{"open_issues", "INTEGER NOT NULL DEFAULT 0"},
+}
+
+// sqliteTimeLayout is the layout timestamps are stored in
+const sqliteTimeLayout = time.RFC3339Nano
+
+// ErrSQLUnsupported is returned when raw SQL queries are run against a store
+// that does not support them
+var ErrSQLUnsupported = errors.New("raw SQL queries are only supported by the sqlite backend")
+
+// SQLQuerier is implemented by stores that can run raw, read-only SQL queries
+type SQLQuerier interface {
+	// RawQuery runs a query and returns the column names and the rows, with
+	// every value formatted as a string
+	RawQuery(query string, args ...interface{}) ([]string, [][]string, error)
+}
+
+// SQLiteStore is a Store backed by a SQLite database file
+type SQLiteStore struct {
+	db   *sql.DB
+	path string
+}
+
+// OpenSQLiteStore opens (or creates) the SQLite database at path and ensures
+// the schema exists
+func OpenSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite only supports a single writer; serializing access through one
+	// connection avoids "database is locked" errors under concurrent saves
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+
+		return nil, fmt.Errorf("could not create schema: %w", err)
+	}
+
+	if err := addSQLiteColumns(db); err != nil {
+		db.Close()
+
+		return nil, fmt.Errorf("could not upgrade schema: %w", err)
+	}
+
+	return &SQLiteStore{db: db, path: path}, nil
+}
+
+// addSQLiteColumns adds any of sqliteAddedColumns missing from the stars table
+func addSQLiteColumns(db *sql.DB) error {
+	rows, err := db.Query(`SELECT name FROM pragma_table_info('stars')`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	existing := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+
+		existing[name] = true
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, column := range sqliteAddedColumns {
+		if existing[column.name] {
+			continue
+		}
+
+		if _, err := db.Exec(
+			`ALTER TABLE stars ADD COLUMN ` + column.name + ` ` + column.definition,
+		); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Save satisfies Store for SQLiteStore
+func (s *SQLiteStore) Save(star *Star) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		INSERT OR REPLACE INTO stars
+			(url, archived, description, language, pushed_at, stargazers, starred_at, synced_at,
+			 license, parent, disk_usage, latest_release, open_issues)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		star.URL,
+		star.Archived,
+		star.Description,
+		star.Language,
+		star.PushedAt.UTC().Format(sqliteTimeLayout),
+		star.Stargazers,
+		star.StarredAt.UTC().Format(sqliteTimeLayout),
+		formatSQLiteTime(star.SyncedAt),
+		star.License,
+		star.Parent,
+		star.DiskUsage,
+		star.LatestRelease,
+		star.OpenIssues,
+	); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM topics WHERE url = ?`, star.URL); err != nil {
+		return err
+	}
+
+	for _, topic := range star.Topics {
+		if _, err := tx.Exec(
+			`INSERT OR IGNORE INTO topics (url, topic) VALUES (?, ?)`, star.URL, topic,
+		); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// query selects the stars matching a WHERE clause, along with their topics
+func (s *SQLiteStore) query(where string, args ...interface{}) ([]*Star, error) {
+	rows, err := s.db.Query(`
+		SELECT url, archived, description, language, pushed_at, stargazers, starred_at, synced_at,
+			license, parent, disk_usage, latest_release, open_issues
+		FROM stars `+where+` ORDER BY url`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stars := []*Star{}
+	byURL := map[string]*Star{}
+
+	for rows.Next() {
+		star := &Star{}
+		var pushedAt, starredAt, syncedAt string
+
+		if err := rows.Scan(
+			&star.URL,
+			&star.Archived,
+			&star.Description,
+			&star.Language,
+			&pushedAt,
+			&star.Stargazers,
+			&starredAt,
+			&syncedAt,
+			&star.License,
+			&star.Parent,
+			&star.DiskUsage,
+			&star.LatestRelease,
+			&star.OpenIssues,
+		); err != nil {
+			return nil, err
+		}
+
+		if star.PushedAt, err = parseSQLiteTime(pushedAt); err != nil {
+			return nil, err
+		}
+
+		if star.StarredAt, err = parseSQLiteTime(starredAt); err != nil {
+			return nil, err
+		}
+
+		if star.SyncedAt, err = parseSQLiteTime(syncedAt); err != nil {
+			return nil, err
+		}
+
+		stars = append(stars, star)
+		byURL[star.URL] = star
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	topicRows, err := s.db.Query(`
+		SELECT topics.url, topics.topic
+		FROM topics JOIN stars ON stars.url = topics.url `+where+`
+		ORDER BY topics.rowid`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer topicRows.Close()
+
+	for topicRows.Next() {
+		var url, topic string
+		if err := topicRows.Scan(&url, &topic); err != nil {
+			return nil, err
+		}
+
+		if star, ok := byURL[url]; ok {
+			star.Topics = append(star.Topics, topic)
+		}
+	}
+
+	return stars, topicRows.Err()
+}
+
+// formatSQLiteTime formats a timestamp for storage, storing the zero time as
+// an empty value
+func formatSQLiteTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.UTC().Format(sqliteTimeLayout)
+}
+
+// parseSQLiteTime parses a stored timestamp, treating empty values as the
+// zero time
+func parseSQLiteTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	return time.Parse(sqliteTimeLayout, value)
+}
+
+// Get satisfies Store for SQLiteStore
+func (s *SQLiteStore) Get(url string) (*Star, error) {
+	stars, err := s.query(`WHERE stars.url = ?`, url)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(stars) == 0 {
+		return nil, ErrStarNotFound
+	}
+
+	return stars[0], nil
+}
+
+// All satisfies Store for SQLiteStore
+func (s *SQLiteStore) All() ([]*Star, error) {
+	return s.query("")
+}
+
+// Query satisfies Store for SQLiteStore. Filtering happens in SQL.
+func (s *SQLiteStore) Query(filter Filter) ([]*Star, error) {
+	conditions := []string{}
+	args := []interface{}{}
+
+	if filter.Language != "" {
+		conditions = append(conditions, `stars.language = ?`)
+		args = append(args, filter.Language)
+	}
+
+	if filter.Topic != "" {
+		conditions = append(conditions, `EXISTS (
+			SELECT 1 FROM topics AS t WHERE t.url = stars.url AND t.topic = ?
+		)`)
+		args = append(args, filter.Topic)
+	}
+
+	var (
+		stars []*Star
+		err   error
+	)
+
+	if len(conditions) == 0 {
+		stars, err = s.All()
+	} else {
+		stars, err = s.query(`WHERE `+strings.Join(conditions, " AND "), args...)
+	}
+
+	if err != nil || filter.Query == nil {
+		return stars, err
+	}
+
+	// Query expressions are not translated to SQL, so they are evaluated on
+	// the rows instead
+	matching := []*Star{}
+	for _, star := range stars {
+		if filter.Query.Match(star) {
+			matching = append(matching, star)
+		}
+	}
+
+	return matching, nil
+}
+
+// Delete satisfies Store for SQLiteStore
+func (s *SQLiteStore) Delete(url string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM topics WHERE url = ?`, url); err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`DELETE FROM stars WHERE url = ?`, url)
+	if err != nil {
+		return err
+	}
+
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrStarNotFound
+	}
+
+	return tx.Commit()
+}
+
+// Count satisfies Store for SQLiteStore
+func (s *SQLiteStore) Count() (int, error) {
+	count := 0
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM stars`).Scan(&count)
+
+	return count, err
+}
+
+// Each satisfies Store for SQLiteStore
+func (s *SQLiteStore) Each(fn func(*Star) error) error {
+	stars, err := s.All()
+	if err != nil {
+		return err
+	}
+
+	for _, star := range stars {
+		if err := fn(star); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Clear satisfies Store for SQLiteStore
+func (s *SQLiteStore) Clear() error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, statement := range []string{
+		`DELETE FROM topics`,
+		`DELETE FROM stars`,
+		`DELETE FROM meta WHERE key != ?`,
+	} {
+		if _, err := tx.Exec(statement, SchemaVersionKey); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetMeta satisfies Store for SQLiteStore
+func (s *SQLiteStore) GetMeta(key string) ([]byte, error) {
+	value := []byte{}
+	err := s.db.QueryRow(`SELECT value FROM meta WHERE key = ?`, key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrMetaNotFound
+	}
+
+	return value, err
+}
+
+// SetMeta satisfies Store for SQLiteStore
+func (s *SQLiteStore) SetMeta(key string, value []byte) error {
+	_, err := s.db.Exec(
+		`INSERT OR REPLACE INTO meta (key, value) VALUES (?, ?)`, key, value,
+	)
+
+	return err
+}
+
+// Path satisfies Store for SQLiteStore
+func (s *SQLiteStore) Path() string {
+	return s.path
+}
+
+// Close satisfies Store for SQLiteStore
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// RawQuery satisfies SQLQuerier for SQLiteStore. The query runs on a
+// separate, read-only connection to the database with query_only set, so it
+// cannot modify the cache, and it must be a single statement.
+func (s *SQLiteStore) RawQuery(
+	query string, args ...interface{},
+) ([]string, [][]string, error) {
+	if err := checkSingleStatement(query); err != nil {
+		return nil, nil, err
+	}
+
+	path, err := filepath.Abs(s.path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dsn := &url.URL{
+		Scheme:   "file",
+		Path:     filepath.ToSlash(path),
+		RawQuery: "mode=ro&_pragma=query_only(1)",
+	}
+
+	db, err := sql.Open("sqlite", dsn.String())
+	if err != nil {
+		return nil, nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	results := [][]string{}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, nil, err
+		}
+
+		row := make([]string, len(columns))
+		for i, value := range values {
+			switch v := value.(type) {
+			case nil:
+				row[i] = "NULL"
+			case []byte:
+				row[i] = string(v)
+			default:
+				row[i] = fmt.Sprint(v)
+			}
+		}
+
+		results = append(results, row)
+	}
+
+	return columns, results, rows.Err()
+}
+
+// checkSingleStatement returns an error if query holds more than one SQL
+// statement. Semicolons in string literals, quoted identifiers and comments
+// do not separate statements, and a trailing semicolon is allowed.
+func checkSingleStatement(query string) error {
+	ended := false
+
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			continue
+		case c == '-' && strings.HasPrefix(query[i:], "--"):
+			if end := strings.IndexByte(query[i:], '\n'); end >= 0 {
+				i += end
+			} else {
+				i = len(query)
+			}
+
+			continue
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			if end := strings.Index(query[i+2:], "*/"); end >= 0 {
+				i += end + 3
+			} else {
+				i = len(query)
+			}
+
+			continue
+		}
+
+		if ended {
+			return errors.New("only a single SQL statement can be run")
+		}
+
+		switch c {
+		case ';':
+			ended = true
+		case '\'', '"', '`', '[':
+			closing := c
+			if c == '[' {
+				closing = ']'
+			}
+
+			// Quotes are escaped by doubling them, which this skips over as
+			// two adjacent quoted strings
+			if end := strings.IndexByte(query[i+1:], closing); end >= 0 {
+				i += end + 1
+			} else {
+				i = len(query)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Compile-time interface satisfaction checks
+var (
+	_ Store      = (*SQLiteStore)(nil)
+	_ SQLQuerier = (*SQLiteStore)(nil)
+)
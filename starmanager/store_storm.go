@@ -0,0 +1,160 @@
+package starmanager
+
+import (
+	"errors"
+
+	"github.com/asdine/storm"
+	"github.com/asdine/storm/q"
+	bolt "go.etcd.io/bbolt"
+)
+
+// stormMetaBucket is the bucket holding metadata key-value pairs
+const stormMetaBucket = "meta"
+
+// StormStore is a Store backed by a Storm (BoltDB) database file
+type StormStore struct {
+	db *storm.DB
+}
+
+// OpenStormStore opens (or creates) the Storm database at path
+func OpenStormStore(path string) (*StormStore, error) {
+	db, err := storm.Open(path, storm.Batch())
+	if err != nil {
+		return nil, err
+	}
+
+	return &StormStore{db: db}, nil
+}
+
+// Save satisfies Store for StormStore
+func (s *StormStore) Save(star *Star) error {
+	return s.db.Save(star)
+}
+
+// Get satisfies Store for StormStore
+func (s *StormStore) Get(url string) (*Star, error) {
+	star := &Star{}
+	if err := s.db.One("URL", url, star); err != nil {
+		if errors.Is(err, storm.ErrNotFound) {
+			return nil, ErrStarNotFound
+		}
+
+		return nil, err
+	}
+
+	return star, nil
+}
+
+// All satisfies Store for StormStore
+func (s *StormStore) All() ([]*Star, error) {
+	stars := []*Star{}
+	if err := s.db.All(&stars); err != nil {
+		return nil, err
+	}
+
+	return stars, nil
+}
+
+// Query satisfies Store for StormStore. The language is looked up through its
+// index, while topics are matched in memory.
+func (s *StormStore) Query(filter Filter) ([]*Star, error) {
+	stars := []*Star{}
+
+	if filter.Language != "" {
+		err := s.db.Select(q.Eq("Language", filter.Language)).Find(&stars)
+		if err != nil && !errors.Is(err, storm.ErrNotFound) {
+			return nil, err
+		}
+	} else {
+		if err := s.db.All(&stars); err != nil {
+			return nil, err
+		}
+	}
+
+	matching := []*Star{}
+	for _, star := range stars {
+		if filter.Match(star) {
+			matching = append(matching, star)
+		}
+	}
+
+	return matching, nil
+}
+
+// Delete satisfies Store for StormStore
+func (s *StormStore) Delete(url string) error {
+	if err := s.db.DeleteStruct(&Star{URL: url}); err != nil {
+		if errors.Is(err, storm.ErrNotFound) {
+			return ErrStarNotFound
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// Count satisfies Store for StormStore
+func (s *StormStore) Count() (int, error) {
+	return s.db.Count(&Star{})
+}
+
+// Each satisfies Store for StormStore
+func (s *StormStore) Each(fn func(*Star) error) error {
+	return s.db.Select().Each(&Star{}, func(record interface{}) error {
+		return fn(record.(*Star))
+	})
+}
+
+// Clear satisfies Store for StormStore by dropping the stars and metadata
+// buckets, and restoring the schema version
+func (s *StormStore) Clear() error {
+	version, err := s.GetMeta(SchemaVersionKey)
+	if err != nil && !errors.Is(err, ErrMetaNotFound) {
+		return err
+	}
+
+	for _, bucket := range []interface{}{&Star{}, stormMetaBucket} {
+		if err := s.db.Drop(bucket); err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+			return err
+		}
+	}
+
+	if version == nil {
+		return nil
+	}
+
+	return s.SetMeta(SchemaVersionKey, version)
+}
+
+// GetMeta satisfies Store for StormStore
+func (s *StormStore) GetMeta(key string) ([]byte, error) {
+	value := []byte{}
+	if err := s.db.Get(stormMetaBucket, key, &value); err != nil {
+		if errors.Is(err, storm.ErrNotFound) {
+			return nil, ErrMetaNotFound
+		}
+
+		return nil, err
+	}
+
+	return value, nil
+}
+
+// SetMeta satisfies Store for StormStore
+func (s *StormStore) SetMeta(key string, value []byte) error {
+	return s.db.Set(stormMetaBucket, key, value)
+}
+
+// Path satisfies Store for StormStore
+func (s *StormStore) Path() string {
+	return s.db.Bolt.Path()
+}
+
+// Close satisfies Store for StormStore
+func (s *StormStore) Close() error {
+	return s.db.Close()
+}
+
+// Compile-time interface satisfaction check
+var _ Store = (*StormStore)(nil)
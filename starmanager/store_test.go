@@ -0,0 +1,229 @@
+package starmanager
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// storeFixtures are the stars saved into each store under test
+var storeFixtures = []*Star{
+	{URL: "https://github.com/a/one", Language: "go", Stargazers: 10, Topics: []string{"cli"}},
+	{URL: "https://github.com/b/two", Language: "rust", Stargazers: 30, Topics: []string{"cli"}},
+	{URL: "https://github.com/c/three", Language: "go", Stargazers: 20},
+}
+
+// testStore runs the behavior shared by all Store implementations
+func testStore(t *testing.T, store Store) {
+	for _, star := range storeFixtures {
+		assert.NoError(t, store.Save(star))
+	}
+
+	count, err := store.Count()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	star, err := store.Get("https://github.com/b/two")
+	assert.NoError(t, err)
+	assert.Equal(t, 30, star.Stargazers)
+
+	_, err = store.Get("https://github.com/d/four")
+	assert.True(t, errors.Is(err, ErrStarNotFound))
+
+	stars, err := store.All()
+	assert.NoError(t, err)
+	assert.Len(t, stars, 3)
+
+	testCases := []struct {
+		filter Filter
+		urls   []string
+	}{
+		{
+			filter: Filter{Language: "go"},
+			urls:   []string{"https://github.com/a/one", "https://github.com/c/three"},
+		},
+		{
+			filter: Filter{Topic: "cli"},
+			urls:   []string{"https://github.com/a/one", "https://github.com/b/two"},
+		},
+		{
+			filter: Filter{Language: "go", Topic: "cli"},
+			urls:   []string{"https://github.com/a/one"},
+		},
+		{
+			filter: Filter{Language: "haskell"},
+			urls:   []string{},
+		},
+		{
+			filter: Filter{Topic: "cli", Query: mustParseQuery(t, "stars:>15 OR name:a/one")},
+			urls:   []string{"https://github.com/a/one", "https://github.com/b/two"},
+		},
+		{
+			filter: Filter{Language: "go", Query: mustParseQuery(t, "stars:>15")},
+			urls:   []string{"https://github.com/c/three"},
+		},
+	}
+
+	for _, tc := range testCases {
+		stars, err := store.Query(tc.filter)
+		assert.NoError(t, err)
+
+		urls := []string{}
+		for _, star := range stars {
+			urls = append(urls, star.URL)
+		}
+		assert.ElementsMatch(t, tc.urls, urls)
+	}
+
+	seen := 0
+	assert.NoError(t, store.Each(func(*Star) error { seen++; return nil }))
+	assert.Equal(t, 3, seen)
+
+	stop := errors.New("stop")
+	assert.Equal(t, stop, store.Each(func(*Star) error { return stop }))
+
+	_, err = store.GetMeta("key")
+	assert.True(t, errors.Is(err, ErrMetaNotFound))
+
+	assert.NoError(t, store.SetMeta("key", []byte("value")))
+	assert.NoError(t, store.SetMeta("key", []byte("newvalue")))
+
+	value, err := store.GetMeta("key")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("newvalue"), value)
+
+	assert.NoError(t, store.Delete("https://github.com/a/one"))
+	assert.True(t, errors.Is(store.Delete("https://github.com/a/one"), ErrStarNotFound))
+
+	count, err = store.Count()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
+
+// testClear checks that clearing a store removes its stars and metadata, but
+// keeps the schema version and leaves it usable
+func testClear(t *testing.T, store Store) {
+	assert.NoError(t, store.SetMeta(SchemaVersionKey, []byte("3")))
+	assert.NoError(t, store.SetMeta(ETagKeyPrefix+"/user/starred", []byte("etag")))
+
+	assert.NoError(t, store.Clear())
+
+	count, err := store.Count()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	_, err = store.GetMeta(ETagKeyPrefix + "/user/starred")
+	assert.ErrorIs(t, err, ErrMetaNotFound)
+
+	version, err := store.GetMeta(SchemaVersionKey)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("3"), version)
+
+	assert.NoError(t, store.Save(&Star{URL: "https://github.com/a/one"}))
+
+	count, err = store.Count()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	// Clearing an empty store is fine too
+	assert.NoError(t, store.Clear())
+	assert.NoError(t, store.Clear())
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	defer store.Close()
+
+	testStore(t, store)
+	testClear(t, store)
+}
+
+func TestStormStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stars-store")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	store, err := OpenStormStore(filepath.Join(dir, CacheFile))
+	assert.NoError(t, err)
+	defer store.Close()
+
+	testStore(t, store)
+
+	assert.Equal(t, filepath.Join(dir, CacheFile), store.Path())
+	testClear(t, store)
+}
+
+func TestCheckSingleStatement(t *testing.T) {
+	for query, single := range map[string]bool{
+		`SELECT 1`:                               true,
+		`SELECT 1;`:                              true,
+		"SELECT 1 ; \n -- done\n":                true,
+		`SELECT 'a;b', "c;d", [e;f], ` + "`g;h`": true,
+		`SELECT 'it''s; fine'`:                   true,
+		`SELECT 1 /* ; */ + 1`:                   true,
+		`SELECT 1; SELECT 2`:                     false,
+		`COMMIT; DELETE FROM stars; SELECT 1`:    false,
+		`SELECT 1;;`:                             false,
+		"SELECT 1 -- x\n; DROP TABLE stars":      false,
+		`SELECT 1 /* x */; /* y */ SELECT 2`:     false,
+	} {
+		err := checkSingleStatement(query)
+		if single {
+			assert.NoError(t, err, query)
+		} else {
+			assert.EqualError(t, err, "only a single SQL statement can be run", query)
+		}
+	}
+}
+
+func TestSQLiteStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stars-store")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	store, err := OpenSQLiteStore(filepath.Join(dir, "stars.sqlite"))
+	assert.NoError(t, err)
+	defer store.Close()
+
+	testStore(t, store)
+
+	star, err := store.Get("https://github.com/b/two")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"cli"}, star.Topics)
+
+	columns, rows, err := store.RawQuery(
+		`SELECT topic, COUNT(*) AS n FROM topics GROUP BY topic ORDER BY topic`,
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"topic", "n"}, columns)
+	assert.Equal(t, [][]string{{"cli", "1"}}, rows)
+
+	// Raw queries must not be able to modify the cache
+	for _, query := range []string{
+		`DELETE FROM stars`,
+		`COMMIT; DELETE FROM stars; SELECT 1`,
+		`SELECT 1; DELETE FROM stars`,
+		`PRAGMA query_only = OFF; DELETE FROM stars`,
+		`INSERT INTO meta (key, value) VALUES ('a', 'b')`,
+	} {
+		_, _, err = store.RawQuery(query)
+		assert.Error(t, err, query)
+	}
+
+	count, err := store.Count()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	_, rows, err = store.RawQuery(`SELECT ';' AS "a;b" -- trailing; comment` + "\n;")
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{";"}}, rows)
+
+	_, _, err = store.RawQuery(`SELECT * FROM nonexistent`)
+	assert.Error(t, err)
+
+	testClear(t, store)
+}
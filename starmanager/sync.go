@@ -0,0 +1,481 @@
+package starmanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v25/github"
+	"go.uber.org/multierr"
+)
+
+const (
+	// DefaultStaleAfter is how long cached repository metadata is considered
+	// fresh by default
+	DefaultStaleAfter time.Duration = 7 * 24 * time.Hour
+
+	// DefaultMaxRefresh is how many stale stars are refreshed per sync by
+	// default
+	DefaultMaxRefresh int = 100
+)
+
+// SyncOptions configures a sync
+type SyncOptions struct {
+	// StaleAfter is the age after which the metadata of a cached star is
+	// refreshed from GitHub. Zero disables refreshing.
+	StaleAfter time.Duration
+
+	// MaxRefresh limits how many stale stars are refreshed per sync, least
+	// recently synced first, so that stars that went stale at the same time
+	// (e.g. because they were saved together) are refreshed over several
+	// syncs rather than with a request each in one. Zero means
+	// DefaultMaxRefresh, negative means no limit.
+	MaxRefresh int
+
+	// MaxConcurrency limits how many stars are refreshed concurrently
+	MaxConcurrency int
+
+	// Full lists every star instead of stopping at the first known one,
+	// updating all cached metadata and removing cached stars that are no
+	// longer starred on GitHub
+	Full bool
+
+	// Fetcher lists the stars. If nil, the REST API is used.
+	Fetcher Fetcher
+
+	// Resume continues an interrupted sync from its checkpoint, rather than
+	// starting it over
+	Resume bool
+}
+
+// SyncResult summarizes the changes made by a sync
+type SyncResult struct {
+	// Added lists the URLs of newly starred repositories
+	Added []string
+
+	// Updated lists the URLs of stars whose metadata was refreshed
+	Updated []string
+
+	// Removed lists the URLs of stars removed from the cache because they
+	// are no longer starred
+	Removed []string
+}
+
+// sameMetadata reports whether two stars hold the same repository metadata,
+// ignoring when it was synced
+func (s *Star) sameMetadata(other *Star) bool {
+	if s.URL != other.URL ||
+		s.Archived != other.Archived ||
+		s.Description != other.Description ||
+		s.Language != other.Language ||
+		s.Stargazers != other.Stargazers ||
+		!s.PushedAt.Equal(other.PushedAt) ||
+		!s.StarredAt.Equal(other.StarredAt) ||
+		s.License != other.License ||
+		s.Parent != other.Parent ||
+		s.DiskUsage != other.DiskUsage ||
+		s.LatestRelease != other.LatestRelease ||
+		s.OpenIssues != other.OpenIssues ||
+		len(s.Topics) != len(other.Topics) {
+		return false
+	}
+
+	for i := range s.Topics {
+		if s.Topics[i] != other.Topics[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ownerAndRepo extracts the owner and repository names from a repository URL
+func ownerAndRepo(repoURL string) (string, string, error) {
+	u, err := url.Parse(repoURL)
+	if err != nil {
+		return "", "", err
+	}
+
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) < 2 {
+		return "", "", fmt.Errorf("%s is not a repository URL", repoURL)
+	}
+
+	return parts[0], parts[1], nil
+}
+
+// Sync incrementally updates the local cache. Stars are listed newest first,
+// stopping at the first one that is already cached, and the metadata of stars
+// older than StaleAfter is then refreshed. An empty cache is filled by listing
+// every star instead. See SyncOptions.Full for full reconciliation.
+//
+// Syncs that list every star save a checkpoint after each page, from which
+// SyncOptions.Resume continues them if they are interrupted. An interrupted
+// sync that is not resumed starts over from the first page.
+func (s *StarManager) Sync(ctx context.Context, opts SyncOptions) (*SyncResult, error) {
+	result := &SyncResult{Added: []string{}, Updated: []string{}, Removed: []string{}}
+
+	fetcher := opts.Fetcher
+	if fetcher == nil {
+		fetcher = s.RESTFetcher()
+	}
+
+	checkpoint, err := s.SyncCheckpoint()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case checkpoint != nil && opts.Resume:
+		if checkpoint.Fetcher != fetcher.Name() {
+			return nil, fmt.Errorf(
+				"the interrupted sync listed stars with the %s API, it must be resumed with it",
+				checkpoint.Fetcher,
+			)
+		}
+
+		s.log.Infof(
+			"Resuming the sync started at %s after %d pages\n",
+			checkpoint.StartedAt.Local().Format(time.RFC1123), checkpoint.Pages,
+		)
+
+	case checkpoint != nil:
+		// The cache is missing whatever the interrupted sync did not get to
+		s.log.Warn("Starting an interrupted sync over instead of resuming it")
+		checkpoint = s.newSyncCheckpoint(fetcher, opts.Full)
+
+	default:
+		if opts.Resume {
+			s.log.Info("There is no interrupted sync to resume")
+		}
+
+		count, err := s.store.Count()
+		if err != nil {
+			return nil, err
+		}
+
+		if opts.Full || count == 0 {
+			checkpoint = s.newSyncCheckpoint(fetcher, opts.Full)
+		}
+	}
+
+	if checkpoint != nil {
+		if err := s.listAllStars(ctx, fetcher, checkpoint, result); err != nil {
+			return result, err
+		}
+
+		return result, s.finishSync(checkpoint.StartedAt)
+	}
+
+	syncedAt := s.now()
+
+	added, err := s.saveNewStars(ctx, fetcher)
+	result.Added = added
+	if err != nil {
+		return result, err
+	}
+
+	if opts.StaleAfter > 0 {
+		updated, err := s.refreshStaleStars(
+			ctx, syncedAt.Add(-opts.StaleAfter), opts.MaxRefresh, opts.MaxConcurrency,
+		)
+		result.Updated = updated
+		if err != nil {
+			return result, err
+		}
+	}
+
+	return result, s.finishSync(syncedAt)
+}
+
+// finishSync records a successful sync at t, and reindexes the stars for
+// Search
+func (s *StarManager) finishSync(t time.Time) error {
+	if err := s.setLastSync(t); err != nil {
+		return err
+	}
+
+	return s.RebuildSearchIndex()
+}
+
+// newSyncCheckpoint starts a sync listing every star with fetcher
+func (s *StarManager) newSyncCheckpoint(fetcher Fetcher, full bool) *SyncCheckpoint {
+	return &SyncCheckpoint{Fetcher: fetcher.Name(), Full: full, StartedAt: s.now()}
+}
+
+// listStarredPage fetches a page of starred repositories, newest first
+func (s *StarManager) listStarredPage(
+	ctx context.Context, pageno int,
+) ([]*github.StarredRepository, *github.Response, error) {
+	s.log.Infof("Fetching page %d of stars, newest first...\n", pageno)
+	page, response, err := s.client.Activity.ListStarred(
+		ctx,
+		s.username,
+		&github.ActivityListStarredOptions{
+			Sort:      "created",
+			Direction: "desc",
+			ListOptions: github.ListOptions{
+				PerPage: PageSize,
+				Page:    pageno,
+			},
+		},
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not fetch page %d of stars: %w", pageno, err)
+	}
+
+	return page, response, nil
+}
+
+// saveNewStars saves the starred repositories that are newer than the newest
+// cached one. They are saved oldest first, so that an interrupted sync cannot
+// leave a gap between cached stars. It returns the URLs of the stars it saved.
+func (s *StarManager) saveNewStars(ctx context.Context, fetcher Fetcher) ([]string, error) {
+	added := []string{}
+	stars := []*Star{}
+
+listing:
+	for cursor, first := "", true; first || cursor != ""; first = false {
+		page, next, err := fetcher.FetchPage(ctx, cursor)
+		if err != nil {
+			return added, err
+		}
+
+		for _, star := range page {
+			cached, err := s.store.Get(star.URL)
+			if err == nil && cached.StarredAt.Equal(star.StarredAt) {
+				s.log.Infof("Reached known star %s\n", cached.URL)
+
+				break listing
+			}
+			if err != nil && !errors.Is(err, ErrStarNotFound) {
+				return added, err
+			}
+
+			stars = append(stars, star)
+		}
+
+		cursor = next
+	}
+
+	for i := len(stars) - 1; i >= 0; i-- {
+		if err := s.store.Save(stars[i]); err != nil {
+			return added, err
+		}
+
+		s.log.Infof("Saved %s\n", stars[i].URL)
+		added = append(added, stars[i].URL)
+	}
+
+	return added, nil
+}
+
+// listAllStars lists every star from the checkpoint's cursor on, saving each
+// page and recording the differences with the cache in result. The checkpoint
+// is saved after every page, and cleared once all were listed. Full syncs then
+// remove the cached stars that were not listed, so nothing is removed unless
+// every page was listed successfully.
+func (s *StarManager) listAllStars(
+	ctx context.Context, fetcher Fetcher, checkpoint *SyncCheckpoint, result *SyncResult,
+) error {
+	if err := s.saveSyncCheckpoint(checkpoint); err != nil {
+		return err
+	}
+
+	cached, err := s.store.All()
+	if err != nil {
+		return err
+	}
+
+	cachedByURL := map[string]*Star{}
+	for _, star := range cached {
+		cachedByURL[star.URL] = star
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		page, next, err := fetcher.FetchPage(ctx, checkpoint.Cursor)
+		if err != nil {
+			return err
+		}
+
+		for _, star := range page {
+			if err := s.store.Save(star); err != nil {
+				return err
+			}
+
+			if old, ok := cachedByURL[star.URL]; !ok {
+				s.log.Infof("Added %s\n", star.URL)
+				result.Added = append(result.Added, star.URL)
+			} else if !old.sameMetadata(star) {
+				s.log.Infof("Updated %s\n", star.URL)
+				result.Updated = append(result.Updated, star.URL)
+			}
+
+			// Stars listed twice, having moved between pages, count once
+			cachedByURL[star.URL] = star
+		}
+
+		if next == "" {
+			break
+		}
+
+		checkpoint.Cursor = next
+		checkpoint.Pages++
+		if err := s.saveSyncCheckpoint(checkpoint); err != nil {
+			return err
+		}
+	}
+
+	if checkpoint.Full {
+		stars, err := s.store.All()
+		if err != nil {
+			return err
+		}
+
+		// Every listed star was synced after the sync started. Cached stars
+		// are listed in URL order, so removals are sorted too.
+		for _, star := range stars {
+			if !star.SyncedAt.Before(checkpoint.StartedAt) {
+				continue
+			}
+
+			if err := s.store.Delete(star.URL); err != nil {
+				return err
+			}
+
+			s.log.Infof("Removed %s\n", star.URL)
+			result.Removed = append(result.Removed, star.URL)
+		}
+	}
+
+	return s.clearSyncCheckpoint()
+}
+
+// refreshStaleStars refetches the metadata of up to maxRefresh of the stars
+// last synced before staleBefore (see SyncOptions.MaxRefresh), oldest first,
+// returning the URLs of the stars it refreshed
+func (s *StarManager) refreshStaleStars(
+	ctx context.Context, staleBefore time.Time, maxRefresh, maxConcurrency int,
+) ([]string, error) {
+	stars, err := s.store.All()
+	if err != nil {
+		return nil, err
+	}
+
+	oldest := []*Star{}
+	for _, star := range stars {
+		if star.SyncedAt.Before(staleBefore) {
+			oldest = append(oldest, star)
+		}
+	}
+	sort.SliceStable(oldest, func(i, j int) bool {
+		return oldest[i].SyncedAt.Before(oldest[j].SyncedAt)
+	})
+
+	if maxRefresh == 0 {
+		maxRefresh = DefaultMaxRefresh
+	}
+	if maxRefresh > 0 && len(oldest) > maxRefresh {
+		s.log.Infof(
+			"Refreshing %d of %d stale stars, the rest are refreshed by later syncs\n",
+			maxRefresh, len(oldest),
+		)
+		oldest = oldest[:maxRefresh]
+	}
+
+	stale := make(chan *Star)
+	go func() {
+		defer close(stale)
+
+		for _, star := range oldest {
+			select {
+			case stale <- star:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	if maxConcurrency < 1 {
+		maxConcurrency = DefaultConcurrency
+	}
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		updated = []string{}
+		errs    error
+	)
+
+	for i := 0; i < maxConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for star := range stale {
+				refreshed, err := s.refreshStar(ctx, star)
+				if ctx.Err() != nil {
+					return
+				}
+
+				mu.Lock()
+				if err != nil {
+					errs = multierr.Append(errs, err)
+				} else if refreshed {
+					updated = append(updated, star.URL)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return updated, multierr.Append(errs, ctx.Err())
+}
+
+// refreshStar refetches the metadata of a single cached star, reporting
+// whether the repository still exists
+func (s *StarManager) refreshStar(ctx context.Context, star *Star) (bool, error) {
+	owner, name, err := ownerAndRepo(star.URL)
+	if err != nil {
+		return false, err
+	}
+
+	s.log.Debugf("Refreshing %s/%s\n", owner, name)
+	repo, response, err := s.client.Repositories.Get(ctx, owner, name)
+	if err != nil {
+		if response != nil && response.StatusCode == http.StatusNotFound {
+			s.log.Warnf("%s no longer exists, skipping refresh\n", star.URL)
+
+			return false, nil
+		}
+
+		return false, fmt.Errorf("could not refresh %s: %w", star.URL, err)
+	}
+
+	refreshed := newStar(repo, star.StarredAt, s.now())
+	refreshed.keepGraphQLFields(star)
+	if err := s.store.Save(refreshed); err != nil {
+		return false, err
+	}
+
+	// Renamed or transferred repositories are saved under their new URL
+	if refreshed.URL != star.URL {
+		s.log.Infof("%s moved to %s\n", star.URL, refreshed.URL)
+
+		return true, s.store.Delete(star.URL)
+	}
+
+	return true, nil
+}
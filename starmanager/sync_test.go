@@ -0,0 +1,376 @@
+package starmanager
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// syncTime returns midnight UTC on the given day of January 2020
+func syncTime(day int) time.Time {
+	return time.Date(2020, 1, day, 0, 0, 0, 0, time.UTC)
+}
+
+// serveStars points the StarManager at a test server listing the stars of
+// "user" newest first, with the first page linking to a second one, and
+// serving repository metadata with the given stargazer counts. It returns the
+// server and a function reporting how often the second page was requested.
+func serveStars(
+	t *testing.T, sm *StarManager, stargazers map[string]int,
+) (*httptest.Server, func() int) {
+	secondPageRequests := 0
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/users/user/starred":
+				assert.Equal(t, "created", r.URL.Query().Get("sort"))
+				assert.Equal(t, "desc", r.URL.Query().Get("direction"))
+
+				if r.URL.Query().Get("page") == "2" {
+					secondPageRequests++
+					fmt.Fprint(w, `[]`)
+					return
+				}
+
+				w.Header().Set("Link", fmt.Sprintf(
+					`<%s/users/user/starred?page=2>; rel="next", <%s/users/user/starred?page=2>; rel="last"`,
+					server.URL, server.URL,
+				))
+				fmt.Fprint(w, `[
+					{"starred_at": "2020-01-03T00:00:00Z", "repo": {"html_url": "https://github.com/c/three", "language": "Go"}},
+					{"starred_at": "2020-01-02T00:00:00Z", "repo": {"html_url": "https://github.com/b/two", "language": "Rust"}},
+					{"starred_at": "2020-01-01T00:00:00Z", "repo": {"html_url": "https://github.com/a/one", "language": "Go"}}
+				]`)
+			default:
+				owner, name, err := ownerAndRepo(r.URL.Path[len("/repos"):])
+				if err != nil {
+					http.NotFound(w, r)
+					return
+				}
+
+				repoURL := fmt.Sprintf("https://github.com/%s/%s", owner, name)
+				count, ok := stargazers[repoURL]
+				if !ok {
+					http.NotFound(w, r)
+					return
+				}
+
+				fmt.Fprintf(w, `{"html_url": %q, "stargazers_count": %d}`, repoURL, count)
+			}
+		},
+	))
+
+	baseURL, err := url.Parse(server.URL + "/")
+	assert.NoError(t, err)
+	sm.client.BaseURL = baseURL
+
+	return server, func() int { return secondPageRequests }
+}
+
+func TestSync(t *testing.T) {
+	sm, cleanup := newTestStarManager(t)
+	defer cleanup()
+
+	server, secondPageRequests := serveStars(t, sm, map[string]int{
+		"https://github.com/a/one": 100,
+	})
+	defer server.Close()
+
+	fresh := time.Now()
+	stale := fresh.Add(-2 * DefaultStaleAfter)
+
+	for _, star := range []*Star{
+		{URL: "https://github.com/a/one", StarredAt: syncTime(1), SyncedAt: stale},
+		{URL: "https://github.com/b/two", StarredAt: syncTime(2), SyncedAt: fresh},
+		{URL: "https://github.com/d/gone", StarredAt: syncTime(1), SyncedAt: stale},
+	} {
+		assert.NoError(t, sm.store.Save(star))
+	}
+
+	result, err := sm.Sync(context.Background(), SyncOptions{StaleAfter: DefaultStaleAfter})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"https://github.com/c/three"}, result.Added)
+	assert.Equal(t, []string{"https://github.com/a/one"}, result.Updated)
+
+	// Listing stopped at the first known star
+	assert.Equal(t, 0, secondPageRequests())
+
+	star, err := sm.store.Get("https://github.com/c/three")
+	assert.NoError(t, err)
+	assert.Equal(t, "go", star.Language)
+	assert.True(t, syncTime(3).Equal(star.StarredAt))
+
+	star, err = sm.store.Get("https://github.com/a/one")
+	assert.NoError(t, err)
+	assert.Equal(t, 100, star.Stargazers)
+	assert.True(t, syncTime(1).Equal(star.StarredAt))
+	assert.True(t, star.SyncedAt.After(stale))
+
+	lastSync, err := sm.LastSync()
+	assert.NoError(t, err)
+	assert.False(t, lastSync.IsZero())
+}
+
+func TestSyncMaxRefresh(t *testing.T) {
+	sm, cleanup := newTestStarManager(t)
+	defer cleanup()
+
+	server, _ := serveStars(t, sm, map[string]int{
+		"https://github.com/a/one":   100,
+		"https://github.com/b/two":   200,
+		"https://github.com/c/three": 300,
+	})
+	defer server.Close()
+
+	stale := time.Now().Add(-2 * DefaultStaleAfter)
+	// c/three was synced first, a/one last
+	for i, starURL := range []string{
+		"https://github.com/a/one", "https://github.com/b/two", "https://github.com/c/three",
+	} {
+		assert.NoError(t, sm.store.Save(&Star{
+			URL:       starURL,
+			StarredAt: syncTime(i + 1),
+			SyncedAt:  stale.Add(time.Duration(2-i) * time.Hour),
+		}))
+	}
+
+	// Only the least recently synced stars are refreshed
+	opts := SyncOptions{StaleAfter: DefaultStaleAfter, MaxRefresh: 2}
+	result, err := sm.Sync(context.Background(), opts)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		"https://github.com/b/two", "https://github.com/c/three",
+	}, result.Updated)
+
+	// The rest are refreshed by the next sync
+	result, err = sm.Sync(context.Background(), opts)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"https://github.com/a/one"}, result.Updated)
+
+	result, err = sm.Sync(context.Background(), opts)
+	assert.NoError(t, err)
+	assert.Empty(t, result.Updated)
+}
+
+func TestSyncFull(t *testing.T) {
+	sm, cleanup := newTestStarManager(t)
+	defer cleanup()
+
+	server, secondPageRequests := serveStars(t, sm, map[string]int{})
+	defer server.Close()
+
+	for _, star := range []*Star{
+		{URL: "https://github.com/a/one", Language: "go", StarredAt: syncTime(1), Stargazers: 5},
+		{URL: "https://github.com/b/two", Language: "rust", StarredAt: syncTime(2)},
+		{URL: "https://github.com/d/gone", StarredAt: syncTime(1)},
+	} {
+		assert.NoError(t, sm.store.Save(star))
+	}
+
+	result, err := sm.Sync(context.Background(), SyncOptions{Full: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"https://github.com/c/three"}, result.Added)
+	assert.Equal(t, []string{"https://github.com/a/one"}, result.Updated)
+	assert.Equal(t, []string{"https://github.com/d/gone"}, result.Removed)
+	assert.Equal(t, 1, secondPageRequests())
+
+	_, err = sm.store.Get("https://github.com/d/gone")
+	assert.ErrorIs(t, err, ErrStarNotFound)
+
+	count, err := sm.store.Count()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+}
+
+func TestSyncFullListingError(t *testing.T) {
+	sm, cleanup := newTestStarManager(t)
+	defer cleanup()
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+		},
+	))
+	defer server.Close()
+
+	baseURL, err := url.Parse(server.URL + "/")
+	assert.NoError(t, err)
+	sm.client.BaseURL = baseURL
+
+	assert.NoError(t, sm.store.Save(&Star{URL: "https://github.com/a/one"}))
+
+	// Nothing is removed if the remote stars could not be listed
+	_, err = sm.Sync(context.Background(), SyncOptions{Full: true})
+	assert.Error(t, err)
+
+	count, err := sm.store.Count()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestSyncEmptyCache(t *testing.T) {
+	sm, cleanup := newTestStarManager(t)
+	defer cleanup()
+
+	// An empty cache is filled by listing every star
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `[
+				{"starred_at": "2020-01-01T00:00:00Z", "repo": {"html_url": "https://github.com/a/one"}}
+			]`)
+		},
+	))
+	defer server.Close()
+
+	baseURL, err := url.Parse(server.URL + "/")
+	assert.NoError(t, err)
+	sm.client.BaseURL = baseURL
+
+	result, err := sm.Sync(context.Background(), SyncOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"https://github.com/a/one"}, result.Added)
+	assert.Empty(t, result.Updated)
+}
+
+func TestOwnerAndRepo(t *testing.T) {
+	owner, name, err := ownerAndRepo("https://github.com/gkze/stars")
+	assert.NoError(t, err)
+	assert.Equal(t, "gkze", owner)
+	assert.Equal(t, "stars", name)
+
+	_, _, err = ownerAndRepo("https://github.com/gkze")
+	assert.Error(t, err)
+}
+
+// serveFlakyStars points the StarManager at a test server listing two pages of
+// stars, failing the first request for the second page. It returns the server
+// and the number of requests made for each page.
+func serveFlakyStars(t *testing.T, sm *StarManager) (*httptest.Server, map[string]int) {
+	requests := map[string]int{}
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			page := r.URL.Query().Get("page")
+			requests[page]++
+
+			if page == "2" {
+				if requests[page] == 1 {
+					http.Error(w, "unauthorized", http.StatusUnauthorized)
+					return
+				}
+
+				fmt.Fprint(w, `[
+					{"starred_at": "2020-01-01T00:00:00Z", "repo": {"html_url": "https://github.com/a/one"}}
+				]`)
+				return
+			}
+
+			w.Header().Set("Link", fmt.Sprintf(
+				`<%s/users/user/starred?page=2>; rel="next", <%s/users/user/starred?page=2>; rel="last"`,
+				server.URL, server.URL,
+			))
+			fmt.Fprint(w, `[
+				{"starred_at": "2020-01-03T00:00:00Z", "repo": {"html_url": "https://github.com/c/three"}},
+				{"starred_at": "2020-01-02T00:00:00Z", "repo": {"html_url": "https://github.com/b/two"}}
+			]`)
+		},
+	))
+
+	baseURL, err := url.Parse(server.URL + "/")
+	assert.NoError(t, err)
+	sm.client.BaseURL = baseURL
+
+	return server, requests
+}
+
+func TestSyncResume(t *testing.T) {
+	sm, cleanup := newTestStarManager(t)
+	defer cleanup()
+
+	server, requests := serveFlakyStars(t, sm)
+	defer server.Close()
+
+	assert.NoError(t, sm.store.Save(&Star{URL: "https://github.com/d/gone"}))
+
+	result, err := sm.Sync(context.Background(), SyncOptions{Full: true})
+	assert.Error(t, err)
+	assert.Equal(t, []string{"https://github.com/c/three", "https://github.com/b/two"}, result.Added)
+	assert.Empty(t, result.Removed)
+
+	checkpoint, err := sm.SyncCheckpoint()
+	assert.NoError(t, err)
+	assert.Equal(t, "REST", checkpoint.Fetcher)
+	assert.Equal(t, "2", checkpoint.Cursor)
+	assert.Equal(t, 1, checkpoint.Pages)
+	assert.True(t, checkpoint.Full)
+
+	// The sync continues from the second page, and removes unlisted stars
+	// once all pages were listed
+	result, err = sm.Sync(context.Background(), SyncOptions{Resume: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"https://github.com/a/one"}, result.Added)
+	assert.Equal(t, []string{"https://github.com/d/gone"}, result.Removed)
+	assert.Equal(t, map[string]int{"1": 1, "2": 2}, requests)
+
+	checkpoint, err = sm.SyncCheckpoint()
+	assert.NoError(t, err)
+	assert.Nil(t, checkpoint)
+
+	count, err := sm.store.Count()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	lastSync, err := sm.LastSync()
+	assert.NoError(t, err)
+	assert.False(t, lastSync.IsZero())
+}
+
+func TestSyncInterruptedNotResumed(t *testing.T) {
+	sm, cleanup := newTestStarManager(t)
+	defer cleanup()
+
+	server, requests := serveFlakyStars(t, sm)
+	defer server.Close()
+
+	assert.NoError(t, sm.store.Save(&Star{URL: "https://github.com/c/three", StarredAt: syncTime(3)}))
+	assert.NoError(t, sm.saveSyncCheckpoint(&SyncCheckpoint{
+		Fetcher: "REST", Cursor: "2", Pages: 1, StartedAt: syncTime(4),
+	}))
+
+	// Checkpoints cannot be resumed with another API
+	_, err := sm.Sync(context.Background(), SyncOptions{Resume: true, Fetcher: sm.GraphQLFetcher()})
+	assert.EqualError(
+		t, err, "the interrupted sync listed stars with the REST API, it must be resumed with it",
+	)
+
+	// Without resuming, the interrupted sync starts over instead of stopping
+	// at the first cached star
+	requests["2"] = 1
+	result, err := sm.Sync(context.Background(), SyncOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"https://github.com/b/two", "https://github.com/a/one"}, result.Added)
+	assert.Equal(t, map[string]int{"1": 1, "2": 2}, requests)
+}
+
+func TestSaveNewStarsOldestFirst(t *testing.T) {
+	sm, cleanup := newTestStarManager(t)
+	defer cleanup()
+
+	server, _ := serveStars(t, sm, map[string]int{})
+	defer server.Close()
+
+	assert.NoError(t, sm.store.Save(&Star{URL: "https://github.com/a/one", StarredAt: syncTime(1)}))
+
+	added, err := sm.saveNewStars(context.Background(), sm.RESTFetcher())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"https://github.com/b/two", "https://github.com/c/three"}, added)
+}
@@ -0,0 +1,188 @@
+package starmanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// ScopesHeader is the response header listing the OAuth scopes granted to
+	// a (classic) token
+	ScopesHeader string = "X-OAuth-Scopes"
+
+	// ExpirationHeader is the response header holding the expiry time of a
+	// token, if it has one
+	ExpirationHeader string = "GitHub-Authentication-Token-Expiration"
+
+	// ExpiryWarningPeriod is how far ahead of a token's expiry a warning is
+	// logged on validation
+	ExpiryWarningPeriod time.Duration = 7 * 24 * time.Hour
+)
+
+// ErrInsufficientScope is returned when the token in use lacks the OAuth scope
+// required to star and unstar repositories
+var ErrInsufficientScope = errors.New(
+	"token lacks the public_repo or repo scope required to star/unstar repositories",
+)
+
+// starScopes are the OAuth scopes that allow starring and unstarring
+var starScopes = []string{"repo", "public_repo"}
+
+// expirationLayouts are the formats GitHub uses for ExpirationHeader
+var expirationLayouts = []string{"2006-01-02 15:04:05 MST", "2006-01-02 15:04:05 -0700"}
+
+// TokenInfo describes the identity and permissions of the token in use
+type TokenInfo struct {
+	// Login is the login of the user the token belongs to
+	Login string
+
+	// ConfiguredLogin is the username supplied alongside the token (e.g. the
+	// netrc login field). It is empty for sources that only hold a token.
+	ConfiguredLogin string
+
+	// Source describes where the token came from
+	Source string
+
+	// Scopes are the OAuth scopes granted to the token
+	Scopes []string
+
+	// ScopesKnown is false for tokens that do not report OAuth scopes, such as
+	// fine-grained personal access tokens
+	ScopesKnown bool
+
+	// Expiration is when the token expires. It is zero if the token does not
+	// expire.
+	Expiration time.Time
+}
+
+// LoginMatches reports whether the configured username (if any) is the login
+// the token belongs to
+func (t *TokenInfo) LoginMatches() bool {
+	return t.ConfiguredLogin == "" || strings.EqualFold(t.ConfiguredLogin, t.Login)
+}
+
+// CanStar reports whether the token may star and unstar repositories. Tokens
+// that do not report their scopes are given the benefit of the doubt.
+func (t *TokenInfo) CanStar() bool {
+	if !t.ScopesKnown {
+		return true
+	}
+
+	for _, scope := range t.Scopes {
+		for _, starScope := range starScopes {
+			if scope == starScope {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// parseTokenHeaders extracts scope and expiry information from the headers of
+// an authenticated API response
+func parseTokenHeaders(info *TokenInfo, header http.Header) error {
+	if values, ok := header[http.CanonicalHeaderKey(ScopesHeader)]; ok {
+		info.ScopesKnown = true
+		info.Scopes = []string{}
+
+		for _, scope := range strings.Split(strings.Join(values, ","), ",") {
+			if scope = strings.TrimSpace(scope); scope != "" {
+				info.Scopes = append(info.Scopes, scope)
+			}
+		}
+	}
+
+	expiration := header.Get(ExpirationHeader)
+	if expiration == "" {
+		return nil
+	}
+
+	for _, layout := range expirationLayouts {
+		if t, err := time.Parse(layout, expiration); err == nil {
+			info.Expiration = t
+			return nil
+		}
+	}
+
+	return fmt.Errorf("could not parse token expiration %q", expiration)
+}
+
+// TokenInfo queries the authenticated user endpoint to find out who the token
+// belongs to, which scopes it has and when it expires
+func (s *StarManager) TokenInfo(ctx context.Context) (*TokenInfo, error) {
+	ghUser, resp, err := s.client.Users.Get(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch the authenticated user: %w", err)
+	}
+
+	info := &TokenInfo{
+		Login:           ghUser.GetLogin(),
+		ConfiguredLogin: s.username,
+		Source:          s.credentialSource,
+	}
+
+	if err := parseTokenHeaders(info, resp.Header); err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// Validate checks that the token is valid and belongs to the configured user.
+// If no username was configured, the token's login is adopted as the
+// username.
+func (s *StarManager) Validate(ctx context.Context) (*TokenInfo, error) {
+	s.log.Debug("Validating token")
+
+	info, err := s.TokenInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.LoginMatches() {
+		return info, fmt.Errorf(
+			"token from %s belongs to %s, but %s is configured",
+			info.Source, info.Login, info.ConfiguredLogin,
+		)
+	}
+
+	if s.username == "" {
+		s.log.Debugf("Using token login %s as username\n", info.Login)
+		s.username = info.Login
+	}
+
+	if !info.Expiration.IsZero() {
+		if remaining := info.Expiration.Sub(s.now()); remaining < ExpiryWarningPeriod {
+			s.log.Warnf("Token from %s expires at %s\n", info.Source, info.Expiration)
+		}
+	}
+
+	s.tokenInfo = info
+
+	return info, nil
+}
+
+// RequireStarScope returns ErrInsufficientScope if the token cannot star or
+// unstar repositories, validating the token first if needed
+func (s *StarManager) RequireStarScope(ctx context.Context) error {
+	if s.tokenInfo == nil {
+		if _, err := s.Validate(ctx); err != nil {
+			return err
+		}
+	}
+
+	if !s.tokenInfo.CanStar() {
+		return fmt.Errorf("%w (token from %s has scopes: %s)",
+			ErrInsufficientScope,
+			s.tokenInfo.Source,
+			strings.Join(s.tokenInfo.Scopes, ", "),
+		)
+	}
+
+	return nil
+}
@@ -0,0 +1,136 @@
+package starmanager
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// serveUser points the StarManager at a test server whose /user endpoint
+// responds as the given login with the given token headers
+func serveUser(
+	t *testing.T, sm *StarManager, login string, header http.Header,
+) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/user" {
+				http.NotFound(w, r)
+				return
+			}
+
+			for k, v := range header {
+				w.Header()[k] = v
+			}
+
+			fmt.Fprintf(w, `{"login": %q}`, login)
+		},
+	))
+
+	baseURL, err := url.Parse(server.URL + "/")
+	assert.NoError(t, err)
+	sm.client.BaseURL = baseURL
+
+	return server
+}
+
+func TestParseTokenHeaders(t *testing.T) {
+	info := &TokenInfo{}
+	assert.NoError(t, parseTokenHeaders(info, http.Header{
+		"X-Oauth-Scopes":                         {"read:org, public_repo"},
+		"Github-Authentication-Token-Expiration": {"2030-01-02 03:04:05 UTC"},
+	}))
+	assert.True(t, info.ScopesKnown)
+	assert.Equal(t, []string{"read:org", "public_repo"}, info.Scopes)
+	assert.True(t, info.CanStar())
+	assert.Equal(t, time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC), info.Expiration.UTC())
+
+	info = &TokenInfo{}
+	assert.NoError(t, parseTokenHeaders(info, http.Header{"X-Oauth-Scopes": {""}}))
+	assert.True(t, info.ScopesKnown)
+	assert.False(t, info.CanStar())
+
+	info = &TokenInfo{}
+	assert.NoError(t, parseTokenHeaders(info, http.Header{}))
+	assert.False(t, info.ScopesKnown)
+	assert.True(t, info.CanStar())
+
+	assert.Error(t, parseTokenHeaders(&TokenInfo{}, http.Header{
+		"Github-Authentication-Token-Expiration": {"tomorrow"},
+	}))
+}
+
+func TestValidate(t *testing.T) {
+	sm, cleanup := newTestStarManager(t)
+	defer cleanup()
+
+	server := serveUser(t, sm, "user", http.Header{"X-Oauth-Scopes": {"read:user"}})
+	defer server.Close()
+
+	info, err := sm.Validate(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "user", info.Login)
+	assert.Equal(t, "in-memory credentials", info.Source)
+
+	err = sm.RequireStarScope(context.Background())
+	assert.True(t, errors.Is(err, ErrInsufficientScope))
+}
+
+func TestValidateLoginMismatch(t *testing.T) {
+	sm, cleanup := newTestStarManager(t)
+	defer cleanup()
+
+	server := serveUser(t, sm, "someoneelse", http.Header{"X-Oauth-Scopes": {"repo"}})
+	defer server.Close()
+
+	_, err := sm.Validate(context.Background())
+	assert.Error(t, err)
+}
+
+func TestValidateAdoptsLogin(t *testing.T) {
+	sm, cleanup := newTestStarManager(t)
+	defer cleanup()
+
+	sm.username = ""
+
+	server := serveUser(t, sm, "tokenuser", http.Header{"X-Oauth-Scopes": {"repo"}})
+	defer server.Close()
+
+	_, err := sm.Validate(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "tokenuser", sm.username)
+	assert.NoError(t, sm.RequireStarScope(context.Background()))
+}
+
+func TestValidateExpiryWarning(t *testing.T) {
+	sm, cleanup := newTestStarManager(t)
+	defer cleanup()
+
+	buf := &bytes.Buffer{}
+	sm.log = log.New()
+	sm.log.SetOutput(buf)
+
+	server := serveUser(t, sm, "user", http.Header{
+		"Github-Authentication-Token-Expiration": {"2030-01-02 03:04:05 UTC"},
+	})
+	defer server.Close()
+
+	// The expiry is measured against the StarManager's clock
+	sm.now = func() time.Time { return time.Date(2029, 1, 1, 0, 0, 0, 0, time.UTC) }
+	_, err := sm.Validate(context.Background())
+	assert.NoError(t, err)
+	assert.NotContains(t, buf.String(), "expires")
+
+	sm.now = func() time.Time { return time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC) }
+	_, err = sm.Validate(context.Background())
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "expires")
+}
@@ -0,0 +1,214 @@
+// Package transport provides http.RoundTrippers that make StarManager's use
+// of the GitHub API cheaper and more robust
+package transport
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Cache persists values by key for ETagTransport
+type Cache interface {
+	// Get returns the value stored under key, reporting whether there is one
+	Get(key string) ([]byte, bool, error)
+
+	// Set stores a value under key, replacing any existing one
+	Set(key string, value []byte) error
+}
+
+// cachedResponse is a response stored for revalidation
+type cachedResponse struct {
+	ETag         string      `json:"etag,omitempty"`
+	LastModified string      `json:"last_modified,omitempty"`
+	Header       http.Header `json:"header"`
+	Body         []byte      `json:"body"`
+}
+
+// ETagTransport makes GET requests conditional on the ETag or Last-Modified
+// time of the previous response to the same URL. A 304 Not Modified response
+// is turned back into the cached 200 response; GitHub does not count such
+// requests against the rate limit.
+type ETagTransport struct {
+	// Base is the transport performing the requests. If nil,
+	// http.DefaultTransport is used.
+	Base http.RoundTripper
+
+	// Cache persists responses between runs
+	Cache Cache
+
+	// Logger receives the log messages. If nil, the global logrus logger is
+	// used.
+	Logger *log.Logger
+
+	hits   int64
+	misses int64
+}
+
+// NewETag creates an ETagTransport storing responses in cache
+func NewETag(base http.RoundTripper, cache Cache) *ETagTransport {
+	return &ETagTransport{Base: base, Cache: cache}
+}
+
+// cacheKey identifies the response to a request. The Accept header is part of
+// the key, as GitHub serves different representations depending on it.
+func cacheKey(req *http.Request) string {
+	return req.Header.Get("Accept") + " " + req.URL.String()
+}
+
+// base returns the transport performing the requests
+func (t *ETagTransport) base() http.RoundTripper {
+	if t.Base == nil {
+		return http.DefaultTransport
+	}
+
+	return t.Base
+}
+
+// logger returns the logger receiving the log messages
+func (t *ETagTransport) logger() *log.Logger {
+	if t.Logger == nil {
+		return log.StandardLogger()
+	}
+
+	return t.Logger
+}
+
+// RoundTrip satisfies http.RoundTripper for ETagTransport
+func (t *ETagTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet ||
+		req.Header.Get("If-None-Match") != "" ||
+		req.Header.Get("If-Modified-Since") != "" {
+		return t.base().RoundTrip(req)
+	}
+
+	key := cacheKey(req)
+
+	cached, err := t.load(key)
+	if err != nil {
+		t.logger().Debugf("Ignoring unreadable cached response for %s: %v\n", req.URL, err)
+	}
+
+	if cached != nil {
+		req = req.Clone(req.Context())
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	resp, err := t.base().RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if cached != nil && resp.StatusCode == http.StatusNotModified {
+		atomic.AddInt64(&t.hits, 1)
+		t.logger().Debugf("%s not modified, using cached response\n", req.URL)
+
+		return cached.response(req, resp), nil
+	}
+
+	atomic.AddInt64(&t.misses, 1)
+
+	if resp.StatusCode == http.StatusOK {
+		if err := t.store(key, resp); err != nil {
+			return nil, err
+		}
+	}
+
+	return resp, nil
+}
+
+// load returns the cached response for key, or nil if there is none
+func (t *ETagTransport) load(key string) (*cachedResponse, error) {
+	value, ok, err := t.Cache.Get(key)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	cached := &cachedResponse{}
+	if err := json.Unmarshal(value, cached); err != nil {
+		return nil, err
+	}
+
+	return cached, nil
+}
+
+// store caches a successful response if it can be revalidated later. The
+// response body is consumed and replaced, so that the caller can still read
+// it.
+func (t *ETagTransport) store(key string, resp *http.Response) error {
+	cached := &cachedResponse{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Header:       resp.Header,
+	}
+
+	if cached.ETag == "" && cached.LastModified == "" {
+		return nil
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	cached.Body = body
+
+	value, err := json.Marshal(cached)
+	if err != nil {
+		return err
+	}
+
+	if err := t.Cache.Set(key, value); err != nil {
+		t.logger().Debugf("Could not cache response for %s: %v\n", key, err)
+	}
+
+	return nil
+}
+
+// response rebuilds the cached response to req. Headers of the 304 response,
+// such as the current rate limit, take precedence over the cached ones.
+func (c *cachedResponse) response(req *http.Request, notModified *http.Response) *http.Response {
+	notModified.Body.Close()
+
+	header := http.Header{}
+	for k, v := range c.Header {
+		header[k] = v
+	}
+	for k, v := range notModified.Header {
+		header[k] = v
+	}
+	header.Set("Content-Length", strconv.Itoa(len(c.Body)))
+
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         notModified.Proto,
+		ProtoMajor:    notModified.ProtoMajor,
+		ProtoMinor:    notModified.ProtoMinor,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(c.Body)),
+		ContentLength: int64(len(c.Body)),
+		Request:       req,
+	}
+}
+
+// Stats returns how many conditional requests were answered from the cache
+// (hits) and how many had to be fetched in full (misses)
+func (t *ETagTransport) Stats() (hits, misses int64) {
+	return atomic.LoadInt64(&t.hits), atomic.LoadInt64(&t.misses)
+}
+
+// Compile-time interface satisfaction check
+var _ http.RoundTripper = (*ETagTransport)(nil)
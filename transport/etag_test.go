@@ -0,0 +1,109 @@
+package transport
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// mapCache is an in-memory Cache
+type mapCache struct {
+	mu     sync.Mutex
+	values map[string][]byte
+}
+
+func (c *mapCache) Get(key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	value, ok := c.values[key]
+	return value, ok, nil
+}
+
+func (c *mapCache) Set(key string, value []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.values[key] = value
+	return nil
+}
+
+// get fetches a URL through the transport, returning the status code and body
+func get(t *testing.T, client *http.Client, url string) (int, string) {
+	resp, err := client.Get(url)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err)
+
+	return resp.StatusCode, string(body)
+}
+
+func TestETagTransport(t *testing.T) {
+	version := 1
+	fullResponses := 0
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			etag := fmt.Sprintf(`"v%d"`, version)
+			w.Header().Set("X-RateLimit-Remaining", "42")
+
+			if r.URL.Path == "/uncacheable" {
+				fmt.Fprint(w, "no etag")
+				return
+			}
+
+			if r.Header.Get("If-None-Match") == etag {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+
+			fullResponses++
+			w.Header().Set("ETag", etag)
+			fmt.Fprintf(w, "version %d", version)
+		},
+	))
+	defer server.Close()
+
+	etag := NewETag(nil, &mapCache{values: map[string][]byte{}})
+	client := &http.Client{Transport: etag}
+
+	status, body := get(t, client, server.URL+"/stars")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "version 1", body)
+
+	// Unchanged resources are served from the cache
+	status, body = get(t, client, server.URL+"/stars")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "version 1", body)
+	assert.Equal(t, 1, fullResponses)
+
+	// Changed resources are fetched in full
+	version = 2
+	status, body = get(t, client, server.URL+"/stars")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "version 2", body)
+	assert.Equal(t, 2, fullResponses)
+
+	get(t, client, server.URL+"/uncacheable")
+	get(t, client, server.URL+"/uncacheable")
+
+	hits, misses := etag.Stats()
+	assert.Equal(t, int64(1), hits)
+	assert.Equal(t, int64(4), misses)
+
+	// Other methods bypass the cache
+	resp, err := client.Post(server.URL+"/stars", "text/plain", nil)
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	hits, misses = etag.Stats()
+	assert.Equal(t, int64(1), hits)
+	assert.Equal(t, int64(4), misses)
+}
@@ -0,0 +1,291 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// RateLimitRemainingHeader holds the number of requests left in the
+	// current rate limit window
+	RateLimitRemainingHeader = "X-RateLimit-Remaining"
+
+	// RateLimitResetHeader holds the time the current rate limit window
+	// resets, in seconds since the Unix epoch
+	RateLimitResetHeader = "X-RateLimit-Reset"
+
+	// RetryAfterHeader holds the number of seconds to wait before retrying
+	RetryAfterHeader = "Retry-After"
+
+	// DefaultMaxRetries is how many times a request is retried by default
+	DefaultMaxRetries = 5
+
+	// DefaultMaxWait is the longest a single retry waits by default. GitHub
+	// asks clients to wait at least a minute after hitting a secondary rate
+	// limit.
+	DefaultMaxWait = 2 * time.Minute
+
+	// secondaryLimitWait is how long to wait after hitting a secondary rate
+	// limit without a Retry-After header
+	secondaryLimitWait = time.Minute
+
+	// baseBackoff is the initial wait between retries of failed requests
+	baseBackoff = time.Second
+)
+
+// ErrRateLimitExhausted is returned (wrapped in a *RateLimitError) when the
+// rate limit does not reset soon enough to wait for it
+var ErrRateLimitExhausted = errors.New("GitHub API rate limit exhausted")
+
+// RateLimitError reports an exhausted rate limit and when it resets
+type RateLimitError struct {
+	// Reset is when requests may be made again
+	Reset time.Time
+}
+
+// Error satisfies error for RateLimitError
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf(
+		"%v, it resets at %s (in %s)",
+		ErrRateLimitExhausted,
+		e.Reset.Local().Format(time.Kitchen),
+		time.Until(e.Reset).Round(time.Second),
+	)
+}
+
+// Is makes RateLimitErrors match ErrRateLimitExhausted with errors.Is
+func (e *RateLimitError) Is(target error) bool {
+	return target == ErrRateLimitExhausted
+}
+
+// RateLimitTransport retries requests that hit GitHub's primary or secondary
+// rate limits or failed with a server error, waiting as long as GitHub asks
+// to (or backing off exponentially, with jitter, if it does not say). Once the
+// primary rate limit is used up, requests wait for it to reset instead of
+// being sent, and fail with a *RateLimitError if that would take longer than
+// MaxWait.
+type RateLimitTransport struct {
+	// Base is the transport performing the requests. If nil,
+	// http.DefaultTransport is used.
+	Base http.RoundTripper
+
+	// MaxRetries is how many times a request is retried
+	MaxRetries int
+
+	// MaxWait is the longest a single wait may take
+	MaxWait time.Duration
+
+	// Logger receives the log messages. If nil, the global logrus logger is
+	// used.
+	Logger *log.Logger
+
+	// sleep waits for d, or until ctx is done
+	sleep func(ctx context.Context, d time.Duration) error
+
+	mu sync.Mutex
+
+	// exhaustedUntil is when the primary rate limit resets, if it was used up
+	exhaustedUntil time.Time
+}
+
+// NewRateLimit creates a RateLimitTransport with the default limits
+func NewRateLimit(base http.RoundTripper) *RateLimitTransport {
+	return &RateLimitTransport{
+		Base:       base,
+		MaxRetries: DefaultMaxRetries,
+		MaxWait:    DefaultMaxWait,
+		sleep:      sleepContext,
+	}
+}
+
+// sleepContext waits for d, or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// base returns the transport performing the requests
+func (t *RateLimitTransport) base() http.RoundTripper {
+	if t.Base == nil {
+		return http.DefaultTransport
+	}
+
+	return t.Base
+}
+
+// logger returns the logger receiving the log messages
+func (t *RateLimitTransport) logger() *log.Logger {
+	if t.Logger == nil {
+		return log.StandardLogger()
+	}
+
+	return t.Logger
+}
+
+// wait sleeps for d, unless that would exceed MaxWait
+func (t *RateLimitTransport) wait(req *http.Request, d time.Duration) error {
+	if d > t.MaxWait {
+		return &RateLimitError{Reset: time.Now().Add(d)}
+	}
+
+	t.logger().Warnf("Waiting %s before retrying %s %s\n", d.Round(time.Second), req.Method, req.URL)
+
+	sleep := t.sleep
+	if sleep == nil {
+		sleep = sleepContext
+	}
+
+	return sleep(req.Context(), d)
+}
+
+// backoff returns the exponential backoff for a retry attempt, with jitter
+func backoff(attempt int) time.Duration {
+	d := baseBackoff << uint(attempt)
+
+	return d + time.Duration(rand.Int63n(int64(d)/2+1))
+}
+
+// RoundTrip satisfies http.RoundTripper for RateLimitTransport
+func (t *RateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	exhaustedUntil := t.exhaustedUntil
+	t.mu.Unlock()
+
+	if d := time.Until(exhaustedUntil); d > 0 {
+		if err := t.wait(req, d); err != nil {
+			return nil, err
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		attemptReq := req
+		if attempt > 0 && req.Body != nil {
+			// The body of the previous attempt has been consumed
+			if req.GetBody == nil {
+				return nil, fmt.Errorf("cannot retry %s %s: body cannot be replayed", req.Method, req.URL)
+			}
+
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+
+			attemptReq = req.Clone(req.Context())
+			attemptReq.Body = body
+		}
+
+		resp, err := t.base().RoundTrip(attemptReq)
+		if err != nil {
+			if attempt >= t.MaxRetries || req.Context().Err() != nil {
+				return nil, err
+			}
+
+			t.logger().Debugf("Request to %s failed: %v\n", req.URL, err)
+			if err := t.wait(req, backoff(attempt)); err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		d, retry := t.retryDelay(resp, attempt)
+		if !retry || attempt >= t.MaxRetries {
+			return resp, nil
+		}
+
+		resp.Body.Close()
+
+		if err := t.wait(req, d); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// retryDelay inspects a response, reporting whether the request should be
+// retried and after how long. It also records when an exhausted primary rate
+// limit resets.
+func (t *RateLimitTransport) retryDelay(resp *http.Response, attempt int) (time.Duration, bool) {
+	remaining := resp.Header.Get(RateLimitRemainingHeader)
+	reset, _ := strconv.ParseInt(resp.Header.Get(RateLimitResetHeader), 10, 64)
+	resetAt := time.Unix(reset, 0)
+
+	if remaining != "" {
+		t.logger().Tracef("GitHub API rate limit: %s requests remaining\n", remaining)
+	}
+
+	if remaining == "0" && reset > 0 {
+		t.mu.Lock()
+		t.exhaustedUntil = resetAt
+		t.mu.Unlock()
+	}
+
+	switch {
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return backoff(attempt), true
+
+	case resp.StatusCode != http.StatusForbidden &&
+		resp.StatusCode != http.StatusTooManyRequests:
+		return 0, false
+
+	case resp.Header.Get(RetryAfterHeader) != "":
+		seconds, err := strconv.Atoi(resp.Header.Get(RetryAfterHeader))
+		if err != nil {
+			return backoff(attempt), true
+		}
+
+		t.logger().Warn("Hit a GitHub API secondary rate limit")
+		return time.Duration(seconds) * time.Second, true
+
+	case remaining == "0" && reset > 0:
+		t.logger().Warn("Hit the GitHub API rate limit")
+		// Allow for clock skew between us and GitHub
+		return time.Until(resetAt) + time.Second, true
+
+	case isSecondaryLimit(resp):
+		t.logger().Warn("Hit a GitHub API secondary rate limit")
+		return secondaryLimitWait, true
+
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return backoff(attempt), true
+	}
+
+	// Any other 403 is a permission problem that retrying will not solve
+	return 0, false
+}
+
+// isSecondaryLimit reports whether a 403 response is due to a secondary (a.k.a.
+// abuse) rate limit. The body is read and replaced.
+func isSecondaryLimit(resp *http.Response) bool {
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return false
+	}
+
+	message := strings.ToLower(string(body))
+
+	return strings.Contains(message, "secondary rate limit") ||
+		strings.Contains(message, "abuse")
+}
+
+// Compile-time interface satisfaction check
+var _ http.RoundTripper = (*RateLimitTransport)(nil)
@@ -0,0 +1,172 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestRateLimit returns a RateLimitTransport that records its waits instead
+// of sleeping
+func newTestRateLimit() (*RateLimitTransport, *[]time.Duration) {
+	waits := []time.Duration{}
+
+	rl := NewRateLimit(nil)
+	rl.sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+
+	return rl, &waits
+}
+
+// serveSequence serves the given handlers in order, one per request, repeating
+// the last one
+func serveSequence(handlers ...http.HandlerFunc) *httptest.Server {
+	requests := 0
+
+	return httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			handler := handlers[len(handlers)-1]
+			if requests < len(handlers) {
+				handler = handlers[requests]
+			}
+			requests++
+
+			handler(w, r)
+		},
+	))
+}
+
+func ok(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set(RateLimitRemainingHeader, "4999")
+	fmt.Fprint(w, "ok")
+}
+
+func TestRateLimitRetryAfter(t *testing.T) {
+	server := serveSequence(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(RetryAfterHeader, "30")
+			http.Error(w, "secondary rate limit", http.StatusForbidden)
+		},
+		ok,
+	)
+	defer server.Close()
+
+	rl, waits := newTestRateLimit()
+	resp, err := (&http.Client{Transport: rl}).Get(server.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []time.Duration{30 * time.Second}, *waits)
+}
+
+func TestRateLimitSecondaryWithoutRetryAfter(t *testing.T) {
+	server := serveSequence(
+		func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, `{"message": "You have exceeded a secondary rate limit."}`, http.StatusForbidden)
+		},
+		ok,
+	)
+	defer server.Close()
+
+	rl, waits := newTestRateLimit()
+	resp, err := (&http.Client{Transport: rl}).Get(server.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []time.Duration{secondaryLimitWait}, *waits)
+}
+
+func TestRateLimitServerErrors(t *testing.T) {
+	serverError := func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusBadGateway)
+	}
+
+	server := serveSequence(serverError, serverError, ok)
+	defer server.Close()
+
+	rl, waits := newTestRateLimit()
+	resp, err := (&http.Client{Transport: rl}).Get(server.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, *waits, 2)
+
+	// Backoff grows exponentially, with jitter of up to half the delay
+	assert.True(t, (*waits)[0] >= baseBackoff && (*waits)[0] <= baseBackoff*3/2)
+	assert.True(t, (*waits)[1] >= 2*baseBackoff && (*waits)[1] <= 3*baseBackoff)
+
+	// Retries are bounded
+	server = serveSequence(serverError)
+	defer server.Close()
+
+	rl, waits = newTestRateLimit()
+	resp, err = (&http.Client{Transport: rl}).Get(server.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	assert.Len(t, *waits, DefaultMaxRetries)
+}
+
+func TestRateLimitExhausted(t *testing.T) {
+	reset := time.Now().Add(time.Hour)
+
+	server := serveSequence(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(RateLimitRemainingHeader, "0")
+		w.Header().Set(RateLimitResetHeader, strconv.FormatInt(reset.Unix(), 10))
+		http.Error(w, "API rate limit exceeded", http.StatusForbidden)
+	})
+	defer server.Close()
+
+	rl, waits := newTestRateLimit()
+	_, err := (&http.Client{Transport: rl}).Get(server.URL)
+	assert.True(t, errors.Is(err, ErrRateLimitExhausted))
+	assert.Empty(t, *waits)
+
+	rateLimitErr := &RateLimitError{}
+	assert.True(t, errors.As(err, &rateLimitErr))
+	assert.Contains(t, rateLimitErr.Error(), "resets at")
+
+	// Further requests are not sent until the limit resets
+	_, err = (&http.Client{Transport: rl}).Get(server.URL)
+	assert.True(t, errors.Is(err, ErrRateLimitExhausted))
+}
+
+func TestRateLimitWaitsForReset(t *testing.T) {
+	reset := time.Now().Add(10 * time.Second)
+
+	server := serveSequence(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(RateLimitRemainingHeader, "0")
+			w.Header().Set(RateLimitResetHeader, strconv.FormatInt(reset.Unix(), 10))
+			http.Error(w, "API rate limit exceeded", http.StatusForbidden)
+		},
+		ok,
+	)
+	defer server.Close()
+
+	rl, waits := newTestRateLimit()
+	resp, err := (&http.Client{Transport: rl}).Get(server.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, *waits, 1)
+	assert.True(t, (*waits)[0] > 5*time.Second && (*waits)[0] <= 12*time.Second)
+}
+
+func TestRateLimitPermissionDenied(t *testing.T) {
+	server := serveSequence(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(RateLimitRemainingHeader, "4999")
+		http.Error(w, "Resource not accessible by integration", http.StatusForbidden)
+	})
+	defer server.Close()
+
+	rl, waits := newTestRateLimit()
+	resp, err := (&http.Client{Transport: rl}).Get(server.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Empty(t, *waits)
+}